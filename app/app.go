@@ -0,0 +1,302 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/jinzhu/gorm"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"seckill/conf"
+	goodsDao "seckill/dao/goods"
+	orderDao "seckill/dao/order"
+	paymentDao "seckill/dao/payment"
+	roleDao "seckill/dao/role"
+	tokenDao "seckill/dao/token"
+	userDao "seckill/dao/user"
+	"seckill/handler"
+	"seckill/infra/cache"
+	"seckill/infra/db"
+	"seckill/infra/migrate"
+	"seckill/infra/secret"
+	"seckill/job"
+	"seckill/mq"
+	"seckill/payment"
+	"seckill/payment/mock"
+	"seckill/router"
+	"seckill/service/goods"
+	"seckill/service/order"
+	"seckill/service/risk"
+	"seckill/service/role"
+	"seckill/service/stock"
+	"seckill/service/user"
+	"syscall"
+	"time"
+)
+
+// 未配置时优雅关闭的最长等待时间
+const defaultShutdownTimeout = 10 * time.Second
+
+// App 应用容器，持有所有需要在启动与关闭时管理的资源
+type App struct {
+	Config    *conf.AppConfig
+	DB        *gorm.DB
+	Redis     *redis.Client
+	Consumers *mq.Consumers
+	Jobs      *job.Jobs
+	Server    *http.Server
+}
+
+// New 读取配置文件，按依赖顺序创建数据源、dao、service、handler 与路由
+func New(configPath string) (a *App, e error) {
+	a = &App{}
+	if a.Config, e = conf.Load(configPath); e != nil {
+		return nil, e
+	}
+	if a.DB, e = db.Open(a.Config.Datasource); e != nil {
+		return nil, e
+	}
+	if a.Config.Datasource.AutoMigrate {
+		if e = migrateUp(a.DB); e != nil {
+			a.DB.Close()
+			return nil, e
+		}
+	}
+	if a.Redis, e = cache.Open(a.Config.Redis); e != nil {
+		a.DB.Close()
+		return nil, e
+	}
+	gateway, e := newPaymentGateway(a.Config.Payment)
+	if e != nil {
+		a.DB.Close()
+		a.Redis.Close()
+		return nil, e
+	}
+	keys, e := secret.LoadKeySet(a.Config.Jwt)
+	if e != nil {
+		a.DB.Close()
+		a.Redis.Close()
+		return nil, e
+	}
+	jwt := secret.NewJWT(keys, a.Config.Jwt)
+
+	// dao 层
+	goodsD := goodsDao.NewGoodsDao(a.DB)
+	orderD := orderDao.NewOrderDao(a.DB)
+	paymentD := paymentDao.NewPaymentDao(a.DB)
+	userD := userDao.NewUserDao(a.DB)
+	refreshTokenD := tokenDao.NewRefreshTokenDao(a.DB)
+	roleD := roleDao.NewRoleDao(a.DB)
+
+	// 消息生产者
+	orderTimeoutQueue := mq.NewOrderTimeoutQueue(a.Redis, a.Config.Order.Expiration)
+	precreateOrderQueue := mq.NewPrecreateOrderQueue(a.Redis, a.Config.Queue)
+	soldOutNotifier := mq.NewSoldOutNotifier(a.Redis)
+
+	// service 层
+	goodsService := goods.NewGoodsService(goodsD, a.Redis, soldOutNotifier, a.Config.WarmUp, a.Config.Order.Expiration)
+	riskService := risk.NewRiskService(a.Redis, a.Config.Risk)
+	orderService := order.NewOrderService(orderD, paymentD, goodsService, riskService, gateway,
+		orderTimeoutQueue, a.Redis, a.Config.Order, a.Config.Payment, a.Config.Captcha, a.Config.Risk)
+	userService := user.NewUserService(userD, refreshTokenD, a.Redis, jwt, a.Config.PasswordPolicy)
+	roleService := role.NewRoleService(roleD, userD, a.Redis)
+	stockService := stock.NewStockService(goodsD, orderD, precreateOrderQueue, a.Redis, a.Config.Order.RefundRestock)
+
+	// 消息消费者与定时任务
+	a.Consumers = mq.NewConsumers(orderService, goodsService, orderTimeoutQueue, precreateOrderQueue,
+		soldOutNotifier, a.Config.Queue.Workers)
+	a.Jobs = job.New(stockService, goodsService, a.Config.Reconcile)
+
+	// handler 层与路由
+	engine := router.New(router.Handlers{
+		Goods: handler.NewGoodsHandler(goodsService),
+		User:  handler.NewUserHandler(userService),
+		Order: handler.NewOrderHandler(orderService),
+		Stock: handler.NewStockHandler(stockService),
+		Queue: handler.NewQueueHandler(a.Consumers),
+		Jwks:  handler.NewJwksHandler(jwt),
+		Role:  handler.NewRoleHandler(roleService),
+	}, a.Config.RateLimit, a.Redis, userService, roleService, jwt)
+	addr := a.Config.Server.Addr
+	if addr == "" {
+		addr = ":8080"
+	}
+	a.Server = &http.Server{
+		Addr:    addr,
+		Handler: engine,
+	}
+	return a, nil
+}
+
+// 根据配置的名称创建支付网关
+// 支付回调签名密钥为空时拒绝启动，避免任何人都可以伪造支付成功的回调
+func newPaymentGateway(c conf.Payment) (payment.IPaymentGateway, error) {
+	key, e := secret.LoadSecret(c.SecretEnv, c.SecretFile)
+	if e != nil {
+		return nil, fmt.Errorf("payment: %v", e)
+	}
+	switch c.Gateway {
+	case mock.Name:
+		return mock.New(c, key), nil
+	default:
+		return nil, fmt.Errorf("未知的支付网关【%s】", c.Gateway)
+	}
+}
+
+// Run 启动消息消费者、定时任务与 http 服务，收到中断信号后优雅关闭
+func (a *App) Run() error {
+	a.Consumers.Run()
+	a.Jobs.Run()
+	serveErr := make(chan error, 1)
+	go func() {
+		if err := a.Server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			serveErr <- err
+		}
+	}()
+
+	// 等待中断信号
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	var err error
+	select {
+	case <-quit:
+		log.Println("正在关闭服务...")
+	case err = <-serveErr:
+		log.Printf("项目启动错误：%v", err)
+	}
+
+	timeout := time.Duration(a.Config.Server.ShutdownTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	c, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	a.Shutdown(c)
+	return err
+}
+
+// Shutdown 停止接收新请求，停止消息消费者与定时任务，最后关闭数据源与 redis 连接
+func (a *App) Shutdown(c context.Context) {
+	if err := a.Server.Shutdown(c); err != nil {
+		log.Printf("http 服务关闭超时, err: %v", err)
+	}
+	if err := a.Consumers.Shutdown(c); err != nil {
+		log.Printf("消息消费者关闭超时, err: %v", err)
+	}
+	if err := a.Jobs.Shutdown(c); err != nil {
+		log.Printf("定时任务关闭超时, err: %v", err)
+	}
+	if err := a.DB.Close(); err != nil {
+		log.Printf("数据源连接关闭失败, err: %v", err)
+	}
+	if err := a.Redis.Close(); err != nil {
+		log.Printf("redis 连接关闭失败, err: %v", err)
+	}
+	log.Println("服务已关闭")
+}
+
+// Migrate 执行数据库迁移子命令：up 执行所有未执行的迁移，down 回滚最近一个迁移，status 查看迁移状态
+func Migrate(configPath string, command string) error {
+	cfg, e := conf.Load(configPath)
+	if e != nil {
+		return e
+	}
+	database, e := db.Open(cfg.Datasource)
+	if e != nil {
+		return e
+	}
+	defer database.Close()
+	switch command {
+	case "up":
+		return migrateUp(database)
+	case "down":
+		m, e := migrate.New(database)
+		if e != nil {
+			return e
+		}
+		mig, e := m.Down()
+		if e != nil {
+			return e
+		}
+		if mig == nil {
+			fmt.Println("没有可回滚的迁移")
+		} else {
+			fmt.Printf("已回滚迁移 %04d_%s\n", mig.Version, mig.Name)
+		}
+		return nil
+	case "status":
+		m, e := migrate.New(database)
+		if e != nil {
+			return e
+		}
+		status, e := m.Status()
+		if e != nil {
+			return e
+		}
+		for _, s := range status {
+			appliedAt := "未执行"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, appliedAt)
+		}
+		return nil
+	default:
+		return fmt.Errorf("未知的迁移命令【%s】，可选：up | down | status", command)
+	}
+}
+
+// Role 执行角色管理子命令：grant 授予用户角色，revoke 撤销用户角色，用于初始化第一个管理员
+func Role(configPath string, command string, username string, roleName string) error {
+	cfg, e := conf.Load(configPath)
+	if e != nil {
+		return e
+	}
+	database, e := db.Open(cfg.Datasource)
+	if e != nil {
+		return e
+	}
+	defer database.Close()
+	rdb, e := cache.Open(cfg.Redis)
+	if e != nil {
+		return e
+	}
+	defer rdb.Close()
+	userD := userDao.NewUserDao(database)
+	roleService := role.NewRoleService(roleDao.NewRoleDao(database), userD, rdb)
+	u, e := userD.QueryByUsername(username)
+	if e != nil {
+		return fmt.Errorf("查询用户【%s】失败：%w", username, e)
+	}
+	switch command {
+	case "grant":
+		if e = roleService.Grant(u.ID, roleName); e != nil {
+			return e
+		}
+		fmt.Printf("已授予用户【%s】角色【%s】\n", username, roleName)
+	case "revoke":
+		if e = roleService.Revoke(u.ID, roleName); e != nil {
+			return e
+		}
+		fmt.Printf("已撤销用户【%s】的角色【%s】\n", username, roleName)
+	default:
+		return fmt.Errorf("未知的角色命令【%s】，可选：grant | revoke", command)
+	}
+	return nil
+}
+
+// 执行所有未执行的迁移
+func migrateUp(database *gorm.DB) error {
+	m, e := migrate.New(database)
+	if e != nil {
+		return e
+	}
+	applied, e := m.Up()
+	if e != nil {
+		return e
+	}
+	log.Printf("已执行 %d 个迁移", len(applied))
+	return nil
+}
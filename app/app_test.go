@@ -0,0 +1,92 @@
+package app
+
+import (
+	"os"
+	"seckill/conf"
+	"seckill/infra/secret"
+	"seckill/payment/mock"
+	"testing"
+)
+
+// 设置环境变量，测试结束后恢复
+func setenv(t *testing.T, key, value string) {
+	t.Helper()
+	old, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+// 示例配置文件可以在不连接数据库与 redis 的情况下装载
+func TestLoadExampleConfig(t *testing.T) {
+	c, err := conf.Load("../config.yaml")
+	if err != nil {
+		t.Fatalf("conf.Load() error = %v", err)
+	}
+	if c.Payment.Gateway != mock.Name || c.Payment.SecretEnv == "" {
+		t.Errorf("payment config = %+v, want the mock gateway with a secret env", c.Payment)
+	}
+	if len(c.Jwt.Keys) == 0 || c.Jwt.SigningKid == "" {
+		t.Errorf("jwt config = %+v, want signing keys", c.Jwt)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New("testdata/missing.yaml"); err == nil {
+		t.Error("New() with a missing config file error = nil")
+	}
+}
+
+func TestNewPaymentGateway(t *testing.T) {
+	const env = "SECKILL_TEST_PAYMENT_SECRET"
+	setenv(t, env, "secret")
+	tests := []struct {
+		name    string
+		conf    conf.Payment
+		wantErr bool
+	}{
+		{"模拟支付网关", conf.Payment{Gateway: mock.Name, SecretEnv: env}, false},
+		{"未知的支付网关", conf.Payment{Gateway: "alipay", SecretEnv: env}, true},
+		{"没有配置签名密钥", conf.Payment{Gateway: mock.Name}, true},
+		{"签名密钥为空", conf.Payment{Gateway: mock.Name, SecretEnv: "SECKILL_TEST_EMPTY_SECRET"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway, err := newPaymentGateway(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newPaymentGateway() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && gateway.Name() != tt.conf.Gateway {
+				t.Errorf("gateway.Name() = %q, want %q", gateway.Name(), tt.conf.Gateway)
+			}
+		})
+	}
+}
+
+// 示例配置中的 jwt 密钥在配置了共享密钥后可以装载
+func TestLoadExampleKeySet(t *testing.T) {
+	c, err := conf.Load("../config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range c.Jwt.Keys {
+		if k.SecretEnv == "" {
+			t.Skipf("key %q is not loaded from an env var", k.Kid)
+		}
+		setenv(t, k.SecretEnv, "secret")
+	}
+	ks, err := secret.LoadKeySet(c.Jwt)
+	if err != nil {
+		t.Fatalf("secret.LoadKeySet() error = %v", err)
+	}
+	if ks.Signing().Kid != c.Jwt.SigningKid {
+		t.Errorf("Signing().Kid = %q, want %q", ks.Signing().Kid, c.Jwt.SigningKid)
+	}
+}
@@ -1,23 +1,10 @@
 package conf
 
 import (
-	_ "github.com/go-sql-driver/mysql"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
-	"log"
 )
 
-var (
-	// Config 配置信息全局变量
-	Config *AppConfig
-)
-
-// 初始化配置信息
-func init() {
-	Config = &AppConfig{}
-	Config.reloadConfig()
-}
-
 // AppConfig yaml 配置信息绑定
 type AppConfig struct {
 	App `yaml:"app"`
@@ -25,10 +12,27 @@ type AppConfig struct {
 
 // App 系统配置信息
 type App struct {
+	Server `yaml:"server"`
 	Datasource `yaml:"datasource"`
 	Redis `yaml:"redis"`
 	Order `yaml:"order"`
 	RateLimit `yaml:"rate_limit"`
+	Queue `yaml:"queue"`
+	Payment `yaml:"payment"`
+	Reconcile `yaml:"reconcile"`
+	WarmUp `yaml:"warm_up"`
+	Captcha `yaml:"captcha"`
+	Risk `yaml:"risk"`
+	PasswordPolicy `yaml:"password_policy"`
+	Jwt `yaml:"jwt"`
+}
+
+// Server http 服务配置信息
+type Server struct {
+	// 监听地址
+	Addr string `yaml:"addr"`
+	// 优雅关闭的最长等待时间，单位：秒，未配置时为 10 秒
+	ShutdownTimeout int64 `yaml:"shutdown_timeout"`
 }
 
 // Datasource 数据源配置信息
@@ -38,6 +42,8 @@ type Datasource struct {
 	BaseName string `yaml:"baseName"`
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
+	// 启动时是否自动执行未执行的数据库迁移
+	AutoMigrate bool `yaml:"auto_migrate"`
 }
 
 // Redis redis 配置信息
@@ -49,6 +55,12 @@ type Redis struct {
 // Order 订单配置信息
 type Order struct {
 	Expiration int64 `yaml:"expiration"`
+	// 秒杀结果的缓存时间，单位：秒
+	ResultExpiration int64 `yaml:"result_expiration"`
+	// 退款后是否把商品返还到秒杀库存中
+	RefundRestock bool `yaml:"refund_restock"`
+	// 秒杀地址的有效时间，单位：秒
+	PathExpiration int64 `yaml:"path_expiration"`
 }
 
 // RateLimit 限流配置信息
@@ -61,14 +73,115 @@ type RateLimit struct {
 	Count int64 `yaml:"count"`
 }
 
-// 装载配置信息
-func (appConfig *AppConfig) reloadConfig() {
-	yamlFile, err := ioutil.ReadFile("config.yaml")
+// Queue 消息队列配置信息
+type Queue struct {
+	// 消息的可见性超时时间，单位：秒，超时未确认的消息会被重新投递，默认为 30
+	VisibilityTimeout int64 `yaml:"visibility_timeout"`
+	// 消息最大重试次数，超过后进入死信队列，默认为 3
+	MaxRetry int `yaml:"max_retry"`
+	// 首次重试的等待时间，单位：秒，之后每次重试翻倍，默认为 2
+	RetryInterval int64 `yaml:"retry_interval"`
+	// 订单消费者数量
+	Workers int `yaml:"workers"`
+	// 消费者每批最多处理的消息数量，同一批消息在一个事务中创建订单，默认为 1
+	BatchSize int `yaml:"batch_size"`
+	// 消费者阻塞等待消息的最长时间，单位：秒，默认为 1
+	PopTimeout int64 `yaml:"pop_timeout"`
+}
+
+// Payment 支付配置信息
+type Payment struct {
+	// 使用的支付网关名称
+	Gateway string `yaml:"gateway"`
+	// 支付回调签名密钥从 SecretEnv 指定的环境变量或 SecretFile 指定的文件中读取，配置了环境变量时优先使用环境变量
+	SecretEnv  string `yaml:"secret_env"`
+	SecretFile string `yaml:"secret_file"`
+	// 支付回调地址
+	NotifyUrl string `yaml:"notify_url"`
+	// 模拟支付网关在发起支付后多少秒进行回调，0 表示不自动回调
+	MockNotifyDelay int64 `yaml:"mock_notify_delay"`
+	// 支付回调的时间戳与当前时间相差超过多少秒时拒绝该回调，防止回调被重放，单位：秒
+	NotifyWindow int64 `yaml:"notify_window"`
+	// 发起支付后多少秒仍未收到支付结果时，主动查询支付网关仍在支付中的订单回到未支付状态，单位：秒
+	PayingTimeout int64 `yaml:"paying_timeout"`
+}
+
+// Reconcile 库存对账配置信息
+type Reconcile struct {
+	// 定时对账的时间间隔，单位：秒，0 表示不开启定时对账
+	Interval int64 `yaml:"interval"`
+	// 定时对账时是否自动修复库存偏差
+	Repair bool `yaml:"repair"`
+}
+
+// WarmUp 秒杀商品预热配置信息
+type WarmUp struct {
+	// 在秒杀开始前多少分钟预热商品
+	Lead int64 `yaml:"lead"`
+	// 在秒杀结束后多少秒清理商品缓存，留出时间给队列中的订单完成创建，不小于订单的超时时间
+	TearDownDelay int64 `yaml:"tear_down_delay"`
+}
+
+// Captcha 验证码配置信息
+type Captcha struct {
+	// 验证码的有效时间，单位：秒
+	ValidTime int64 `yaml:"valid_time"`
+}
+
+// Risk 用户风控配置信息
+type Risk struct {
+	// 风险分达到阈值后拒绝用户参与秒杀
+	Threshold int64 `yaml:"threshold"`
+	// 风险分的统计窗口，单位：秒，窗口内没有新的风险行为时风险分清零
+	Window int64 `yaml:"window"`
+	// 验证码错误一次增加的风险分
+	CaptchaFailScore int64 `yaml:"captcha_fail_score"`
+}
+
+// PasswordPolicy 密码策略配置信息
+type PasswordPolicy struct {
+	// 密码最小长度，默认为 8
+	MinLength int `yaml:"min_length"`
+	// bcrypt 哈希的计算成本，默认为 10，调高后旧的哈希值会在用户下次登录时重新计算
+	HashCost int `yaml:"hash_cost"`
+}
+
+// Jwt 令牌配置信息
+type Jwt struct {
+	// 访问令牌的有效时间，单位：秒，默认为 900
+	AccessExpiration int64 `yaml:"access_expiration"`
+	// 刷新令牌的有效时间，单位：秒，默认为 30 天
+	RefreshExpiration int64 `yaml:"refresh_expiration"`
+	// 是否开启滑动会话，开启后访问令牌的剩余有效时间不足一半时，通过 X-Refreshed-Token 响应头返回新的访问令牌
+	Sliding bool `yaml:"sliding"`
+	// 签发令牌使用的密钥 kid，只配置了一个密钥时可以不填
+	SigningKid string `yaml:"signing_kid"`
+	// 密钥列表，签发密钥以外的密钥只用于校验
+	Keys []JwtKey `yaml:"keys"`
+}
+
+// JwtKey 令牌签名密钥
+type JwtKey struct {
+	Kid string `yaml:"kid"`
+	// 签名算法：HS256、RS256、EdDSA，默认为 HS256
+	Algorithm string `yaml:"algorithm"`
+	// HS256 共享密钥从 SecretEnv 指定的环境变量或 SecretFile 指定的文件中读取，配置了环境变量时优先使用环境变量
+	SecretEnv  string `yaml:"secret_env"`
+	SecretFile string `yaml:"secret_file"`
+	// RS256、EdDSA 的 PEM 格式私钥与公钥文件，只用于校验的密钥可以只配置公钥
+	PrivateKeyFile string `yaml:"private_key_file"`
+	PublicKeyFile  string `yaml:"public_key_file"`
+}
+
+// Load 从 path 装载配置信息
+func Load(path string) (*AppConfig, error) {
+	yamlFile, err := ioutil.ReadFile(path)
 	if err != nil {
-		log.Panicln("config.yaml 读取错误：", err)
+		return nil, err
 	}
-	err = yaml.Unmarshal(yamlFile, appConfig)
-	if err != nil {
-		log.Panicln("config.yaml 解析错误：", err)
+	appConfig := &AppConfig{}
+	if err = yaml.Unmarshal(yamlFile, appConfig); err != nil {
+		return nil, err
 	}
+	return appConfig, nil
 }
\ No newline at end of file
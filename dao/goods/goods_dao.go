@@ -2,12 +2,12 @@ package goods
 
 import (
 	"errors"
-	"fmt"
 	"github.com/jinzhu/gorm"
 	"log"
 	"seckill/infra/code"
-	"seckill/infra/db"
+	"seckill/infra/utils/query"
 	"seckill/model"
+	"time"
 )
 
 type goodsDao struct {
@@ -15,61 +15,107 @@ type goodsDao struct {
 }
 
 // NewGoodsDao 创建一个 GoodsDao 接口的实例
-func NewGoodsDao() *goodsDao {
-	return &goodsDao{db: db.DB}
+func NewGoodsDao(db *gorm.DB) *goodsDao {
+	return &goodsDao{db: db}
 }
 
 func (d *goodsDao) QueryGoodsByID(id int) (g model.Goods, e error) {
-	if e = db.DB.Where("id = ?", id).Take(&g).Error; e != nil {
+	if e = d.db.Where("id = ?", id).Take(&g).Error; e != nil {
 		log.Println(e)
 		return
 	}
 	return
 }
 
-func (d *goodsDao) QueryByCondition(c model.GoodsQueryCondition) (list []model.Goods, e error) {
+func (d *goodsDao) QueryByCondition(c model.GoodsQueryCondition) (list []model.Goods, rows int, e error) {
+	where := goodsWhere(c)
+	// 软删除已由 where 过滤
+	db := d.db.Unscoped().Model(&model.Goods{}).Where(where.Sql(), where.Args()...)
+	if e = db.Count(&rows).Error; e != nil {
+		log.Println(e)
+		e = code.DBErr
+		return
+	}
+	if e = db.Order(c.OrderBy()).Limit(c.PageDTO.GetLimit()).Offset(c.PageDTO.GetOffset()).Find(&list).Error; e != nil {
+		log.Println(e)
+		e = code.DBErr
+		return
+	}
+	return
+}
+
+// 商品查询条件
+func goodsWhere(c model.GoodsQueryCondition) *query.Builder {
 	timeZero := model.LocalTime{}.ZeroValue()
-	sql := c.Model.GetWhereSql()
+	where := c.Model.Where(query.NewBuilder())
 	if c.Name != "" {
-		sql.WriteString("and name like ")
-		sql.WriteString("'%")
-		sql.WriteString(c.Name)
-		sql.WriteString("%' ")
+		where.Like("name", c.Name)
 	}
 	if c.Price != 0.0 {
-		sql.WriteString("and price = ")
-		sql.WriteString(fmt.Sprintf("%f ", c.Price))
+		where.Eq("price", c.Price)
 	}
 	if c.Stock != 0 {
-		sql.WriteString("and price = ")
-		sql.WriteString(fmt.Sprintf("%d ", c.Stock))
+		where.Eq("stock", c.Stock)
 	}
 	if c.UserId != 0 {
-		sql.WriteString("and user_id = ")
-		sql.WriteString(fmt.Sprintf("%d ", c.UserId))
+		where.Eq("user_id", c.UserId)
 	}
 	if c.StartTime != timeZero {
-		sql.WriteString("and start_time = ")
-		sql.WriteString("'")
-		sql.WriteString(c.StartTime.String())
-		sql.WriteString("' ")
+		where.Eq("start_time", c.StartTime)
 	}
 	if c.EndTime != timeZero {
-		sql.WriteString("and end_time = ")
-		sql.WriteString("'")
-		sql.WriteString(c.EndTime.String())
-		sql.WriteString("' ")
+		where.Eq("end_time", c.EndTime)
 	}
-	if e = d.db.Limit(c.PageDTO.GetLimit()).Offset(c.PageDTO.GetOffset()).Find(&list, sql.String()).Error; e != nil {
-		log.Println(e)
-		e = code.DBErr
-		return
+	if c.PriceMin != 0.0 {
+		where.Gte("price", c.PriceMin)
 	}
-	return
+	if c.PriceMax != 0.0 {
+		where.Lte("price", c.PriceMax)
+	}
+	if c.StartFrom != timeZero {
+		where.Gte("start_time", c.StartFrom)
+	}
+	if c.StartTo != timeZero {
+		where.Lte("start_time", c.StartTo)
+	}
+	if c.EndFrom != timeZero {
+		where.Gte("end_time", c.EndFrom)
+	}
+	if c.EndTo != timeZero {
+		where.Lte("end_time", c.EndTo)
+	}
+	if len(c.Statuses) > 0 {
+		now := time.Now()
+		statuses := make([]*query.Builder, 0, len(c.Statuses))
+		for _, status := range c.Statuses {
+			statuses = append(statuses, goodsStatusWhere(status, now))
+		}
+		where.Or(statuses...)
+	}
+	return where
 }
 
-func (d *goodsDao) Insert(g model.Goods) error {
-	if e := db.DB.Create(&g).Error; e != nil {
+// 商品状态对应的查询条件，与 model.Goods.ToVO 中的状态计算保持一致
+func goodsStatusWhere(status int8, now time.Time) *query.Builder {
+	where := query.NewBuilder()
+	switch status {
+	case model.NotStarted:
+		where.Gt("start_time", now)
+	case model.OnGoing:
+		where.Lte("start_time", now).Gte("end_time", now).Gt("stock", 0)
+	case model.SoldOut:
+		where.Lte("start_time", now).Gte("end_time", now).Lte("stock", 0)
+	case model.Ended:
+		where.Lt("end_time", now)
+	default:
+		// 未知状态不匹配任何商品
+		where.Eq("1", 0)
+	}
+	return where
+}
+
+func (d *goodsDao) Insert(g *model.Goods) error {
+	if e := d.db.Create(g).Error; e != nil {
 		log.Println(e)
 		return e
 	}
@@ -78,7 +124,7 @@ func (d *goodsDao) Insert(g model.Goods) error {
 
 // Update 更新数据
 func (d *goodsDao) Update(g model.Goods) error {
-	if e := db.DB.Model(&g).Updates(&g).Error; e != nil {
+	if e := d.db.Model(&g).Updates(&g).Error; e != nil {
 		log.Println(e)
 		return e
 	}
@@ -89,7 +135,7 @@ func (d *goodsDao) Update(g model.Goods) error {
 func (d *goodsDao) Delete(id int) error {
 	var g model.Goods
 	g.ID = uint(id)
-	if e := db.DB.Take(&g).Error; e != nil {
+	if e := d.db.Take(&g).Error; e != nil {
 		if errors.Is(e, gorm.ErrRecordNotFound) {
 			return code.RecordNotFoundErr
 		}
@@ -99,9 +145,28 @@ func (d *goodsDao) Delete(id int) error {
 	if g.ID == 0 {
 		return code.RecordNotFoundErr
 	}
-	if e := db.DB.Delete(&g).Error; e != nil {
+	if e := d.db.Delete(&g).Error; e != nil {
 		log.Println(e)
 		return e
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// QueryAll 查询所有未删除的商品
+func (d *goodsDao) QueryAll() (list []model.Goods, e error) {
+	if e = d.db.Find(&list).Error; e != nil {
+		log.Println(e)
+		e = code.DBErr
+	}
+	return
+}
+
+// UpdateStock 以当前库存为条件修改库存
+func (d *goodsDao) UpdateStock(id int, expect, stock int) (bool, error) {
+	rs := d.db.Exec("update goods set stock = ? where id = ? and stock = ?", stock, id, expect)
+	if rs.Error != nil {
+		log.Println(rs.Error)
+		return false, code.DBErr
+	}
+	return rs.RowsAffected > 0, nil
+}
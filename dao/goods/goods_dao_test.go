@@ -0,0 +1,87 @@
+package goods
+
+import (
+	"reflect"
+	"seckill/model"
+	"testing"
+	"time"
+)
+
+func TestGoodsWhere(t *testing.T) {
+	from := model.LocalTime(time.Date(2021, 6, 1, 0, 0, 0, 0, time.Local))
+	to := model.LocalTime(time.Date(2021, 6, 2, 0, 0, 0, 0, time.Local))
+	tests := []struct {
+		name string
+		c    model.GoodsQueryCondition
+		sql  string
+		args []interface{}
+	}{
+		{
+			name: "没有条件时只过滤软删除",
+			sql:  "deleted_at IS NULL",
+		},
+		{
+			name: "名称中的通配符按字面量匹配",
+			c:    model.GoodsQueryCondition{Name: "a_b", UserId: 2},
+			sql:  "deleted_at IS NULL AND name LIKE ? AND user_id = ?",
+			args: []interface{}{`%a\_b%`, uint(2)},
+		},
+		{
+			name: "等值条件",
+			c:    model.GoodsQueryCondition{Price: 9.9, Stock: 3},
+			sql:  "deleted_at IS NULL AND price = ? AND stock = ?",
+			args: []interface{}{9.9, 3},
+		},
+		{
+			name: "价格与时间范围",
+			c:    model.GoodsQueryCondition{PriceMin: 1, PriceMax: 10, StartFrom: from, EndTo: to},
+			sql:  "deleted_at IS NULL AND price >= ? AND price <= ? AND start_time >= ? AND end_time <= ?",
+			args: []interface{}{1.0, 10.0, from, to},
+		},
+		{
+			name: "多个状态以 OR 连接",
+			c:    model.GoodsQueryCondition{Statuses: []int8{model.NotStarted, model.Ended}},
+			sql:  "deleted_at IS NULL AND ((start_time > ?) OR (end_time < ?))",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where := goodsWhere(tt.c)
+			if got := where.Sql(); got != tt.sql {
+				t.Errorf("Sql() = %q, want %q", got, tt.sql)
+			}
+			// 状态条件的参数为当前时间，只比较语句
+			if len(tt.c.Statuses) > 0 {
+				return
+			}
+			if got := where.Args(); !reflect.DeepEqual(got, tt.args) {
+				t.Errorf("Args() = %#v, want %#v", got, tt.args)
+			}
+		})
+	}
+}
+
+// 商品状态的查询条件与 model.Goods.ToVO 中的状态计算一致
+func TestGoodsStatusWhere(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		status int8
+		sql    string
+		args   []interface{}
+	}{
+		{model.NotStarted, "start_time > ?", []interface{}{now}},
+		{model.OnGoing, "start_time <= ? AND end_time >= ? AND stock > ?", []interface{}{now, now, 0}},
+		{model.SoldOut, "start_time <= ? AND end_time >= ? AND stock <= ?", []interface{}{now, now, 0}},
+		{model.Ended, "end_time < ?", []interface{}{now}},
+		{42, "1 = ?", []interface{}{0}},
+	}
+	for _, tt := range tests {
+		where := goodsStatusWhere(tt.status, now)
+		if got := where.Sql(); got != tt.sql {
+			t.Errorf("goodsStatusWhere(%d).Sql() = %q, want %q", tt.status, got, tt.sql)
+		}
+		if got := where.Args(); !reflect.DeepEqual(got, tt.args) {
+			t.Errorf("goodsStatusWhere(%d).Args() = %#v, want %#v", tt.status, got, tt.args)
+		}
+	}
+}
@@ -4,8 +4,13 @@ import "seckill/model"
 
 type IGoodsDao interface {
 	QueryGoodsByID(id int) (g model.Goods, e error)
-	QueryByCondition(c model.GoodsQueryCondition) ([]model.Goods, error)
-	Insert(g model.Goods) error
+	// QueryByCondition 分页查询商品，同时返回满足条件的总行数
+	QueryByCondition(c model.GoodsQueryCondition) (list []model.Goods, rows int, e error)
+	Insert(g *model.Goods) error
 	Update(g model.Goods) error
 	Delete(id int) error
+	// QueryAll 查询所有未删除的商品
+	QueryAll() ([]model.Goods, error)
+	// UpdateStock 只有当前库存为 expect 时才把库存修改为 stock，返回是否修改成功
+	UpdateStock(id int, expect, stock int) (bool, error)
 }
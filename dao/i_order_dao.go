@@ -4,10 +4,29 @@ import "seckill/model"
 
 type IOrderDao interface {
 	QueryOrderInfoByOrderId(id string) (o model.OrderInfo, e error)
-	QueryByCondition(c model.OrderInfoQueryCondition) (list []model.OrderInfo, e error)
+	// QueryByCondition 分页查询订单信息，同时返回满足条件的总行数
+	QueryByCondition(c model.OrderInfoQueryCondition) (list []model.OrderInfo, rows int, e error)
+	// QueryByCursor 查询 id 小于 cursor 的 limit 条订单信息，cursor 为 0 时从最新的订单开始
+	QueryByCursor(c model.OrderInfoQueryCondition, cursor uint, limit int) (list []model.OrderInfo, e error)
 	Insert(o model.OrderInfo) error
 	Update(o model.OrderInfo) error
 	Delete(id string) error
-	CreateOrder(o model.OrderInfo) error
-	CloseOrder(orderInfo model.OrderInfo) error
+	CreateOrder(o model.OrderInfo, limit int) error
+	// CreateOrders 在一个事务中批量创建订单，单个订单的库存不足、超出限购或订单已存在不影响同批次的其他订单
+	CreateOrders(list []model.OrderInfo, limits map[uint]int) (errs []error, e error)
+	// QueryExistedOrderIds 查询已经存在的订单编号
+	QueryExistedOrderIds(ids []string) (map[string]bool, error)
+	CloseOrder(orderInfo model.OrderInfo, operator string) error
+	// Refund 完成退款，restock 为 true 时同时返还数据库中的库存
+	Refund(orderInfo model.OrderInfo, restock bool, operator string) error
+	// Transit 订单状态流转，非法的流转或订单当前状态不是 t.From 时返回 code.OrderStatusErr
+	Transit(t model.OrderTransition) error
+	// StartPayment 在一个事务中创建支付记录并完成订单状态流转，状态流转失败时不会留下支付记录
+	StartPayment(p *model.Payment, t model.OrderTransition) error
+	// SettlePayment 在一个事务中更新支付中的支付记录并完成订单状态流转，支付记录已处理过时直接返回成功
+	SettlePayment(p model.Payment, t model.OrderTransition) error
+	// CountLiveOrders 按商品统计订单占用的库存数量
+	CountLiveOrders(refundRestock bool) (map[uint]int, error)
+	// QueryStatusHistory 查询订单状态流转记录
+	QueryStatusHistory(orderId string) (list []model.OrderStatusHistory, e error)
 }
@@ -0,0 +1,14 @@
+package dao
+
+import "seckill/model"
+
+type IPaymentDao interface {
+	// Insert 添加支付记录
+	Insert(p *model.Payment) error
+	// QueryByID 通过 id 查询支付记录
+	QueryByID(id int) (p model.Payment, e error)
+	// QueryByPaymentNo 通过支付流水号查询支付记录
+	QueryByPaymentNo(paymentNo string) (p model.Payment, e error)
+	// Update 更新支付记录
+	Update(p model.Payment) error
+}
@@ -0,0 +1,18 @@
+package dao
+
+import "seckill/model"
+
+type IRefreshTokenDao interface {
+	// Insert 添加刷新令牌
+	Insert(t *model.RefreshToken) error
+	// QueryByHash 通过令牌哈希值查询刷新令牌
+	QueryByHash(hash string) (t model.RefreshToken, e error)
+	// Rotate 把未使用的 old 标记为已使用并添加 new，old 已被使用或吊销时返回 false
+	Rotate(old model.RefreshToken, new *model.RefreshToken) (bool, error)
+	// RevokeFamily 吊销令牌族中的所有令牌
+	RevokeFamily(familyId string) error
+	// RevokeByDevice 吊销用户在某个设备上的所有令牌
+	RevokeByDevice(userId uint, deviceId string) error
+	// RevokeByUser 吊销用户的所有令牌
+	RevokeByUser(userId uint) error
+}
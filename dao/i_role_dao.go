@@ -0,0 +1,12 @@
+package dao
+
+type IRoleDao interface {
+	// QueryRoles 查询用户拥有的角色
+	QueryRoles(userId uint) (roles []string, e error)
+	// Grant 授予用户角色，用户已拥有该角色时忽略
+	Grant(userId uint, role string) error
+	// Revoke 撤销用户角色
+	Revoke(userId uint, role string) error
+	// RevokeKeepingLast 撤销用户角色，该用户是拥有此角色的最后一个用户时返回 code.LastAdminRevokeErr
+	RevokeKeepingLast(userId uint, role string) error
+}
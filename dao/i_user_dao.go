@@ -5,8 +5,16 @@ import (
 )
 
 type IUserDao interface {
-	// Insert 添加用户
-	Insert(user model.User) error
+	// Insert 添加用户，并授予用户角色
+	Insert(user model.User, roles []string) error
+	// QueryByID 通过 id 查询用户信息
+	QueryByID(id uint) (model.User, error)
 	// QueryByUsername 通过 username 查询用户信息
 	QueryByUsername(username string) (model.User, error)
+	// UpdatePassword 更新用户的密码哈希值
+	UpdatePassword(id uint, password string) error
+	// QueryTokenVersion 查询用户的令牌版本号
+	QueryTokenVersion(id uint) (int64, error)
+	// IncrTokenVersion 令牌版本号加 1，返回新的版本号
+	IncrTokenVersion(id uint) (int64, error)
 }
@@ -7,16 +7,18 @@ import (
 	"log"
 	"seckill/infra/code"
 	"seckill/infra/db"
+	"seckill/infra/utils/query"
 	"seckill/model"
+	"time"
 )
 
 type orderDao struct {
 	db *gorm.DB
 }
 
-func NewOrderDao() *orderDao {
+func NewOrderDao(db *gorm.DB) *orderDao {
 	return &orderDao{
-		db: db.DB,
+		db: db,
 	}
 }
 
@@ -28,46 +30,71 @@ func (d *orderDao) QueryOrderInfoByOrderId(id string) (o model.OrderInfo, e erro
 	return
 }
 
-func (d *orderDao) QueryByCondition(c model.OrderInfoQueryCondition) (list []model.OrderInfo, e error) {
-	sql := c.Model.GetWhereSql()
+func (d *orderDao) QueryByCondition(c model.OrderInfoQueryCondition) (list []model.OrderInfo, rows int, e error) {
+	where := orderInfoWhere(c)
+	// 软删除已由 where 过滤
+	db := d.db.Unscoped().Model(&model.OrderInfo{}).Where(where.Sql(), where.Args()...)
+	if e = db.Count(&rows).Error; e != nil {
+		log.Println(e)
+		e = code.DBErr
+		return
+	}
+	if e = db.Order("id desc").Limit(c.PageDTO.GetLimit()).Offset(c.PageDTO.GetOffset()).Find(&list).Error; e != nil {
+		log.Println(e)
+		e = code.DBErr
+		return
+	}
+	return
+}
+
+func (d *orderDao) QueryByCursor(c model.OrderInfoQueryCondition, cursor uint, limit int) (list []model.OrderInfo, e error) {
+	where := orderInfoWhere(c)
+	if cursor != 0 {
+		where.Lt("id", cursor)
+	}
+	// 按 id 倒序，利用主键索引跳过之前的数据，避免深分页时的大偏移量扫描
+	if e = d.db.Unscoped().Where(where.Sql(), where.Args()...).Order("id desc").Limit(limit).Find(&list).Error; e != nil {
+		log.Println(e)
+		e = code.DBErr
+		return
+	}
+	return
+}
+
+// 订单信息查询条件
+func orderInfoWhere(c model.OrderInfoQueryCondition) *query.Builder {
+	timeZero := model.LocalTime{}.ZeroValue()
+	where := c.Model.Where(query.NewBuilder())
 	if c.OrderId != "" {
-		sql.WriteString("and order_id = ")
-		sql.WriteString("'")
-		sql.WriteString(c.OrderId)
-		sql.WriteString("' ")
+		where.Eq("order_id", c.OrderId)
 	}
 	if c.UserId != 0 {
-		sql.WriteString("and user_id = ")
-		sql.WriteString(fmt.Sprintf("%d ", c.UserId))
+		where.Eq("user_id", c.UserId)
 	}
 	if c.GoodsId != 0 {
-		sql.WriteString("and goods_id = ")
-		sql.WriteString(fmt.Sprintf("%d ", c.GoodsId))
+		where.Eq("goods_id", c.GoodsId)
 	}
 	if c.GoodsName != "" {
-		sql.WriteString("and goods_name like ")
-		sql.WriteString("'%")
-		sql.WriteString(c.GoodsName)
-		sql.WriteString("%' ")
+		where.Like("goods_name", c.GoodsName)
 	}
 	if c.GoodsPrice != 0.0 {
-		sql.WriteString("and goods_price = ")
-		sql.WriteString(fmt.Sprintf("%f ", c.GoodsPrice))
+		where.Eq("goods_price", c.GoodsPrice)
 	}
 	if c.PaymentId != 0 {
-		sql.WriteString("and payment_id = ")
-		sql.WriteString(fmt.Sprintf("%d ", c.PaymentId))
+		where.Eq("payment_id", c.PaymentId)
 	}
 	if c.Status != 0 {
-		sql.WriteString("and status = ")
-		sql.WriteString(fmt.Sprintf("%d ", c.Status))
+		where.Eq("status", c.Status)
 	}
-	if e = d.db.Limit(c.PageDTO.GetLimit()).Offset(c.PageDTO.GetOffset()).Find(&list, sql.String()).Error; e != nil {
-		log.Println(e)
-		e = code.DBErr
-		return
+	// 未支付状态的值为 0，需要通过 Statuses 查询
+	where.In("status", c.Statuses)
+	if c.CreatedFrom != timeZero {
+		where.Gte("created_at", c.CreatedFrom)
 	}
-	return
+	if c.CreatedTo != timeZero {
+		where.Lte("created_at", c.CreatedTo)
+	}
+	return where
 }
 
 func (d *orderDao) Insert(o model.OrderInfo) (e error) {
@@ -99,94 +126,310 @@ func (d *orderDao) Delete(id string) (e error) {
 	return
 }
 
-// CreateOrder 创建订单
-func (d *orderDao) CreateOrder(orderInfo model.OrderInfo) error {
-	err := d.db.Transaction(func(tx *gorm.DB) (e error) {
-		// 先减少商品库存
-		decrStockSql := "update goods set stock = stock - 1 where id = ? and stock > 0"
-		tx = tx.Exec(decrStockSql, orderInfo.GoodsId)
-		if e = tx.Error; e != nil {
-			log.Printf("tx.Exec() failed, err: %v, goodsId: %v", e, orderInfo.GoodsId)
-			return
-		}
-		if tx.RowsAffected == 0 {
-			log.Printf("tx.RowsAffected() failed, err: %v, rows: %v", tx.Error, tx.RowsAffected)
-			return errors.New("减库存失败")
-		}
+// CreateOrder 创建订单，limit 为每人限购数量
+func (d *orderDao) CreateOrder(orderInfo model.OrderInfo, limit int) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		return createOrder(tx, orderInfo, limit)
+	})
+}
 
-		// 创建订单
-		order := model.Order{
-			Model:   orderInfo.Model,
-			OrderId: orderInfo.OrderId,
-			UserId:  orderInfo.UserId,
-			GoodsId: orderInfo.GoodsId,
+// CreateOrders 在一个事务中批量创建订单，limits 为各商品的每人限购数量
+// 单个订单因库存不足、超出限购或订单已存在而失败时回滚到该订单的保存点，不影响同批次的其他订单，errs 与 list 一一对应；
+// 其他错误会回滚整个批次并通过 e 返回
+func (d *orderDao) CreateOrders(list []model.OrderInfo, limits map[uint]int) (errs []error, e error) {
+	errs = make([]error, len(list))
+	e = d.db.Transaction(func(tx *gorm.DB) error {
+		for i, orderInfo := range list {
+			savepoint := fmt.Sprintf("create_order_%d", i)
+			if err := tx.Exec("SAVEPOINT " + savepoint).Error; err != nil {
+				log.Printf("tx.Exec() failed, err: %v", err)
+				return err
+			}
+			err := createOrder(tx, orderInfo, limits[orderInfo.GoodsId])
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, code.GoodsSaleOut) && !errors.Is(err, code.StockNotEnough) &&
+				!errors.Is(err, code.PurchaseLimitErr) && !errors.Is(err, code.OrderExistedErr) {
+				return err
+			}
+			if e := tx.Exec("ROLLBACK TO SAVEPOINT " + savepoint).Error; e != nil {
+				log.Printf("tx.Exec() failed, err: %v", e)
+				return e
+			}
+			errs[i] = err
 		}
-		tx = tx.Create(&order)
-		if e = tx.Error; e != nil {
-			log.Printf("tx.Create() failed, err: %v, order: %v", e, order)
+		return nil
+	})
+	return
+}
+
+// QueryExistedOrderIds 查询已经存在的订单编号
+func (d *orderDao) QueryExistedOrderIds(ids []string) (existed map[string]bool, e error) {
+	var list []model.OrderInfo
+	if e = d.db.Select("order_id").Where("order_id in (?)", ids).Find(&list).Error; e != nil {
+		log.Println(e)
+		e = code.DBErr
+		return
+	}
+	existed = make(map[string]bool, len(list))
+	for _, v := range list {
+		existed[v.OrderId] = true
+	}
+	return
+}
+
+// 在事务中创建订单：校验限购、先减少商品库存、再创建订单与订单信息
+func createOrder(tx *gorm.DB, orderInfo model.OrderInfo, limit int) (e error) {
+	// 校验用户已购数量，已关闭的订单不计入
+	var bought struct {
+		Total int
+	}
+	if e = tx.Model(&model.OrderInfo{}).Select("coalesce(sum(quantity), 0) as total").
+		Where("user_id = ? and goods_id = ? and status <> ?", orderInfo.UserId, orderInfo.GoodsId, model.Closed).
+		Scan(&bought).Error; e != nil {
+		log.Printf("tx.Scan() failed, err: %v, goodsId: %v", e, orderInfo.GoodsId)
+		return
+	}
+	if bought.Total+orderInfo.GetQuantity() > limit {
+		return code.PurchaseLimitErr
+	}
+
+	// 先减少商品库存
+	quantity := orderInfo.GetQuantity()
+	decrStockSql := "update goods set stock = stock - ? where id = ? and stock >= ?"
+	tx = tx.Exec(decrStockSql, quantity, orderInfo.GoodsId, quantity)
+	if e = tx.Error; e != nil {
+		log.Printf("tx.Exec() failed, err: %v, goodsId: %v", e, orderInfo.GoodsId)
+		return
+	}
+	if tx.RowsAffected == 0 {
+		log.Printf("tx.RowsAffected() failed, err: %v, rows: %v", tx.Error, tx.RowsAffected)
+		// 区分数据库中已没有库存与剩余库存不足购买数量，后者需要归还预减的库存缓存
+		var g model.Goods
+		if e = tx.Select("stock").Where("id = ?", orderInfo.GoodsId).Take(&g).Error; e != nil {
+			log.Printf("tx.Take() failed, err: %v, goodsId: %v", e, orderInfo.GoodsId)
 			return
 		}
-		if tx.RowsAffected == 0 {
-			log.Printf("tx.Create() failed, err: %v, rows: %v", tx.Error, tx.RowsAffected)
-			return errors.New("创建订单失败")
+		if g.Stock > 0 {
+			return code.StockNotEnough
 		}
+		return code.GoodsSaleOut
+	}
 
-		// 创建订单信息
-		tx = tx.Create(&orderInfo)
-		if e = tx.Error; e != nil {
-			log.Printf("tx.Create() failed, err: %v, order: %v", e, order)
-			return
-		}
-		if tx.RowsAffected == 0 {
-			log.Printf("tx.Create() failed, err: %v, rows: %v", tx.Error, tx.RowsAffected)
-			return errors.New("创建订单信息失败")
+	// 创建订单
+	order := model.Order{
+		Model:   orderInfo.Model,
+		OrderId: orderInfo.OrderId,
+		UserId:  orderInfo.UserId,
+		GoodsId: orderInfo.GoodsId,
+	}
+	tx = tx.Create(&order)
+	if e = tx.Error; e != nil {
+		// 其他消费者已经创建了该订单，回滚到保存点撤销减少的库存
+		if db.IsDuplicateKey(e) {
+			return code.OrderExistedErr
 		}
-		// 提交事务
-		return nil
-	})
-	return err
+		log.Printf("tx.Create() failed, err: %v, order: %v", e, order)
+		return
+	}
+	if tx.RowsAffected == 0 {
+		log.Printf("tx.Create() failed, err: %v, rows: %v", tx.Error, tx.RowsAffected)
+		return errors.New("创建订单失败")
+	}
+
+	// 创建订单信息
+	tx = tx.Create(&orderInfo)
+	if e = tx.Error; e != nil {
+		log.Printf("tx.Create() failed, err: %v, order: %v", e, order)
+		return
+	}
+	if tx.RowsAffected == 0 {
+		log.Printf("tx.Create() failed, err: %v, rows: %v", tx.Error, tx.RowsAffected)
+		return errors.New("创建订单信息失败")
+	}
+	return nil
 }
 
 // CloseOrder 关闭订单
-func (d *orderDao) CloseOrder(orderInfo model.OrderInfo) error {
+func (d *orderDao) CloseOrder(orderInfo model.OrderInfo, operator string) error {
 	err := d.db.Transaction(func(tx *gorm.DB) (e error) {
+		// 修改订单状态，以订单当前状态为条件，保证同一订单只会被关闭一次
+		if e = transit(tx, model.OrderTransition{
+			OrderId:  orderInfo.OrderId,
+			From:     orderInfo.Status,
+			To:       model.Closed,
+			Operator: operator,
+			Remark:   "关闭订单",
+		}); e != nil {
+			return
+		}
+
 		// 加库存
-		incrStockSql := "update goods set stock = stock + 1 where id = ?"
-		tx = tx.Exec(incrStockSql, orderInfo.GoodsId)
-		if e = tx.Error; e != nil {
+		incrStockSql := "update goods set stock = stock + ? where id = ?"
+		rs := tx.Exec(incrStockSql, orderInfo.GetQuantity(), orderInfo.GoodsId)
+		if e = rs.Error; e != nil {
 			log.Printf("tx.Exec() failed, err: %v, goodsId: %v", e, orderInfo.GoodsId)
 			return
 		}
-		if tx.RowsAffected == 0 {
-			log.Printf("tx.RowsAffected() failed, err: %v, rows: %v", tx.Error, tx.RowsAffected)
+		if rs.RowsAffected == 0 {
+			log.Printf("tx.RowsAffected() failed, err: %v, rows: %v", rs.Error, rs.RowsAffected)
 			e = errors.New("加库存失败")
 			return
 		}
 
 		// 删除订单
-		if e = tx.Delete(model.Order{}, "order_id = ?", orderInfo.OrderId).Error; e != nil {
+		rs = tx.Delete(model.Order{}, "order_id = ?", orderInfo.OrderId)
+		if e = rs.Error; e != nil {
 			log.Printf("tx.Delete() failed, err: %v", e)
 			return
 		}
-		if tx.RowsAffected == 0 {
-			log.Printf("rs.RowsAffected() failed, err: %v, rows: %v", tx.Error, tx.RowsAffected)
+		if rs.RowsAffected == 0 {
+			log.Printf("rs.RowsAffected() failed, err: %v, rows: %v", rs.Error, rs.RowsAffected)
 			e = errors.New("删除订单失败")
 			return
 		}
+		// 提交事务
+		return nil
+	})
+	return err
+}
 
-		// 修改订单信息
-		if e = tx.Model(&orderInfo).Where("order_id = ? and status = ?", orderInfo.OrderId, orderInfo.Status).
-			Update("status = ?", model.Unpaid).Error; e != nil {
-			log.Printf("tx.Update() failed, err: %v", e)
+// Refund 完成退款
+func (d *orderDao) Refund(orderInfo model.OrderInfo, restock bool, operator string) error {
+	return d.db.Transaction(func(tx *gorm.DB) (e error) {
+		// 订单状态：退款中 -> 已退款
+		if e = transit(tx, model.OrderTransition{
+			OrderId:  orderInfo.OrderId,
+			From:     model.Refunding,
+			To:       model.Refunded,
+			Operator: operator,
+			Remark:   "退款完成",
+		}); e != nil {
 			return
 		}
-		if tx.RowsAffected == 0 {
-			log.Printf("rs.RowsAffected() failed, err: %v, rows: %v", tx.Error, tx.RowsAffected)
-			e = errors.New("修改订单信息失败")
+		if !restock {
+			return nil
+		}
+		// 返还库存
+		incrStockSql := "update goods set stock = stock + ? where id = ?"
+		if e = tx.Exec(incrStockSql, orderInfo.GetQuantity(), orderInfo.GoodsId).Error; e != nil {
+			log.Printf("tx.Exec() failed, err: %v, goodsId: %v", e, orderInfo.GoodsId)
 			return
 		}
-		// 提交事务
 		return nil
 	})
-	return err
-}
\ No newline at end of file
+}
+
+// StartPayment 在一个事务中创建支付记录并完成订单状态流转，并发发起支付时只有一个能成功
+// 支付记录的 id 通过 payment_id 记录到订单信息中
+func (d *orderDao) StartPayment(p *model.Payment, t model.OrderTransition) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		if e := tx.Create(p).Error; e != nil {
+			log.Printf("tx.Create() failed, err: %v, paymentNo: %v", e, p.PaymentNo)
+			return code.DBErr
+		}
+		if t.Attrs == nil {
+			t.Attrs = make(map[string]interface{})
+		}
+		t.Attrs["payment_id"] = p.ID
+		return transit(tx, t)
+	})
+}
+
+// SettlePayment 在一个事务中更新支付中的支付记录并完成订单状态流转
+// 支付记录已不是支付中时说明该支付结果已经处理过，直接返回成功
+func (d *orderDao) SettlePayment(p model.Payment, t model.OrderTransition) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		rs := tx.Model(&model.Payment{}).Where("id = ? and status = ?", p.ID, model.PaymentPaying).
+			Updates(map[string]interface{}{
+				"status":     p.Status,
+				"trade_no":   p.TradeNo,
+				"updated_at": model.LocalTime(time.Now()),
+			})
+		if rs.Error != nil {
+			log.Printf("tx.Updates() failed, err: %v, paymentNo: %v", rs.Error, p.PaymentNo)
+			return code.DBErr
+		}
+		if rs.RowsAffected == 0 {
+			return nil
+		}
+		return transit(tx, t)
+	})
+}
+
+// Transit 订单状态流转
+func (d *orderDao) Transit(t model.OrderTransition) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		return transit(tx, t)
+	})
+}
+
+// CountLiveOrders 按商品统计订单占用的库存数量
+// 已关闭的订单会返还库存，refundRestock 为 true 时已退款的订单也会返还库存
+func (d *orderDao) CountLiveOrders(refundRestock bool) (counts map[uint]int, e error) {
+	var rows []struct {
+		GoodsId uint
+		Count   int
+	}
+	released := []int8{model.Closed}
+	if refundRestock {
+		released = append(released, model.Refunded)
+	}
+	if e = d.db.Model(&model.OrderInfo{}).Select("goods_id, sum(quantity) as count").
+		Where("status not in (?)", released).Group("goods_id").Scan(&rows).Error; e != nil {
+		log.Println(e)
+		e = code.DBErr
+		return
+	}
+	counts = make(map[uint]int, len(rows))
+	for _, v := range rows {
+		counts[v.GoodsId] = v.Count
+	}
+	return
+}
+
+// QueryStatusHistory 查询订单状态流转记录
+func (d *orderDao) QueryStatusHistory(orderId string) (list []model.OrderStatusHistory, e error) {
+	if e = d.db.Where("order_id = ?", orderId).Order("id").Find(&list).Error; e != nil {
+		log.Println(e)
+		e = code.DBErr
+	}
+	return
+}
+
+// 在事务中完成订单状态流转并记录流转历史
+// 只有状态机允许且订单当前状态为 t.From 时才能流转成功，否则返回 code.OrderStatusErr
+func transit(tx *gorm.DB, t model.OrderTransition) error {
+	if !model.CanTransit(t.From, t.To) {
+		log.Printf("订单【%s】不能从【%s】流转到【%s】", t.OrderId,
+			model.OrderStatusName(t.From), model.OrderStatusName(t.To))
+		return code.OrderStatusErr
+	}
+	now := model.LocalTime(time.Now())
+	fields := map[string]interface{}{"status": t.To, "updated_at": now}
+	for k, v := range t.Attrs {
+		fields[k] = v
+	}
+	rs := tx.Model(&model.OrderInfo{}).Where("order_id = ? and status = ?", t.OrderId, t.From).Updates(fields)
+	if rs.Error != nil {
+		log.Printf("tx.Updates() failed, err: %v, orderId: %v", rs.Error, t.OrderId)
+		return code.DBErr
+	}
+	if rs.RowsAffected == 0 {
+		return code.OrderStatusErr
+	}
+	history := model.OrderStatusHistory{
+		OrderId:    t.OrderId,
+		FromStatus: t.From,
+		ToStatus:   t.To,
+		Operator:   t.Operator,
+		Remark:     t.Remark,
+	}
+	history.CreatedAt = now
+	if e := tx.Create(&history).Error; e != nil {
+		log.Printf("tx.Create() failed, err: %v, history: %v", e, history)
+		return code.DBErr
+	}
+	return nil
+}
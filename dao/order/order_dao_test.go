@@ -0,0 +1,52 @@
+package order
+
+import (
+	"reflect"
+	"seckill/model"
+	"testing"
+	"time"
+)
+
+func TestOrderInfoWhere(t *testing.T) {
+	from := model.LocalTime(time.Date(2021, 6, 1, 0, 0, 0, 0, time.Local))
+	tests := []struct {
+		name string
+		c    model.OrderInfoQueryCondition
+		sql  string
+		args []interface{}
+	}{
+		{
+			name: "没有条件时只过滤软删除",
+			sql:  "deleted_at IS NULL",
+		},
+		{
+			name: "等值与模糊匹配",
+			c:    model.OrderInfoQueryCondition{UserId: 1, GoodsName: "100%", Status: model.Paid},
+			sql:  "deleted_at IS NULL AND user_id = ? AND goods_name LIKE ? AND status = ?",
+			args: []interface{}{uint(1), `%100\%%`, model.Paid},
+		},
+		{
+			name: "状态列表可以查询未支付订单",
+			c:    model.OrderInfoQueryCondition{Statuses: []int8{model.Unpaid, model.Paying}},
+			sql:  "deleted_at IS NULL AND status IN (?)",
+			args: []interface{}{[]int8{model.Unpaid, model.Paying}},
+		},
+		{
+			name: "下单时间范围",
+			c:    model.OrderInfoQueryCondition{CreatedFrom: from},
+			sql:  "deleted_at IS NULL AND created_at >= ?",
+			args: []interface{}{from},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where := orderInfoWhere(tt.c)
+			if got := where.Sql(); got != tt.sql {
+				t.Errorf("Sql() = %q, want %q", got, tt.sql)
+			}
+			if got := where.Args(); !reflect.DeepEqual(got, tt.args) {
+				t.Errorf("Args() = %#v, want %#v", got, tt.args)
+			}
+		})
+	}
+}
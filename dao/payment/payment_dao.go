@@ -0,0 +1,58 @@
+package payment
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"log"
+	"seckill/infra/code"
+	"seckill/model"
+)
+
+type paymentDao struct {
+	db *gorm.DB
+}
+
+// NewPaymentDao 创建一个 IPaymentDao 接口的实例
+func NewPaymentDao(db *gorm.DB) *paymentDao {
+	return &paymentDao{db: db}
+}
+
+func (d *paymentDao) Insert(p *model.Payment) error {
+	if e := d.db.Create(p).Error; e != nil {
+		log.Println(e)
+		return code.DBErr
+	}
+	return nil
+}
+
+func (d *paymentDao) QueryByID(id int) (p model.Payment, e error) {
+	if e = d.db.Where("id = ?", id).Take(&p).Error; e != nil {
+		if errors.Is(e, gorm.ErrRecordNotFound) {
+			e = code.PaymentNotFoundErr
+			return
+		}
+		log.Println(e)
+		e = code.DBErr
+	}
+	return
+}
+
+func (d *paymentDao) QueryByPaymentNo(paymentNo string) (p model.Payment, e error) {
+	if e = d.db.Where("payment_no = ?", paymentNo).Take(&p).Error; e != nil {
+		if errors.Is(e, gorm.ErrRecordNotFound) {
+			e = code.PaymentNotFoundErr
+			return
+		}
+		log.Println(e)
+		e = code.DBErr
+	}
+	return
+}
+
+func (d *paymentDao) Update(p model.Payment) error {
+	if e := d.db.Model(&p).Updates(&p).Error; e != nil {
+		log.Println(e)
+		return code.DBErr
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package role
+
+import (
+	"github.com/jinzhu/gorm"
+	"log"
+	"seckill/infra/code"
+	"seckill/model"
+	"time"
+)
+
+type roleDao struct {
+	db *gorm.DB
+}
+
+// NewRoleDao 创建一个 IRoleDao 接口的实例
+func NewRoleDao(db *gorm.DB) *roleDao {
+	return &roleDao{db: db}
+}
+
+func (d *roleDao) QueryRoles(userId uint) (roles []string, e error) {
+	if e = d.db.Model(&model.UserRole{}).Where("user_id = ?", userId).Order("role").
+		Pluck("role", &roles).Error; e != nil {
+		log.Println(e)
+		return nil, code.DBErr
+	}
+	return
+}
+
+func (d *roleDao) Grant(userId uint, role string) error {
+	r := model.UserRole{
+		CreatedAt: model.LocalTime(time.Now()),
+		UserId:    userId,
+		Role:      role,
+	}
+	// 依赖 (user_id, role) 唯一索引保证重复授予不会产生多条记录
+	if e := d.db.Set("gorm:insert_modifier", "IGNORE").Create(&r).Error; e != nil {
+		log.Println(e)
+		return code.DBErr
+	}
+	return nil
+}
+
+func (d *roleDao) Revoke(userId uint, role string) error {
+	if e := d.db.Where("user_id = ? AND role = ?", userId, role).Delete(&model.UserRole{}).Error; e != nil {
+		log.Println(e)
+		return code.DBErr
+	}
+	return nil
+}
+
+func (d *roleDao) RevokeKeepingLast(userId uint, role string) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		// 锁定拥有该角色的全部记录，并发撤销时统计与删除不会交错执行
+		var userIds []uint
+		if e := tx.Set("gorm:query_option", "FOR UPDATE").Model(&model.UserRole{}).
+			Where("role = ?", role).Pluck("user_id", &userIds).Error; e != nil {
+			log.Println(e)
+			return code.DBErr
+		}
+		owned := false
+		for _, id := range userIds {
+			if id == userId {
+				owned = true
+				break
+			}
+		}
+		// 用户没有该角色时不需要撤销
+		if !owned {
+			return nil
+		}
+		if len(userIds) <= 1 {
+			return code.LastAdminRevokeErr
+		}
+		if e := tx.Where("user_id = ? AND role = ?", userId, role).Delete(&model.UserRole{}).Error; e != nil {
+			log.Println(e)
+			return code.DBErr
+		}
+		return nil
+	})
+}
@@ -0,0 +1,83 @@
+package token
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"log"
+	"seckill/infra/code"
+	"seckill/model"
+	"time"
+)
+
+type refreshTokenDao struct {
+	db *gorm.DB
+}
+
+// NewRefreshTokenDao 创建一个 IRefreshTokenDao 接口的实例
+func NewRefreshTokenDao(db *gorm.DB) *refreshTokenDao {
+	return &refreshTokenDao{db: db}
+}
+
+func (d *refreshTokenDao) Insert(t *model.RefreshToken) error {
+	if e := d.db.Create(t).Error; e != nil {
+		log.Println(e)
+		return code.DBErr
+	}
+	return nil
+}
+
+func (d *refreshTokenDao) QueryByHash(hash string) (t model.RefreshToken, e error) {
+	if e = d.db.Where("token_hash = ?", hash).Take(&t).Error; e != nil {
+		if errors.Is(e, gorm.ErrRecordNotFound) {
+			e = code.RefreshTokenInvalidErr
+			return
+		}
+		log.Println(e)
+		e = code.DBErr
+	}
+	return
+}
+
+func (d *refreshTokenDao) Rotate(old model.RefreshToken, new *model.RefreshToken) (ok bool, e error) {
+	e = d.db.Transaction(func(tx *gorm.DB) error {
+		// 通过条件更新保证同一个令牌只能被轮换一次
+		res := tx.Model(&model.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", old.ID).
+			UpdateColumn("used_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil
+		}
+		ok = true
+		return tx.Create(new).Error
+	})
+	if e != nil {
+		log.Println(e)
+		return false, code.DBErr
+	}
+	return
+}
+
+func (d *refreshTokenDao) RevokeFamily(familyId string) error {
+	return d.revoke(d.db.Where("family_id = ?", familyId))
+}
+
+func (d *refreshTokenDao) RevokeByDevice(userId uint, deviceId string) error {
+	return d.revoke(d.db.Where("user_id = ? AND device_id = ?", userId, deviceId))
+}
+
+func (d *refreshTokenDao) RevokeByUser(userId uint) error {
+	return d.revoke(d.db.Where("user_id = ?", userId))
+}
+
+// 吊销满足条件且未被吊销的令牌
+func (d *refreshTokenDao) revoke(db *gorm.DB) error {
+	if e := db.Model(&model.RefreshToken{}).Where("revoked_at IS NULL").
+		UpdateColumn("revoked_at", time.Now()).Error; e != nil {
+		log.Println(e)
+		return code.DBErr
+	}
+	return nil
+}
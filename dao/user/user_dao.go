@@ -4,7 +4,6 @@ import (
 	"errors"
 	"github.com/jinzhu/gorm"
 	"seckill/infra/code"
-	"seckill/infra/db"
 	"seckill/model"
 	"time"
 )
@@ -14,27 +13,95 @@ type userDao struct {
 }
 
 // NewUserDao 创建一个 IUserDao 接口的实例
-func NewUserDao () *userDao {
-	return &userDao{db: db.DB}
+func NewUserDao(db *gorm.DB) *userDao {
+	return &userDao{db: db}
 }
 
-// Insert 添加用户
-func (d *userDao) Insert(u model.User) error {
-	u.CreatedAt = model.LocalTime(time.Now())
-	if e := db.DB.Create(&u).Error; e != nil {
+// Insert 添加用户，并在同一个事务中授予用户角色
+func (d *userDao) Insert(u model.User, roles []string) error {
+	now := model.LocalTime(time.Now())
+	u.CreatedAt = now
+	e := d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&u).Error; err != nil {
+			return err
+		}
+		for _, role := range roles {
+			r := model.UserRole{CreatedAt: now, UserId: u.ID, Role: role}
+			if err := tx.Create(&r).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if e != nil {
 		return code.DBErr
 	}
 	return nil
 }
 
+// QueryByID 通过 id 查询用户信息
+func (d *userDao) QueryByID(id uint) (model.User, error) {
+	var user model.User
+	if e := d.db.Where("id = ?", id).Take(&user).Error; e != nil {
+		if errors.Is(e, gorm.ErrRecordNotFound) {
+			return user, code.RecordNotFoundErr
+		}
+		return user, code.DBErr
+	}
+	return user, nil
+}
+
 // QueryByUsername 通过 username 查询用户信息
 func (d *userDao) QueryByUsername(username string) (model.User, error) {
 	var user model.User
-	if e := db.DB.Where("username = ?", username).Take(&user).Error; e != nil {
+	if e := d.db.Where("username = ?", username).Take(&user).Error; e != nil {
 		if errors.Is(e, gorm.ErrRecordNotFound) {
 			return user, code.RecordNotFoundErr
 		}
 		return user, code.DBErr
 	}
 	return user, nil
-}
\ No newline at end of file
+}
+
+// UpdatePassword 更新用户的密码哈希值
+func (d *userDao) UpdatePassword(id uint, password string) error {
+	if e := d.db.Model(&model.User{}).Where("id = ?", id).Update("password", password).Error; e != nil {
+		return code.DBErr
+	}
+	return nil
+}
+
+// QueryTokenVersion 查询用户的令牌版本号
+func (d *userDao) QueryTokenVersion(id uint) (int64, error) {
+	var user model.User
+	if e := d.db.Select("token_version").Where("id = ?", id).Take(&user).Error; e != nil {
+		if errors.Is(e, gorm.ErrRecordNotFound) {
+			return 0, code.RecordNotFoundErr
+		}
+		return 0, code.DBErr
+	}
+	return user.TokenVersion, nil
+}
+
+// IncrTokenVersion 令牌版本号加 1，返回新的版本号
+func (d *userDao) IncrTokenVersion(id uint) (version int64, e error) {
+	e = d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.User{}).Where("id = ?", id).
+			UpdateColumn("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+			return err
+		}
+		var user model.User
+		if err := tx.Select("token_version").Where("id = ?", id).Take(&user).Error; err != nil {
+			return err
+		}
+		version = user.TokenVersion
+		return nil
+	})
+	if e != nil {
+		if errors.Is(e, gorm.ErrRecordNotFound) {
+			return 0, code.RecordNotFoundErr
+		}
+		return 0, code.DBErr
+	}
+	return version, nil
+}
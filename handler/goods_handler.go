@@ -4,7 +4,6 @@ import (
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"seckill/infra/code"
-	"seckill/infra/secret"
 	"seckill/infra/utils/request"
 	"seckill/infra/utils/response"
 	"seckill/model"
@@ -17,9 +16,9 @@ type GoodsHandler struct {
 }
 
 // NewGoodsHandler 创建一个 GoodsHandler 实例
-func NewGoodsHandler() *GoodsHandler {
+func NewGoodsHandler(goodsService service.IGoodsService) *GoodsHandler {
 	return &GoodsHandler{
-		goodsService: service.GoodsService,
+		goodsService: goodsService,
 	}
 }
 
@@ -75,7 +74,7 @@ func (h *GoodsHandler) QueryGoodsVOByCondition(ctx *gin.Context) {
 		result model.Result
 		condition model.GoodsQueryCondition
 		e error
-		list []model.GoodsVO
+		page model.PageVO
 	)
 	if e = ctx.BindJSON(&condition); e != nil {
 		result.Message = e.Error()
@@ -87,20 +86,22 @@ func (h *GoodsHandler) QueryGoodsVOByCondition(ctx *gin.Context) {
 	if claims != nil {
 		condition.UserId = claims.UserId
 	}
-	if list, e = h.goodsService.FindByCondition(condition); e != nil {
-		result.Code = http.StatusInternalServerError
+	if page, e = h.goodsService.FindByCondition(condition); e != nil {
+		if e != code.PageParamErr && e != code.SortParamErr {
+			result.Code = http.StatusInternalServerError
+		}
 		result.Message = e.Error()
 		response.Fail(ctx, result)
 		return
 	}
-	result.Data = list
+	result.Data = page
 	response.Success(ctx, result)
 	return
 }
 
 // SecondKillGoodsInit go doc
 // @Summary 初始化秒杀商品
-// @Description 初始化当前商家的秒杀商品去参与秒杀活动
+// @Description 重新调度当前商家秒杀商品的预热与清理任务，已到预热时间的商品会立即预热
 // @Tags 商品管理
 // @version 1.0
 // @Accept json
@@ -142,25 +143,10 @@ func (h *GoodsHandler) SecondKillGoodsInit(ctx *gin.Context) {
 func (h *GoodsHandler) Insert(ctx *gin.Context) {
 	result := model.Result{}
 	// 获取当前用户数据
-	var claims *secret.CustomClaims
-	c, ok := ctx.Get("claims")
-	if !ok {
-		result.Code = http.StatusUnauthorized
-		result.Message = code.TokenInvalidErr.Error()
-		response.Fail(ctx, result)
-		return
-	}
-	claims, ok = c.(*secret.CustomClaims)
-	if !ok || claims == nil {
+	claims, err := request.GetCurrentCustomClaims(ctx)
+	if err != nil {
 		result.Code = http.StatusUnauthorized
-		result.Message = code.TokenInvalidErr.Error()
-		response.Fail(ctx, result)
-		return
-	}
-	// 不是卖家不能添加商品
-	if claims.Kind != model.NormalSeller {
-		result.Code = http.StatusForbidden
-		result.Message = code.StatusForbiddenErr.Error()
+		result.Message = err.Error()
 		response.Fail(ctx, result)
 		return
 	}
@@ -205,24 +191,13 @@ func (h *GoodsHandler) Update(ctx *gin.Context) {
 		response.Fail(ctx, result)
 		return
 	}
-	// 获取当前用户数据
-	claims, err := request.GetCurrentCustomClaims(ctx)
-	if err != nil {
-		result.Code = http.StatusUnauthorized
-		result.Message = err.Error()
-		response.Fail(ctx, result)
-		return
-	}
-
-	// 查询商品信息
-	goods, _ := h.goodsService.FindGoodsByID(int(dto.ID))
 	// 商家只能更新自己的商品信息
-	if goods.UserId != claims.UserId {
-		result.Code = http.StatusForbidden
-		result.Message = code.StatusForbiddenErr.Error()
-		response.Fail(ctx, result)
+	goods, ok := h.authorize(ctx, int(dto.ID))
+	if !ok {
 		return
 	}
+	// 商品的所属商家不能被修改
+	dto.UserId = goods.UserId
 	if e := h.goodsService.Update(dto); e != nil {
 		result.Code = http.StatusInternalServerError
 		result.Message = e.Error()
@@ -257,21 +232,8 @@ func (h *GoodsHandler) Delete(ctx *gin.Context) {
 		response.Fail(ctx, result)
 		return
 	}
-	// 获取当前用户数据
-	claims, err := request.GetCurrentCustomClaims(ctx)
-	if err != nil {
-		result.Code = http.StatusUnauthorized
-		result.Message = err.Error()
-		response.Fail(ctx, result)
-		return
-	}
-	// 查询商品信息
-	goods, _ := h.goodsService.FindGoodsByID(id)
 	// 商家只能删除自己的商品信息
-	if goods.UserId != claims.UserId {
-		result.Code = http.StatusForbidden
-		result.Message = code.StatusForbiddenErr.Error()
-		response.Fail(ctx, result)
+	if _, ok := h.authorize(ctx, id); !ok {
 		return
 	}
 	e = h.goodsService.DeleteWithLogic(id)
@@ -283,4 +245,26 @@ func (h *GoodsHandler) Delete(ctx *gin.Context) {
 	}
 	response.Success(ctx, result)
 	return
-}
\ No newline at end of file
+}
+
+// 校验当前用户能否管理商品，商品不属于当前用户并且没有管理任意商品的权限时返回 403
+func (h *GoodsHandler) authorize(ctx *gin.Context, id int) (goods model.Goods, ok bool) {
+	result := model.Result{}
+	principal, e := request.GetCurrentPrincipal(ctx)
+	if e != nil {
+		result.Code = http.StatusUnauthorized
+		result.Message = e.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	if goods, e = h.goodsService.Authorize(principal, id, model.PermGoodsManage); e != nil {
+		result.Code = http.StatusBadRequest
+		if e == code.StatusForbiddenErr {
+			result.Code = http.StatusForbidden
+		}
+		result.Message = e.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	return goods, true
+}
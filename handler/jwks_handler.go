@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"seckill/infra/secret"
+)
+
+type JwksHandler struct {
+	jwt *secret.JWT
+}
+
+// NewJwksHandler 创建一个 JwksHandler 实例
+func NewJwksHandler(jwt *secret.JWT) *JwksHandler {
+	return &JwksHandler{
+		jwt: jwt,
+	}
+}
+
+// Keys go doc
+// @Summary 令牌校验公钥
+// @Description 以 JWKS 格式发布 RS256、EdDSA 签名密钥的公钥，供其他服务校验 seckill 签发的令牌
+// @Tags 用户管理
+// @version 1.0
+// @Produce  json
+// @Success 200 object secret.JWKS 公钥集合
+// @Router /.well-known/jwks.json [GET]
+func (h *JwksHandler) Keys(ctx *gin.Context) {
+	// JWKS 是标准格式，不使用 model.Result 包装
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, h.jwt.Keys.JWKS())
+}
@@ -7,6 +7,7 @@ import (
 	"seckill/infra/utils/request"
 	"seckill/infra/utils/response"
 	"seckill/model"
+	"seckill/payment"
 	"seckill/service"
 	"strconv"
 )
@@ -16,9 +17,9 @@ type OrderHandler struct {
 }
 
 // NewOrderHandler 创建一个 UserHandler 实例
-func NewOrderHandler() *OrderHandler {
+func NewOrderHandler(orderService service.IOrderService) *OrderHandler {
 	return &OrderHandler{
-		orderService: service.OrderService,
+		orderService: orderService,
 	}
 }
 
@@ -29,20 +30,17 @@ func NewOrderHandler() *OrderHandler {
 // @version 1.0
 // @Accept json
 // @Produce  json
-// @Param goods body model.GoodsDTO true "秒杀商品传输信息"
+// @Param path path string true "秒杀地址"
+// @Param seckill body model.SecondKillDTO true "秒杀传输信息"
 // @Success 200 object model.Result 成功后返回值
 // @Failure 400 object model.Result 请求参数有误
 // @Failure 401 object model.Result 需要登录
 // @Failure 403 object model.Result 没有操作权限
 // @Failure 500 object model.Result 操作失败
-// @Router /api/seckill [post]
+// @Router /api/seckill/{path} [post]
 func (h *OrderHandler) SecondKill(ctx *gin.Context) {
 	result := model.Result{}
-	dto := new(
-		struct {
-			GoodsId int `json:"goodsId" binding:"required"`
-		},
-	)
+	dto := new(model.SecondKillDTO)
 	// 数据绑定
 	if e := ctx.BindJSON(&dto); e != nil {
 		result.Message = e.Error()
@@ -52,7 +50,7 @@ func (h *OrderHandler) SecondKill(ctx *gin.Context) {
 	// 获取当前用户信息
 	claims, _ := request.GetCurrentCustomClaims(ctx)
 	// 参与秒杀
-	if e := h.orderService.SecondKill(int(claims.UserId), dto.GoodsId); e != nil {
+	if e := h.orderService.SecondKill(int(claims.UserId), dto.GoodsId, dto.Quantity, ctx.Param("path")); e != nil {
 		result.Message = e.Error()
 		response.Fail(ctx, result)
 		return
@@ -61,6 +59,93 @@ func (h *OrderHandler) SecondKill(ctx *gin.Context) {
 	return
 }
 
+// GetCaptcha go doc
+// @Summary 获取秒杀验证码
+// @Description 秒杀开始后获取算术验证码图片，获取秒杀地址时需要提交验证码答案
+// @Tags 商品秒杀
+// @version 1.0
+// @Accept json
+// @Produce  json
+// @Param goodsId path int true "goodsId" "商品id"
+// @Success 200 object model.Result 成功后返回值
+// @Failure 400 object model.Result 请求参数有误
+// @Failure 401 object model.Result 需要登录
+// @Failure 500 object model.Result 操作失败
+// @Router /api/seckill/captcha/{goodsId} [GET]
+func (h *OrderHandler) GetCaptcha(ctx *gin.Context) {
+	var (
+		result model.Result
+		e error
+		goodsId int
+		vo model.CaptchaVO
+	)
+	goodsId, e = strconv.Atoi(ctx.Param("goodsId"))
+	if  e != nil || goodsId == 0 {
+		result.Code = http.StatusBadRequest
+		result.Message = code.RequestParamErr.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	claims, err := request.GetCurrentCustomClaims(ctx)
+	if err != nil {
+		result.Code = http.StatusUnauthorized
+		result.Message = "请先登录"
+		response.Fail(ctx, result)
+		return
+	}
+	if vo, e = h.orderService.GetCaptcha(int(claims.UserId), goodsId); e != nil {
+		result.Message = e.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	result.Data = vo
+	response.Success(ctx, result)
+}
+
+// GetSecondKillPath go doc
+// @Summary 获取秒杀地址
+// @Description 秒杀开始后获取一个短期有效的秒杀地址，秒杀地址只能使用一次
+// @Tags 商品秒杀
+// @version 1.0
+// @Accept json
+// @Produce  json
+// @Param goodsId path int true "goodsId" "商品id"
+// @Param captcha query string false "验证码答案，商品需要验证码时必填"
+// @Success 200 object model.Result 成功后返回值
+// @Failure 400 object model.Result 请求参数有误
+// @Failure 401 object model.Result 需要登录
+// @Failure 500 object model.Result 操作失败
+// @Router /api/seckill/path/{goodsId} [GET]
+func (h *OrderHandler) GetSecondKillPath(ctx *gin.Context) {
+	var (
+		result model.Result
+		e error
+		goodsId int
+		path string
+	)
+	goodsId, e = strconv.Atoi(ctx.Param("goodsId"))
+	if  e != nil || goodsId == 0 {
+		result.Code = http.StatusBadRequest
+		result.Message = code.RequestParamErr.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	claims, err := request.GetCurrentCustomClaims(ctx)
+	if err != nil {
+		result.Code = http.StatusUnauthorized
+		result.Message = "请先登录"
+		response.Fail(ctx, result)
+		return
+	}
+	if path, e = h.orderService.GetSecondKillPath(int(claims.UserId), goodsId, ctx.Query("captcha")); e != nil {
+		result.Message = e.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	result.Data = path
+	response.Success(ctx, result)
+}
+
 // GetSecondKillResult go doc
 // @Summary 查询秒杀结果
 // @Description 通过商品id查询对该商品的秒杀结果
@@ -127,7 +212,7 @@ func (h *OrderHandler) QueryByCondition(ctx *gin.Context) {
 		result    model.Result
 		e         error
 		condition model.OrderInfoQueryCondition
-		list      []model.OrderInfoVO
+		page      model.PageVO
 	)
 	// 数据绑定
 	if e = ctx.BindJSON(&condition); e != nil {
@@ -138,13 +223,15 @@ func (h *OrderHandler) QueryByCondition(ctx *gin.Context) {
 	// 默认查询当前登录人的数据
 	claims, _ := request.GetCurrentCustomClaims(ctx)
 	condition.UserId = claims.UserId
-	if list, e = h.orderService.GetOrderInfoVOList(condition); e != nil {
-		result.Code = http.StatusInternalServerError
+	if page, e = h.orderService.GetOrderInfoVOList(condition); e != nil {
+		if e != code.PageParamErr {
+			result.Code = http.StatusInternalServerError
+		}
 		result.Message = e.Error()
 		response.Fail(ctx, result)
 		return
 	}
-	result.Data = list
+	result.Data = page
 	response.Success(ctx, result)
 	return
 }
@@ -182,3 +269,223 @@ func (h *OrderHandler) QueryByID(ctx *gin.Context) {
 	response.Success(ctx, result)
 	return
 }
+
+// Cancel go doc
+// @Summary 取消订单
+// @Description 用户取消未支付的订单，并返还商品库存
+// @Tags 订单管理
+// @version 1.0
+// @Accept json
+// @Produce  json
+// @Param id path string true "id" "订单编号"
+// @Success 200 object model.Result 成功后返回值
+// @Failure 400 object model.Result 请求参数有误
+// @Failure 401 object model.Result 需要登录
+// @Failure 500 object model.Result 操作失败
+// @Router /api/order/{id}/cancel [POST]
+func (h *OrderHandler) Cancel(ctx *gin.Context) {
+	result := model.Result{}
+	idStr := ctx.Param("id")
+	if idStr == "" {
+		result.Code = http.StatusBadRequest
+		result.Message = code.RequestParamErr.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	claims, _ := request.GetCurrentCustomClaims(ctx)
+	if e := h.orderService.CancelOrder(int(claims.UserId), idStr); e != nil {
+		result.Message = e.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	response.Success(ctx, result)
+	return
+}
+
+// RequestRefund go doc
+// @Summary 申请退款
+// @Description 用户对已支付的订单申请退款
+// @Tags 订单管理
+// @version 1.0
+// @Accept json
+// @Produce  json
+// @Param id path string true "id" "订单编号"
+// @Param refund body model.RefundDTO true "退款申请信息"
+// @Success 200 object model.Result 成功后返回值
+// @Failure 400 object model.Result 请求参数有误
+// @Failure 401 object model.Result 需要登录
+// @Failure 500 object model.Result 操作失败
+// @Router /api/order/{id}/refund [POST]
+func (h *OrderHandler) RequestRefund(ctx *gin.Context) {
+	var (
+		result model.Result
+		dto    model.RefundDTO
+	)
+	idStr := ctx.Param("id")
+	if idStr == "" {
+		result.Code = http.StatusBadRequest
+		result.Message = code.RequestParamErr.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	// 数据绑定
+	if e := ctx.BindJSON(&dto); e != nil {
+		result.Message = e.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	claims, _ := request.GetCurrentCustomClaims(ctx)
+	if e := h.orderService.RequestRefund(int(claims.UserId), idStr, dto.Reason); e != nil {
+		result.Message = e.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	response.Success(ctx, result)
+	return
+}
+
+// AuditRefund go doc
+// @Summary 审核退款
+// @Description 商家同意或拒绝用户的退款申请
+// @Tags 订单管理
+// @version 1.0
+// @Accept json
+// @Produce  json
+// @Param id path string true "id" "订单编号"
+// @Param audit body model.RefundAuditDTO true "退款审核信息"
+// @Success 200 object model.Result 成功后返回值
+// @Failure 400 object model.Result 请求参数有误
+// @Failure 401 object model.Result 需要登录
+// @Failure 403 object model.Result 没有操作权限
+// @Failure 500 object model.Result 操作失败
+// @Router /api/order/{id}/refund/audit [POST]
+func (h *OrderHandler) AuditRefund(ctx *gin.Context) {
+	var (
+		result model.Result
+		dto    model.RefundAuditDTO
+	)
+	idStr := ctx.Param("id")
+	if idStr == "" {
+		result.Code = http.StatusBadRequest
+		result.Message = code.RequestParamErr.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	// 数据绑定
+	if e := ctx.BindJSON(&dto); e != nil {
+		result.Message = e.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	principal, _ := request.GetCurrentPrincipal(ctx)
+	if e := h.orderService.AuditRefund(principal, idStr, dto); e != nil {
+		if e == code.StatusForbiddenErr {
+			result.Code = http.StatusForbidden
+		}
+		result.Message = e.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	response.Success(ctx, result)
+	return
+}
+
+// QueryStatusHistory go doc
+// @Summary 查询订单状态流转记录
+// @Description 通过订单编号查询订单状态的流转历史
+// @Tags 订单管理
+// @version 1.0
+// @Accept json
+// @Produce  json
+// @Param id path string true "id" "订单编号"
+// @Success 200 object model.Result 成功后返回值
+// @Failure 400 object model.Result 请求参数有误
+// @Failure 401 object model.Result 需要登录
+// @Failure 500 object model.Result 操作失败
+// @Router /api/order/{id}/history [GET]
+func (h *OrderHandler) QueryStatusHistory(ctx *gin.Context) {
+	result := model.Result{}
+	idStr := ctx.Param("id")
+	if idStr == "" {
+		result.Code = http.StatusBadRequest
+		result.Message = code.RequestParamErr.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	claims, _ := request.GetCurrentCustomClaims(ctx)
+	list, e := h.orderService.GetOrderStatusHistory(int(claims.UserId), idStr)
+	if e != nil {
+		result.Message = e.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	result.Data = list
+	response.Success(ctx, result)
+	return
+}
+
+// Pay go doc
+// @Summary 支付订单
+// @Description 通过订单编号发起支付，订单状态变为支付中
+// @Tags 订单管理
+// @version 1.0
+// @Accept json
+// @Produce  json
+// @Param id path string true "id" "订单编号"
+// @Success 200 object model.Result model.PayVO 成功后返回值
+// @Failure 400 object model.Result 请求参数有误
+// @Failure 401 object model.Result 需要登录
+// @Failure 500 object model.Result 操作失败
+// @Router /api/order/{id}/pay [POST]
+func (h *OrderHandler) Pay(ctx *gin.Context) {
+	result := model.Result{}
+	idStr := ctx.Param("id")
+	if idStr == "" {
+		result.Code = http.StatusBadRequest
+		result.Message = code.RequestParamErr.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	claims, _ := request.GetCurrentCustomClaims(ctx)
+	vo, e := h.orderService.PayOrder(int(claims.UserId), idStr)
+	if e != nil {
+		result.Message = e.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	result.Data = vo
+	response.Success(ctx, result)
+	return
+}
+
+// PaymentNotify go doc
+// @Summary 支付回调
+// @Description 支付网关异步通知支付结果，需要携带签名
+// @Tags 订单管理
+// @version 1.0
+// @Accept json
+// @Produce  json
+// @Param notify body payment.Notify true "支付回调参数"
+// @Success 200 object model.Result 成功后返回值
+// @Failure 400 object model.Result 请求参数有误
+// @Failure 500 object model.Result 操作失败
+// @Router /api/payment/notify [POST]
+func (h *OrderHandler) PaymentNotify(ctx *gin.Context) {
+	var (
+		result model.Result
+		notify payment.Notify
+	)
+	// 数据绑定
+	if e := ctx.BindJSON(&notify); e != nil {
+		result.Message = e.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	if e := h.orderService.PaymentNotify(notify); e != nil {
+		result.Message = e.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	response.Success(ctx, result)
+	return
+}
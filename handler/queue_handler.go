@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"seckill/infra/utils/response"
+	"seckill/model"
+	"seckill/mq"
+)
+
+type QueueHandler struct {
+	consumers *mq.Consumers
+}
+
+// NewQueueHandler 创建一个 QueueHandler 实例
+func NewQueueHandler(consumers *mq.Consumers) *QueueHandler {
+	return &QueueHandler{
+		consumers: consumers,
+	}
+}
+
+// WorkerStats go doc
+// @Summary 订单消费者运行统计
+// @Description 查询各个订单消费者处理的批次数、消息数、成功数、失败数与重试数
+// @Tags 队列管理
+// @version 1.0
+// @Accept json
+// @Produce  json
+// @Success 200 object model.Result 成功后返回值
+// @Failure 401 object model.Result 需要登录
+// @Failure 403 object model.Result 没有操作权限
+// @Router /api/admin/queue/stats [GET]
+func (h *QueueHandler) WorkerStats(ctx *gin.Context) {
+	result := model.Result{}
+	result.Data = h.consumers.WorkerStats()
+	response.Success(ctx, result)
+}
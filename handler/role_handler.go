@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"seckill/infra/code"
+	"seckill/infra/utils/response"
+	"seckill/model"
+	"seckill/service"
+	"strconv"
+)
+
+type RoleHandler struct {
+	roleService service.IRoleService
+}
+
+// NewRoleHandler 创建一个 RoleHandler 实例
+func NewRoleHandler(roleService service.IRoleService) *RoleHandler {
+	return &RoleHandler{
+		roleService: roleService,
+	}
+}
+
+// QueryUserRoles go doc
+// @Summary 查询用户角色
+// @Description 查询用户拥有的角色以及这些角色包含的权限
+// @Tags 角色管理
+// @version 1.0
+// @Accept json
+// @Produce  json
+// @Param id path int true "id" "用户id"
+// @Success 200 object model.Result 成功后返回值
+// @Failure 400 object model.Result 请求参数有误
+// @Failure 401 object model.Result 需要登录
+// @Failure 403 object model.Result 没有操作权限
+// @Failure 500 object model.Result 操作失败
+// @Router /api/admin/users/{id}/roles [GET]
+func (h *RoleHandler) QueryUserRoles(ctx *gin.Context) {
+	result := model.Result{}
+	userId, ok := parseUserId(ctx)
+	if !ok {
+		return
+	}
+	vo, e := h.roleService.FindUserRoleVO(userId)
+	if e != nil {
+		result.Code = roleErrStatus(e)
+		result.Message = e.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	result.Data = vo
+	response.Success(ctx, result)
+	return
+}
+
+// Grant go doc
+// @Summary 授予用户角色
+// @Description 授予用户角色，可选角色：customer、seller、operator、admin
+// @Tags 角色管理
+// @version 1.0
+// @Accept json
+// @Produce  json
+// @Param id path int true "id" "用户id"
+// @Param role body model.RoleDTO true "角色"
+// @Success 200 object model.Result 成功后返回值
+// @Failure 400 object model.Result 请求参数有误
+// @Failure 401 object model.Result 需要登录
+// @Failure 403 object model.Result 没有操作权限
+// @Failure 500 object model.Result 操作失败
+// @Router /api/admin/users/{id}/roles [POST]
+func (h *RoleHandler) Grant(ctx *gin.Context) {
+	result := model.Result{}
+	userId, ok := parseUserId(ctx)
+	if !ok {
+		return
+	}
+	dto := model.RoleDTO{}
+	// 数据绑定
+	if e := ctx.BindJSON(&dto); e != nil {
+		result.Message = e.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	if e := h.roleService.Grant(userId, dto.Role); e != nil {
+		result.Code = roleErrStatus(e)
+		result.Message = e.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	response.Success(ctx, result)
+	return
+}
+
+// Revoke go doc
+// @Summary 撤销用户角色
+// @Description 撤销用户角色，不能撤销最后一个管理员
+// @Tags 角色管理
+// @version 1.0
+// @Accept json
+// @Produce  json
+// @Param id path int true "id" "用户id"
+// @Param role path string true "role" "角色"
+// @Success 200 object model.Result 成功后返回值
+// @Failure 400 object model.Result 请求参数有误
+// @Failure 401 object model.Result 需要登录
+// @Failure 403 object model.Result 没有操作权限
+// @Failure 500 object model.Result 操作失败
+// @Router /api/admin/users/{id}/roles/{role} [DELETE]
+func (h *RoleHandler) Revoke(ctx *gin.Context) {
+	result := model.Result{}
+	userId, ok := parseUserId(ctx)
+	if !ok {
+		return
+	}
+	if e := h.roleService.Revoke(userId, ctx.Param("role")); e != nil {
+		result.Code = roleErrStatus(e)
+		result.Message = e.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	response.Success(ctx, result)
+	return
+}
+
+// 解析路径中的用户 id
+func parseUserId(ctx *gin.Context) (uint, bool) {
+	id, e := strconv.Atoi(ctx.Param("id"))
+	if e != nil || id <= 0 {
+		result := model.Result{
+			Code:    http.StatusBadRequest,
+			Message: code.RequestParamErr.Error(),
+		}
+		response.Fail(ctx, result)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// 角色管理的业务错误返回 400，其余错误返回 500
+func roleErrStatus(e error) int {
+	switch e {
+	case code.RoleNotFoundErr, code.LastAdminRevokeErr, code.RecordNotFoundErr:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"seckill/infra/code"
+	"seckill/infra/utils/response"
+	"seckill/model"
+	"seckill/service"
+	"strconv"
+)
+
+type StockHandler struct {
+	stockService service.IStockService
+}
+
+// NewStockHandler 创建一个 StockHandler 实例
+func NewStockHandler(stockService service.IStockService) *StockHandler {
+	return &StockHandler{
+		stockService: stockService,
+	}
+}
+
+// Reconcile go doc
+// @Summary 库存对账
+// @Description 对账数据库与缓存中的商品库存，返回存在偏差的商品，dryRun 为 false 时修复偏差，缓存库存只会被调低
+// @Tags 库存管理
+// @version 1.0
+// @Accept json
+// @Produce  json
+// @Param dryRun query bool false "是否只报告偏差不做修复，默认为 true"
+// @Success 200 object model.Result 成功后返回值
+// @Failure 400 object model.Result 请求参数有误
+// @Failure 401 object model.Result 需要登录
+// @Failure 403 object model.Result 没有操作权限
+// @Failure 500 object model.Result 操作失败
+// @Router /api/admin/stock/reconcile [POST]
+func (h *StockHandler) Reconcile(ctx *gin.Context) {
+	result := model.Result{}
+	dryRun, e := strconv.ParseBool(ctx.DefaultQuery("dryRun", "true"))
+	if e != nil {
+		result.Code = http.StatusBadRequest
+		result.Message = code.RequestParamErr.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	list, e := h.stockService.Reconcile(dryRun)
+	if e != nil {
+		result.Code = http.StatusInternalServerError
+		result.Message = e.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	result.Data = list
+	response.Success(ctx, result)
+	return
+}
@@ -3,6 +3,9 @@ package handler
 import (
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"seckill/infra/code"
+	"seckill/infra/secret"
+	"seckill/infra/utils/request"
 	"seckill/infra/utils/response"
 	"seckill/model"
 	"seckill/service"
@@ -13,9 +16,9 @@ type UserHandler struct {
 }
 
 // NewUserHandler 创建一个 UserHandler 实例
-func NewUserHandler() *UserHandler {
+func NewUserHandler(userService service.IUserService) *UserHandler {
 	return &UserHandler{
-		userService: service.UserService,
+		userService: userService,
 	}
 }
 
@@ -41,7 +44,9 @@ func (h *UserHandler) Register(ctx *gin.Context) {
 		return
 	}
 	if e := h.userService.Register(registerUser); e != nil {
-		result.Code = http.StatusInternalServerError
+		if !secret.IsPasswordPolicyErr(e) {
+			result.Code = http.StatusInternalServerError
+		}
 		result.Message = e.Error()
 		response.Fail(ctx, result)
 		return
@@ -81,31 +86,103 @@ func (h *UserHandler) Login(ctx *gin.Context) {
 		return
 	}
 	result.Message = "登录成功"
-	result.Data = map[string]interface{}{
-		"token":token,
+	result.Data = token
+	result.Code = http.StatusOK
+	ctx.Header("Authorization", token.Token)
+	response.Success(ctx, result)
+	return
+}
+
+// RefreshToken go doc
+// @Summary 刷新令牌
+// @Description 使用刷新令牌换取新的访问令牌与刷新令牌，刷新令牌只能使用一次
+// @Tags 用户管理
+// @version 1.0
+// @Accept json
+// @Produce  json
+// @Param refreshToken body model.RefreshTokenDTO true "刷新令牌"
+// @Success 200 object model.Result 刷新成功
+// @Failure 400 object model.Result 请求参数有误
+// @Failure 401 object model.Result 刷新令牌无效、已过期或已被使用
+// @Failure 500 object model.Result 刷新失败
+// @Router /api/user/token/refresh [post]
+func (h *UserHandler) RefreshToken(ctx *gin.Context) {
+	dto := model.RefreshTokenDTO{}
+	result := model.Result{}
+	// 数据绑定
+	if e := ctx.BindJSON(&dto); e != nil {
+		result.Message = e.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	token, e := h.userService.RefreshToken(dto.RefreshToken)
+	if e != nil {
+		result.Code = http.StatusInternalServerError
+		if e == code.RefreshTokenInvalidErr || e == code.RefreshTokenReusedErr {
+			result.Code = http.StatusUnauthorized
+		}
+		result.Message = e.Error()
+		response.Fail(ctx, result)
+		return
 	}
+	result.Message = "刷新成功"
+	result.Data = token
 	result.Code = http.StatusOK
-	ctx.Header("Authorization", token)
+	ctx.Header("Authorization", token.Token)
 	response.Success(ctx, result)
 	return
 }
 
 // Logout go doc
 // @Summary 退出登录
-// @Description 用户退出登录，清除登录 token
+// @Description 用户退出登录，吊销当前登录 token
 // @Tags 用户管理
 // @version 1.0
 // @Accept json
 // @Produce  json
-// @Success 200 object model.Result 登录成功
+// @Success 200 object model.Result 退出成功
+// @Failure 401 object model.Result 需要登录
+// @Failure 500 object model.Result 退出失败
 // @Router /api/user/logout [post]
 func (h *UserHandler) Logout(ctx *gin.Context) {
-	auth := ctx.Request.Header.Get("Authorization")
-	h.userService.Logout(auth)
 	result := model.Result{}
+	claims, _ := request.GetCurrentCustomClaims(ctx)
+	if e := h.userService.Logout(claims); e != nil {
+		result.Code = http.StatusInternalServerError
+		result.Message = e.Error()
+		response.Fail(ctx, result)
+		return
+	}
 	result.Code = http.StatusOK
 	result.Message = "退出成功"
 	ctx.Header("Authorization", "")
 	response.Success(ctx, result)
 	return
+}
+
+// LogoutAll go doc
+// @Summary 退出所有登录
+// @Description 用户退出所有设备上的登录，吊销已签发的全部 token
+// @Tags 用户管理
+// @version 1.0
+// @Accept json
+// @Produce  json
+// @Success 200 object model.Result 退出成功
+// @Failure 401 object model.Result 需要登录
+// @Failure 500 object model.Result 退出失败
+// @Router /api/user/logout/all [post]
+func (h *UserHandler) LogoutAll(ctx *gin.Context) {
+	result := model.Result{}
+	claims, _ := request.GetCurrentCustomClaims(ctx)
+	if e := h.userService.LogoutAll(claims.UserId); e != nil {
+		result.Code = http.StatusInternalServerError
+		result.Message = e.Error()
+		response.Fail(ctx, result)
+		return
+	}
+	result.Code = http.StatusOK
+	result.Message = "已退出所有登录"
+	ctx.Header("Authorization", "")
+	response.Success(ctx, result)
+	return
 }
\ No newline at end of file
@@ -3,24 +3,22 @@ package cache
 import (
 	"context"
 	"github.com/go-redis/redis/v8"
-	"log"
 	"seckill/conf"
 	"time"
 )
 
-var (
-	Client *redis.Client
-)
-
-func init() {
-	c := conf.Config.Redis
-	ctx, _ := context.WithTimeout(context.Background(), 3*time.Second)
-	Client = redis.NewClient(&redis.Options{
+// Open 创建 redis 连接，并检查 redis 是否可用
+func Open(c conf.Redis) (*redis.Client, error) {
+	client := redis.NewClient(&redis.Options{
 		Addr:     c.Host,
 		Password: c.Password,
 		DB:       0,
 	})
-	if err := Client.Ping(ctx).Err(); err != nil {
-		log.Fatal(err)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, err
 	}
-}
\ No newline at end of file
+	return client, nil
+}
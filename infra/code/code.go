@@ -6,6 +6,8 @@ var (
 	RedisErr          = buildCode(5001, "系统错误02")
 	ConvertErr        = buildCode(5010, "对象转换错误")
 	RequestParamErr   = buildCode(5011, "请求参数错误")
+	PageParamErr      = buildCode(5012, "分页参数错误")
+	SortParamErr      = buildCode(5013, "排序参数错误")
 	TooManyRequests   = buildCode(5040, "请求频繁")
 	SysBusyErr        = buildCode(5041, "系统正忙")
 	RecordNotFoundErr = buildCode(5044, "数据不存在或已被删除")
@@ -20,11 +22,26 @@ var (
 	TokenMalformedErr   = buildCode(5104, "非法令牌")
 	TokenInvalidErr     = buildCode(5105, "无效令牌")
 	StatusForbiddenErr  = buildCode(51006, "没有操作权限")
+	TokenRevokedErr     = buildCode(5106, "登录已失效，请重新登录")
+	RefreshTokenInvalidErr = buildCode(5107, "刷新令牌无效或已过期")
+	RefreshTokenReusedErr  = buildCode(5108, "刷新令牌已被使用，请重新登录")
+	RiskRejectErr       = buildCode(5110, "账号存在异常行为，请稍后再试")
+
+	PasswordTooShortErr         = buildCode(5120, "密码长度不足")
+	PasswordTooLongErr          = buildCode(5121, "密码长度不能超过 72 个字节，一个中文字符占 3 个字节")
+	PasswordTooWeakErr          = buildCode(5122, "密码必须同时包含字母与数字")
+	PasswordContainsUsernameErr = buildCode(5123, "密码不能包含用户名")
+
+	RoleNotFoundErr    = buildCode(5130, "角色不存在")
+	LastAdminRevokeErr = buildCode(5131, "不能撤销最后一个管理员")
 
 	// 与商品相关的错误，范围：[5200,5300)
 	GoodsSaleOut    = buildCode(5200, "商品已售罄")
 	SeckillNotStart = buildCode(5211, "秒杀还未开始")
 	SeckillEnded    = buildCode(5222, "秒杀已结束")
+	StockNotEnough  = buildCode(5230, "商品库存不足")
+	PurchaseLimitErr = buildCode(5240, "超出每人限购数量")
+	SeckillNotReady  = buildCode(5250, "秒杀商品准备中，请稍后再试")
 
 	// 与订单相关的错误，范围：[5300,5400)
 	OrderNotFoundErr  = buildCode(5300, "订单不存在")
@@ -32,4 +49,15 @@ var (
 	OrderCloseErr     = buildCode(5320, "订单取消失败")
 	RepeateSeckillErr = buildCode(5330, "请勿重复秒杀")
 	SeckillFailedErr  = buildCode(5340, "秒杀失败")
+	OrderRefundErr    = buildCode(5350, "退款失败")
+	SeckillPathErr    = buildCode(5360, "秒杀地址无效或已过期")
+	CaptchaErr        = buildCode(5370, "验证码错误或已过期")
+	OrderExistedErr   = buildCode(5380, "订单已存在")
+
+	// 与支付相关的错误，范围：[5400,5500)
+	PaymentNotFoundErr = buildCode(5400, "支付记录不存在")
+	PaymentSignErr     = buildCode(5410, "支付回调签名错误")
+	PaymentAmountErr   = buildCode(5411, "支付金额不一致")
+	PaymentNotifyExpiredErr = buildCode(5412, "支付回调已过期")
+	PaymentGatewayErr  = buildCode(5420, "支付网关不可用")
 )
@@ -1,23 +1,25 @@
 package db
 
 import (
+	"errors"
 	"fmt"
+	"github.com/go-sql-driver/mysql"
 	"github.com/jinzhu/gorm"
-	"log"
 	"seckill/conf"
 )
 
-var (
-	// DB 数据源连接变量
-	DB *gorm.DB
-)
+// mysql 唯一索引冲突的错误码
+const duplicateEntryErrNumber = 1062
 
-func init() {
+// Open 创建数据源连接
+func Open(c conf.Datasource) (*gorm.DB, error) {
 	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8&parseTime=true&loc=Local",
-		conf.Config.Username, conf.Config.Datasource.Password, conf.Config.Datasource.Host, conf.Config.Datasource.BaseName)
-	var err error
-	DB, err = gorm.Open(conf.Config.DriverName, dsn)
-	if err != nil {
-		log.Panicln("数据源连接错误：", err.Error())
-	}
+		c.Username, c.Password, c.Host, c.BaseName)
+	return gorm.Open(c.DriverName, dsn)
+}
+
+// IsDuplicateKey 判断错误是否为唯一索引冲突
+func IsDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == duplicateEntryErrNumber
 }
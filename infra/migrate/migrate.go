@@ -0,0 +1,263 @@
+package migrate
+
+import (
+	"embed"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 迁移文件命名规则：<版本号>_<名称>.up.sql 与 <版本号>_<名称>.down.sql
+//
+//go:embed sql/*.sql
+var files embed.FS
+
+const (
+	// 记录已执行迁移的表
+	createSchemaMigrations = "CREATE TABLE IF NOT EXISTS `schema_migrations` (" +
+		"`version` bigint NOT NULL, " +
+		"`name` varchar(100) NOT NULL, " +
+		"`applied_at` datetime NOT NULL, " +
+		"PRIMARY KEY (`version`)" +
+		") ENGINE = InnoDB DEFAULT CHARSET = utf8"
+)
+
+// Migration 一个版本的迁移
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status 迁移的执行状态
+type Status struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+// Migrator 按版本号顺序执行迁移，并在 schema_migrations 表中记录已执行的版本
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// New 创建 Migrator，装载内嵌的迁移文件
+func New(db *gorm.DB) (*Migrator, error) {
+	migrations, e := load()
+	if e != nil {
+		return nil, e
+	}
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+// Up 按版本号从小到大执行所有未执行的迁移，返回本次执行的迁移
+func (m *Migrator) Up() (applied []Migration, e error) {
+	done, e := m.applied()
+	if e != nil {
+		return nil, e
+	}
+	for _, mig := range m.migrations {
+		if _, ok := done[mig.Version]; ok {
+			continue
+		}
+		log.Printf("正在执行迁移 %04d_%s", mig.Version, mig.Name)
+		if e = m.exec(mig.Up); e != nil {
+			return applied, fmt.Errorf("migration %04d_%s up: %v", mig.Version, mig.Name, e)
+		}
+		if e = m.db.Exec("INSERT INTO `schema_migrations` (`version`, `name`, `applied_at`) VALUES (?, ?, ?)",
+			mig.Version, mig.Name, time.Now()).Error; e != nil {
+			return applied, e
+		}
+		applied = append(applied, mig)
+	}
+	return applied, nil
+}
+
+// Down 回滚最近执行的一个迁移，没有可回滚的迁移时返回 nil
+func (m *Migrator) Down() (*Migration, error) {
+	done, e := m.applied()
+	if e != nil {
+		return nil, e
+	}
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		mig := m.migrations[i]
+		if _, ok := done[mig.Version]; !ok {
+			continue
+		}
+		log.Printf("正在回滚迁移 %04d_%s", mig.Version, mig.Name)
+		if e = m.exec(mig.Down); e != nil {
+			return nil, fmt.Errorf("migration %04d_%s down: %v", mig.Version, mig.Name, e)
+		}
+		if e = m.db.Exec("DELETE FROM `schema_migrations` WHERE `version` = ?", mig.Version).Error; e != nil {
+			return nil, e
+		}
+		return &mig, nil
+	}
+	return nil, nil
+}
+
+// Status 返回所有迁移的执行状态，未执行的迁移 AppliedAt 为 nil
+func (m *Migrator) Status() ([]Status, error) {
+	done, e := m.applied()
+	if e != nil {
+		return nil, e
+	}
+	status := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if t, ok := done[mig.Version]; ok {
+			s.AppliedAt = &t
+		}
+		status = append(status, s)
+	}
+	return status, nil
+}
+
+// 查询已执行的迁移版本及执行时间
+func (m *Migrator) applied() (map[int64]time.Time, error) {
+	if e := m.db.Exec(createSchemaMigrations).Error; e != nil {
+		return nil, e
+	}
+	rows, e := m.db.Raw("SELECT `version`, `applied_at` FROM `schema_migrations`").Rows()
+	if e != nil {
+		return nil, e
+	}
+	defer rows.Close()
+	done := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+		if e = rows.Scan(&version, &appliedAt); e != nil {
+			return nil, e
+		}
+		done[version] = appliedAt
+	}
+	return done, rows.Err()
+}
+
+// 逐条执行迁移文件中的语句，mysql 的 DDL 会隐式提交，因此不在事务中执行
+func (m *Migrator) exec(script string) error {
+	for _, stmt := range splitStatements(script) {
+		if e := m.db.Exec(stmt).Error; e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// 按分号把脚本拆分为多条语句，并去掉注释
+// 引号中的分号与注释不会被处理，支持 -- 行注释与 /* */ 块注释，不支持 DELIMITER 自定义分隔符
+func splitStatements(script string) (list []string) {
+	var (
+		b     strings.Builder
+		quote rune
+	)
+	runes := []rune(script)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			b.WriteRune(r)
+			if r == '\\' && quote != '`' && i+1 < len(runes) {
+				i++
+				b.WriteRune(runes[i])
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+			b.WriteRune(r)
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			// 行注释，跳到行尾
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			b.WriteRune('\n')
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			// 块注释，跳到注释结束
+			for i += 3; i < len(runes) && !(runes[i-1] == '*' && runes[i] == '/'); i++ {
+			}
+			b.WriteRune(' ')
+		case r == ';':
+			if stmt := strings.TrimSpace(b.String()); stmt != "" {
+				list = append(list, stmt)
+			}
+			b.Reset()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if stmt := strings.TrimSpace(b.String()); stmt != "" {
+		list = append(list, stmt)
+	}
+	return
+}
+
+// 装载内嵌的迁移文件，每个版本必须同时有 up 与 down 文件
+func load() ([]Migration, error) {
+	entries, e := files.ReadDir("sql")
+	if e != nil {
+		return nil, e
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		file := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(file, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(file, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s: unknown direction", file)
+		}
+		base := strings.TrimSuffix(file, "."+direction+".sql")
+		i := strings.Index(base, "_")
+		if i <= 0 {
+			return nil, fmt.Errorf("migration %s: missing version", file)
+		}
+		version, e := strconv.ParseInt(base[:i], 10, 64)
+		if e != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %v", file, e)
+		}
+		content, e := files.ReadFile(path.Join("sql", file))
+		if e != nil {
+			return nil, e
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: base[i+1:]}
+			byVersion[version] = mig
+		} else if mig.Name != base[i+1:] {
+			return nil, fmt.Errorf("migration %s: version %d already used by %s", file, version, mig.Name)
+		}
+		if direction == "up" {
+			mig.Up = string(content)
+		} else {
+			mig.Down = string(content)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s: both up and down files are required", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
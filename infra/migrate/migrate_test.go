@@ -0,0 +1,52 @@
+package migrate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"空脚本", " \n\t", nil},
+		{"多条语句", "CREATE TABLE a (id int);\nDROP TABLE b;", []string{"CREATE TABLE a (id int)", "DROP TABLE b"}},
+		{"最后一条语句没有分号", "SELECT 1;SELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"连续的分号", "SELECT 1;;\n;", []string{"SELECT 1"}},
+		{"行注释", "-- 注释; 不拆分\nSELECT 1; -- 行尾注释\nSELECT 2;", []string{"SELECT 1", "SELECT 2"}},
+		{"块注释", "/* 注释;\n跨行 */SELECT 1;SELECT /**/2;", []string{"SELECT 1", "SELECT  2"}},
+		{"引号中的分号与注释", "INSERT INTO a VALUES ('a;b', \"-- c\", '/* d */');",
+			[]string{"INSERT INTO a VALUES ('a;b', \"-- c\", '/* d */')"}},
+		{"引号中的转义", `INSERT INTO a VALUES ('it\'s;', 'x'); SELECT 1`,
+			[]string{`INSERT INTO a VALUES ('it\'s;', 'x')`, "SELECT 1"}},
+		{"反引号中的分号", "CREATE TABLE `a;b` (id int) COMMENT '表';", []string{"CREATE TABLE `a;b` (id int) COMMENT '表'"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.script); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitStatements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// 内嵌的迁移文件版本号从 1 开始连续递增，并且都能拆分出语句
+func TestLoad(t *testing.T) {
+	migrations, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("load() returned no migrations")
+	}
+	for i, mig := range migrations {
+		if mig.Version != int64(i+1) {
+			t.Errorf("migrations[%d].Version = %d, want %d", i, mig.Version, i+1)
+		}
+		if len(splitStatements(mig.Up)) == 0 || len(splitStatements(mig.Down)) == 0 {
+			t.Errorf("migration %04d_%s has an empty up or down script", mig.Version, mig.Name)
+		}
+	}
+}
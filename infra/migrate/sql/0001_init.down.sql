@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS `order_info`;
+DROP TABLE IF EXISTS `orders`;
+DROP TABLE IF EXISTS `goods`;
+DROP TABLE IF EXISTS `users`;
@@ -0,0 +1,74 @@
+-- 基线表结构，与引入迁移之前 CreateTable 创建的表结构一致，已存在的数据库执行时不做任何修改
+-- 之后新增的表与字段必须各自使用新的迁移添加，不能修改本文件
+
+-- 用户
+CREATE TABLE IF NOT EXISTS `users` (
+    `id`         int unsigned NOT NULL AUTO_INCREMENT,
+    `created_at` datetime     NULL COMMENT '创建时间',
+    `updated_at` datetime     NULL COMMENT '更新时间',
+    `deleted_at` datetime     NULL COMMENT '删除时间',
+    `username`   varchar(20)  NULL COMMENT '用户名',
+    `password`   varchar(32)  NULL COMMENT '用户密码',
+    `kind`       tinyint(1)   NULL COMMENT '用户类别（0-客户，1-商家）',
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `idx_users_username` (`username`),
+    INDEX `idx_users_deleted_at` (`deleted_at`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+-- 秒杀商品
+CREATE TABLE IF NOT EXISTS `goods` (
+    `id`           int unsigned   NOT NULL AUTO_INCREMENT,
+    `created_at`   datetime       NULL COMMENT '创建时间',
+    `updated_at`   datetime       NULL COMMENT '更新时间',
+    `deleted_at`   datetime       NULL COMMENT '删除时间',
+    `name`         varchar(50)    NULL COMMENT '商品名称',
+    `img`          varchar(255)   NULL COMMENT '商品图片url',
+    `origin_price` decimal(20, 2) NULL COMMENT '原价',
+    `price`        decimal(20, 2) NULL COMMENT '现价',
+    `amount`       int            NULL COMMENT '商品总量',
+    `stock`        int            NULL COMMENT '商品剩余数量',
+    `start_time`   datetime       NULL COMMENT '秒杀开始时间',
+    `end_time`     datetime       NULL COMMENT '秒杀结束时间',
+    `user_id`      int unsigned   NULL COMMENT '创建人',
+    PRIMARY KEY (`id`),
+    INDEX `idx_goods_deleted_at` (`deleted_at`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+-- 订单
+CREATE TABLE IF NOT EXISTS `orders` (
+    `id`         int unsigned NOT NULL AUTO_INCREMENT,
+    `created_at` datetime     NULL COMMENT '创建时间',
+    `updated_at` datetime     NULL COMMENT '更新时间',
+    `deleted_at` datetime     NULL COMMENT '删除时间',
+    `order_id`   varchar(25)  NULL COMMENT '订单id',
+    `user_id`    int          NULL COMMENT '下单用户id',
+    `goods_id`   int          NULL COMMENT '商品id',
+    PRIMARY KEY (`id`),
+    INDEX `idx_orders_order_id` (`order_id`),
+    INDEX `idx_orders_user_id` (`user_id`),
+    INDEX `idx_orders_goods_id` (`goods_id`),
+    INDEX `idx_orders_deleted_at` (`deleted_at`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+-- 订单信息
+CREATE TABLE IF NOT EXISTS `order_info` (
+    `id`          int unsigned   NOT NULL AUTO_INCREMENT,
+    `created_at`  datetime       NULL COMMENT '创建时间',
+    `updated_at`  datetime       NULL COMMENT '更新时间',
+    `deleted_at`  datetime       NULL COMMENT '删除时间',
+    `order_id`    varchar(25)    NULL COMMENT '订单id',
+    `user_id`     int            NULL COMMENT '下单用户id',
+    `goods_id`    int            NULL COMMENT '商品id',
+    `goods_name`  varchar(50)    NULL COMMENT '商品名称',
+    `goods_img`   varchar(255)   NULL COMMENT '商品图片url',
+    `goods_price` decimal(20, 2) NULL COMMENT '商品价格',
+    `payment_id`  int            NULL COMMENT '支付id',
+    `status`      tinyint(1)     NULL COMMENT '订单状态',
+    PRIMARY KEY (`id`),
+    INDEX `idx_order_info_order_id` (`order_id`),
+    INDEX `idx_order_info_user_id` (`user_id`),
+    INDEX `idx_order_info_goods_id` (`goods_id`),
+    INDEX `idx_order_info_payment_id` (`payment_id`),
+    INDEX `idx_order_info_status` (`status`),
+    INDEX `idx_order_info_deleted_at` (`deleted_at`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
@@ -0,0 +1,19 @@
+-- 支付流水
+CREATE TABLE IF NOT EXISTS `payments` (
+    `id`         int unsigned   NOT NULL AUTO_INCREMENT,
+    `created_at` datetime       NULL COMMENT '创建时间',
+    `updated_at` datetime       NULL COMMENT '更新时间',
+    `deleted_at` datetime       NULL COMMENT '删除时间',
+    `payment_no` varchar(25)    NULL COMMENT '支付流水号',
+    `order_id`   varchar(25)    NULL COMMENT '订单id',
+    `user_id`    int            NULL COMMENT '支付用户id',
+    `amount`     decimal(20, 2) NULL COMMENT '支付金额',
+    `gateway`    varchar(20)    NULL COMMENT '支付网关',
+    `trade_no`   varchar(64)    NULL COMMENT '支付网关交易号',
+    `refund_no`  varchar(64)    NULL COMMENT '支付网关退款交易号',
+    `status`     tinyint(1)     NULL COMMENT '支付状态',
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `idx_payments_payment_no` (`payment_no`),
+    INDEX `idx_payments_order_id` (`order_id`),
+    INDEX `idx_payments_deleted_at` (`deleted_at`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
@@ -0,0 +1,15 @@
+-- 订单状态流转记录
+CREATE TABLE IF NOT EXISTS `order_status_history` (
+    `id`          int unsigned NOT NULL AUTO_INCREMENT,
+    `created_at`  datetime     NULL COMMENT '创建时间',
+    `updated_at`  datetime     NULL COMMENT '更新时间',
+    `deleted_at`  datetime     NULL COMMENT '删除时间',
+    `order_id`    varchar(25)  NULL COMMENT '订单id',
+    `from_status` tinyint(1)   NULL COMMENT '原状态',
+    `to_status`   tinyint(1)   NULL COMMENT '新状态',
+    `operator`    varchar(32)  NULL COMMENT '操作人',
+    `remark`      varchar(255) NULL COMMENT '备注',
+    PRIMARY KEY (`id`),
+    INDEX `idx_order_status_history_order_id` (`order_id`),
+    INDEX `idx_order_status_history_deleted_at` (`deleted_at`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
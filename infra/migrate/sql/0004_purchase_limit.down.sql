@@ -0,0 +1,6 @@
+ALTER TABLE `order_info`
+    DROP COLUMN `total_price`,
+    DROP COLUMN `quantity`;
+
+ALTER TABLE `goods`
+    DROP COLUMN `limit_per_user`;
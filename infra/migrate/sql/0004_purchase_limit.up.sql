@@ -0,0 +1,10 @@
+-- 每人限购数量
+ALTER TABLE `goods`
+    ADD COLUMN `limit_per_user` int NULL DEFAULT 1 COMMENT '每人限购数量' AFTER `stock`;
+
+-- 购买数量与订单总价，历史订单都只购买了一件商品
+ALTER TABLE `order_info`
+    ADD COLUMN `quantity`    int            NULL DEFAULT 1 COMMENT '购买数量' AFTER `goods_price`,
+    ADD COLUMN `total_price` decimal(20, 2) NULL COMMENT '订单总价' AFTER `quantity`;
+
+UPDATE `order_info` SET `total_price` = `goods_price` * `quantity` WHERE `total_price` IS NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE `goods`
+    DROP COLUMN `need_captcha`;
@@ -0,0 +1,3 @@
+-- 秒杀前是否需要验证码
+ALTER TABLE `goods`
+    ADD COLUMN `need_captcha` boolean NULL DEFAULT false COMMENT '秒杀前是否需要验证码' AFTER `limit_per_user`;
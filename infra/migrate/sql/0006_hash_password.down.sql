@@ -0,0 +1,3 @@
+-- bcrypt 哈希值长度为 60，回滚前需要确认已经没有保存哈希值的用户，否则会被截断或执行失败
+ALTER TABLE `users`
+    MODIFY COLUMN `password` varchar(32) NULL COMMENT '用户密码';
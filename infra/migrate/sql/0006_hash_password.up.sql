@@ -0,0 +1,3 @@
+-- 密码改为保存 bcrypt 哈希值，历史遗留的明文密码在用户下次登录成功后重新计算
+ALTER TABLE `users`
+    MODIFY COLUMN `password` varchar(100) NULL COMMENT '用户密码（bcrypt 哈希值）';
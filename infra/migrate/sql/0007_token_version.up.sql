@@ -0,0 +1,3 @@
+-- 令牌版本号，退出所有登录时加 1，签发时间早于当前版本的令牌全部失效
+ALTER TABLE `users`
+    ADD COLUMN `token_version` bigint NOT NULL DEFAULT 0 COMMENT '令牌版本号';
@@ -0,0 +1,19 @@
+-- 刷新令牌
+CREATE TABLE IF NOT EXISTS `refresh_tokens` (
+    `id`         int unsigned NOT NULL AUTO_INCREMENT,
+    `created_at` datetime     NULL COMMENT '创建时间',
+    `updated_at` datetime     NULL COMMENT '更新时间',
+    `deleted_at` datetime     NULL COMMENT '删除时间',
+    `user_id`    int          NULL COMMENT '用户id',
+    `device_id`  varchar(64)  NULL COMMENT '设备id',
+    `family_id`  varchar(32)  NULL COMMENT '令牌族id',
+    `token_hash` char(64)     NULL COMMENT '令牌哈希值',
+    `expires_at` datetime     NULL COMMENT '过期时间',
+    `used_at`    datetime     NULL COMMENT '轮换时间',
+    `revoked_at` datetime     NULL COMMENT '吊销时间',
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `idx_refresh_tokens_token_hash` (`token_hash`),
+    INDEX `idx_refresh_tokens_user_id` (`user_id`),
+    INDEX `idx_refresh_tokens_family_id` (`family_id`),
+    INDEX `idx_refresh_tokens_deleted_at` (`deleted_at`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
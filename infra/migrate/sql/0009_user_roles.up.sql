@@ -0,0 +1,16 @@
+-- 用户角色
+CREATE TABLE IF NOT EXISTS `user_roles` (
+    `id`         int unsigned NOT NULL AUTO_INCREMENT,
+    `created_at` datetime     NULL COMMENT '授予时间',
+    `user_id`    int          NULL COMMENT '用户id',
+    `role`       varchar(20)  NULL COMMENT '角色',
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `idx_user_roles_user_id_role` (`user_id`, `role`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8;
+
+-- 根据用户类别初始化角色：所有用户都是顾客，商家额外拥有商家角色
+INSERT IGNORE INTO `user_roles` (`created_at`, `user_id`, `role`)
+SELECT NOW(), `id`, 'customer' FROM `users` WHERE `deleted_at` IS NULL;
+
+INSERT IGNORE INTO `user_roles` (`created_at`, `user_id`, `role`)
+SELECT NOW(), `id`, 'seller' FROM `users` WHERE `deleted_at` IS NULL AND `kind` = 1;
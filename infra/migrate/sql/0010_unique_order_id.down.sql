@@ -0,0 +1,7 @@
+ALTER TABLE `orders`
+    DROP INDEX `idx_orders_order_id`,
+    ADD INDEX `idx_orders_order_id` (`order_id`);
+
+ALTER TABLE `order_info`
+    DROP INDEX `idx_order_info_order_id`,
+    ADD INDEX `idx_order_info_order_id` (`order_id`);
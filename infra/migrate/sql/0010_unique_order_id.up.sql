@@ -0,0 +1,8 @@
+-- 订单编号唯一，消息被重复投递并由多个消费者同时处理时，只有一个消费者能创建订单
+ALTER TABLE `orders`
+    DROP INDEX `idx_orders_order_id`,
+    ADD UNIQUE INDEX `idx_orders_order_id` (`order_id`);
+
+ALTER TABLE `order_info`
+    DROP INDEX `idx_order_info_order_id`,
+    ADD UNIQUE INDEX `idx_order_info_order_id` (`order_id`);
@@ -0,0 +1,44 @@
+package secret
+
+import (
+	"crypto/ed25519"
+	"github.com/dgrijalva/jwt-go"
+	"sync"
+)
+
+// SigningMethodEdDSA 使用 Ed25519 签名的 EdDSA 算法，jwt-go v3 没有内置该算法
+var SigningMethodEdDSA = &signingMethodEdDSA{}
+
+// 保证 EdDSA 算法只注册一次
+var registerEdDSA sync.Once
+
+type signingMethodEdDSA struct{}
+
+func (m *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+// Verify 校验签名，key 必须是 ed25519.PublicKey
+func (m *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok || len(publicKey) != ed25519.PublicKeySize {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
+
+// Sign 计算签名，key 必须是 ed25519.PrivateKey
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok || len(privateKey) != ed25519.PrivateKeySize {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(privateKey, []byte(signingString))), nil
+}
@@ -0,0 +1,244 @@
+package secret
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"seckill/conf"
+	"sort"
+	"strings"
+)
+
+const (
+	// HS256 使用共享密钥签名，只能由 seckill 自己校验，不会发布到 JWKS 中
+	HS256 = "HS256"
+	// RS256 使用 RSA 私钥签名
+	RS256 = "RS256"
+	// EdDSA 使用 Ed25519 私钥签名
+	EdDSA = "EdDSA"
+)
+
+// Key 签名密钥
+type Key struct {
+	Kid    string
+	Method jwt.SigningMethod
+	// 签名使用的密钥，只用于校验的密钥为空
+	signKey interface{}
+	// 校验使用的密钥
+	verifyKey interface{}
+}
+
+// KeySet 密钥集合，使用 signing 签发令牌，使用集合中的任意一个密钥校验令牌，
+// 轮换密钥时先把新密钥加入集合，再切换签发密钥，旧令牌全部过期后再移除旧密钥
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// JWK JSON Web Key，只包含公钥信息
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA 公钥
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 公钥
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LoadKeySet 从配置中装载密钥
+func LoadKeySet(c conf.Jwt) (*KeySet, error) {
+	if len(c.Keys) == 0 {
+		return nil, errors.New("jwt: no signing keys configured")
+	}
+	ks := &KeySet{keys: make(map[string]*Key, len(c.Keys))}
+	for _, kc := range c.Keys {
+		if _, ok := ks.keys[kc.Kid]; ok {
+			return nil, fmt.Errorf("jwt: duplicate kid %q", kc.Kid)
+		}
+		k, err := loadKey(kc)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: key %q: %v", kc.Kid, err)
+		}
+		ks.keys[k.Kid] = k
+	}
+	signingKid := c.SigningKid
+	if signingKid == "" && len(c.Keys) == 1 {
+		signingKid = c.Keys[0].Kid
+	}
+	signing, ok := ks.keys[signingKid]
+	if !ok {
+		return nil, fmt.Errorf("jwt: signing key %q not found", signingKid)
+	}
+	if signing.signKey == nil {
+		return nil, fmt.Errorf("jwt: signing key %q has no private key", signingKid)
+	}
+	ks.signing = signing
+	return ks, nil
+}
+
+// Signing 获取签发令牌使用的密钥
+func (ks *KeySet) Signing() *Key {
+	return ks.signing
+}
+
+// Lookup 通过 kid 查找校验密钥，kid 为空的历史令牌使用签发密钥校验
+func (ks *KeySet) Lookup(kid string) (*Key, bool) {
+	if kid == "" {
+		return ks.signing, true
+	}
+	k, ok := ks.keys[kid]
+	return k, ok
+}
+
+// JWKS 获取所有非对称密钥的公钥，供其他服务校验 seckill 签发的令牌
+func (ks *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: make([]JWK, 0, len(ks.keys))}
+	for _, k := range ks.keys {
+		jwk := JWK{Kid: k.Kid, Use: "sig", Alg: k.Method.Alg()}
+		switch key := k.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(key)
+		default:
+			// 对称密钥不能公开
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].Kid < jwks.Keys[j].Kid
+	})
+	return jwks
+}
+
+// 装载单个密钥，HS256 密钥从环境变量或文件中读取，非对称密钥从 PEM 文件中读取
+func loadKey(c conf.JwtKey) (*Key, error) {
+	if c.Kid == "" {
+		return nil, errors.New("kid is required")
+	}
+	k := &Key{Kid: c.Kid}
+	switch c.Algorithm {
+	case HS256, "":
+		secret, err := LoadSecret(c.SecretEnv, c.SecretFile)
+		if err != nil {
+			return nil, err
+		}
+		k.Method = jwt.SigningMethodHS256
+		k.signKey = []byte(secret)
+		k.verifyKey = k.signKey
+	case RS256:
+		k.Method = jwt.SigningMethodRS256
+		if c.PrivateKeyFile != "" {
+			data, err := ioutil.ReadFile(c.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+			if err != nil {
+				return nil, err
+			}
+			k.signKey = privateKey
+			k.verifyKey = &privateKey.PublicKey
+		}
+		if c.PublicKeyFile != "" {
+			data, err := ioutil.ReadFile(c.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			if k.verifyKey, err = jwt.ParseRSAPublicKeyFromPEM(data); err != nil {
+				return nil, err
+			}
+		}
+	case EdDSA:
+		k.Method = SigningMethodEdDSA
+		if c.PrivateKeyFile != "" {
+			key, err := parsePEM(c.PrivateKeyFile, x509.ParsePKCS8PrivateKey)
+			if err != nil {
+				return nil, err
+			}
+			privateKey, ok := key.(ed25519.PrivateKey)
+			if !ok {
+				return nil, errors.New("private key is not an Ed25519 key")
+			}
+			k.signKey = privateKey
+			k.verifyKey = privateKey.Public()
+		}
+		if c.PublicKeyFile != "" {
+			key, err := parsePEM(c.PublicKeyFile, x509.ParsePKIXPublicKey)
+			if err != nil {
+				return nil, err
+			}
+			publicKey, ok := key.(ed25519.PublicKey)
+			if !ok {
+				return nil, errors.New("public key is not an Ed25519 key")
+			}
+			k.verifyKey = publicKey
+		}
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", c.Algorithm)
+	}
+	if k.verifyKey == nil {
+		return nil, errors.New("private_key_file or public_key_file is required")
+	}
+	return k, nil
+}
+
+// 读取 PEM 文件并使用 parse 解析其中的密钥
+func parsePEM(file string, parse func([]byte) (interface{}, error)) (interface{}, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: invalid PEM", file)
+	}
+	return parse(block.Bytes)
+}
+
+// LoadSecret 读取共享密钥，配置了环境变量 env 时只从环境变量中读取，否则从文件 file 中读取，
+// 环境变量或文件为空时返回错误，拒绝启动
+func LoadSecret(env string, file string) (string, error) {
+	switch {
+	case env != "":
+		secret := os.Getenv(env)
+		if secret == "" {
+			return "", fmt.Errorf("environment variable %s is empty", env)
+		}
+		return secret, nil
+	case file != "":
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		secret := strings.TrimSpace(string(data))
+		if secret == "" {
+			return "", fmt.Errorf("secret file %s is empty", file)
+		}
+		return secret, nil
+	default:
+		return "", errors.New("secret_env or secret_file is required")
+	}
+}
@@ -0,0 +1,244 @@
+package secret
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/dgrijalva/jwt-go"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"seckill/conf"
+	"seckill/infra/code"
+	"testing"
+	"time"
+)
+
+// 在 dir 中生成测试使用的 PEM 密钥文件，返回私钥与公钥文件路径
+func writeKeyPair(t *testing.T, dir, name string, private, public interface{}) (string, string) {
+	t.Helper()
+	privateDer, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDer, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateFile := filepath.Join(dir, name+".pem")
+	publicFile := filepath.Join(dir, name+".pub.pem")
+	if err := ioutil.WriteFile(privateFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(publicFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDer}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return privateFile, publicFile
+}
+
+// 生成一组 HS256、RS256、EdDSA 测试密钥配置
+func testKeys(t *testing.T) (hs, rs, rsPublic, ed conf.JwtKey) {
+	t.Helper()
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "hs.secret")
+	if err := ioutil.WriteFile(secretFile, []byte("test secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsPrivateFile, rsPublicFile := writeKeyPair(t, dir, "rs", rsaKey, &rsaKey.PublicKey)
+	edPrivateFile, _ := writeKeyPair(t, dir, "ed", edPrivate, edPublic)
+	hs = conf.JwtKey{Kid: "hs-1", Algorithm: HS256, SecretFile: secretFile}
+	rs = conf.JwtKey{Kid: "rs-1", Algorithm: RS256, PrivateKeyFile: rsPrivateFile}
+	rsPublic = conf.JwtKey{Kid: "rs-1", Algorithm: RS256, PublicKeyFile: rsPublicFile}
+	ed = conf.JwtKey{Kid: "ed-1", Algorithm: EdDSA, PrivateKeyFile: edPrivateFile}
+	return
+}
+
+func TestLoadKeySet(t *testing.T) {
+	hs, rs, rsPublic, ed := testKeys(t)
+	tests := []struct {
+		name    string
+		conf    conf.Jwt
+		signing string
+		wantErr bool
+	}{
+		{"只有一个密钥时可以不配置签发 kid", conf.Jwt{Keys: []conf.JwtKey{hs}}, "hs-1", false},
+		{"指定签发 kid", conf.Jwt{SigningKid: "ed-1", Keys: []conf.JwtKey{hs, rs, ed}}, "ed-1", false},
+		{"没有配置密钥", conf.Jwt{}, "", true},
+		{"多个密钥时必须配置签发 kid", conf.Jwt{Keys: []conf.JwtKey{hs, ed}}, "", true},
+		{"重复的 kid", conf.Jwt{SigningKid: "rs-1", Keys: []conf.JwtKey{rs, rsPublic}}, "", true},
+		{"签发 kid 不存在", conf.Jwt{SigningKid: "rs-2", Keys: []conf.JwtKey{rs}}, "", true},
+		{"签发密钥没有私钥", conf.Jwt{Keys: []conf.JwtKey{rsPublic}}, "", true},
+		{"缺少 kid", conf.Jwt{Keys: []conf.JwtKey{{Algorithm: HS256, SecretFile: hs.SecretFile}}}, "", true},
+		{"不支持的算法", conf.Jwt{Keys: []conf.JwtKey{{Kid: "es-1", Algorithm: "ES256"}}}, "", true},
+		{"非对称密钥缺少密钥文件", conf.Jwt{Keys: []conf.JwtKey{{Kid: "rs-2", Algorithm: RS256}}}, "", true},
+		{"共享密钥缺少来源", conf.Jwt{Keys: []conf.JwtKey{{Kid: "hs-2"}}}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks, err := LoadKeySet(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadKeySet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && ks.Signing().Kid != tt.signing {
+				t.Errorf("Signing().Kid = %q, want %q", ks.Signing().Kid, tt.signing)
+			}
+		})
+	}
+}
+
+// 设置环境变量，测试结束后恢复
+func setenv(t *testing.T, key, value string) {
+	t.Helper()
+	old, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestLoadSecret(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "secret")
+	empty := filepath.Join(dir, "empty")
+	if err := ioutil.WriteFile(file, []byte(" file secret \n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(empty, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	setenv(t, "SECKILL_TEST_SECRET", "env secret")
+	setenv(t, "SECKILL_TEST_EMPTY", "")
+	tests := []struct {
+		name    string
+		env     string
+		file    string
+		want    string
+		wantErr bool
+	}{
+		{"从环境变量读取", "SECKILL_TEST_SECRET", "", "env secret", false},
+		{"环境变量优先", "SECKILL_TEST_SECRET", file, "env secret", false},
+		{"从文件读取并去除空白", "", file, "file secret", false},
+		{"环境变量为空时不回退到文件", "SECKILL_TEST_EMPTY", file, "", true},
+		{"文件为空", "", empty, "", true},
+		{"文件不存在", "", filepath.Join(dir, "missing"), "", true},
+		{"没有配置来源", "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadSecret(tt.env, tt.file)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("LoadSecret() = (%q, %v), want (%q, wantErr %v)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	hs, rs, _, ed := testKeys(t)
+	ks, err := LoadKeySet(conf.Jwt{SigningKid: "hs-1", Keys: []conf.JwtKey{rs, hs, ed}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := ks.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("JWKS() has %d keys, want 2 without the HS256 key", len(jwks.Keys))
+	}
+	tests := []struct {
+		jwk JWK
+		kid string
+		kty string
+		alg string
+	}{
+		{jwks.Keys[0], "ed-1", "OKP", EdDSA},
+		{jwks.Keys[1], "rs-1", "RSA", RS256},
+	}
+	for _, tt := range tests {
+		if tt.jwk.Kid != tt.kid || tt.jwk.Kty != tt.kty || tt.jwk.Alg != tt.alg || tt.jwk.Use != "sig" {
+			t.Errorf("JWK = %+v, want kid %s kty %s alg %s", tt.jwk, tt.kid, tt.kty, tt.alg)
+		}
+	}
+	if jwks.Keys[0].Crv != "Ed25519" || jwks.Keys[0].X == "" {
+		t.Errorf("Ed25519 JWK = %+v, want crv and x", jwks.Keys[0])
+	}
+	if jwks.Keys[1].N == "" || jwks.Keys[1].E != "AQAB" {
+		t.Errorf("RSA JWK = %+v, want n and e", jwks.Keys[1])
+	}
+}
+
+// 轮换密钥：切换签发密钥后，旧密钥签发的令牌仍然可以校验，移除旧密钥后失效
+func TestKeyRotation(t *testing.T) {
+	hs, rs, _, ed := testKeys(t)
+	newJWT := func(c conf.Jwt) *JWT {
+		ks, err := LoadKeySet(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewJWT(ks, c)
+	}
+	claims := CustomClaims{UserId: 1, Username: "alice", StandardClaims: jwt.StandardClaims{
+		ExpiresAt: time.Now().Add(time.Minute).Unix(),
+	}}
+	steps := []struct {
+		name string
+		conf conf.Jwt
+	}{
+		{"HS256", conf.Jwt{Keys: []conf.JwtKey{hs}}},
+		{"加入 RS256 并切换签发密钥", conf.Jwt{SigningKid: "rs-1", Keys: []conf.JwtKey{hs, rs}}},
+		{"加入 EdDSA 并切换签发密钥", conf.Jwt{SigningKid: "ed-1", Keys: []conf.JwtKey{hs, rs, ed}}},
+	}
+	var tokens []string
+	for _, step := range steps {
+		j := newJWT(step.conf)
+		token, err := j.CreateToken(claims)
+		if err != nil {
+			t.Fatalf("%s: CreateToken() error = %v", step.name, err)
+		}
+		tokens = append(tokens, token)
+		for i, token := range tokens {
+			if _, err := j.ParseToken(token); err != nil {
+				t.Errorf("%s: ParseToken(tokens[%d]) error = %v", step.name, i, err)
+			}
+		}
+	}
+	j := newJWT(conf.Jwt{Keys: []conf.JwtKey{ed}})
+	if _, err := j.ParseToken(tokens[0]); err != code.TokenInvalidErr {
+		t.Errorf("ParseToken() with removed key error = %v, want %v", err, code.TokenInvalidErr)
+	}
+}
+
+// 令牌头中的算法与 kid 对应密钥的算法不一致时拒绝校验
+func TestParseTokenAlgorithmMismatch(t *testing.T) {
+	hs, rs, _, _ := testKeys(t)
+	c := conf.Jwt{SigningKid: "rs-1", Keys: []conf.JwtKey{hs, rs}}
+	ks, err := LoadKeySet(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := NewJWT(ks, c)
+	hsKey, _ := ks.Lookup("hs-1")
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, CustomClaims{UserId: 1})
+	token.Header["kid"] = "rs-1"
+	signed, err := token.SignedString(hsKey.signKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := j.ParseToken(TokenPrefix + signed); err != code.TokenInvalidErr {
+		t.Errorf("ParseToken() error = %v, want %v", err, code.TokenInvalidErr)
+	}
+}
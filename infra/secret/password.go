@@ -0,0 +1,105 @@
+package secret
+
+import (
+	"crypto/subtle"
+	"golang.org/x/crypto/bcrypt"
+	"seckill/infra/code"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	// DefaultPasswordMinLength 密码默认最小长度
+	DefaultPasswordMinLength = 8
+	// PasswordMaxLength 密码最大长度，bcrypt 只使用密码的前 72 个字节
+	PasswordMaxLength = 72
+)
+
+// HashPassword 使用 bcrypt 计算密码的哈希值，cost 为 0 时使用 bcrypt.DefaultCost
+func HashPassword(password string, cost int) (string, error) {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// VerifyPassword 校验密码，rehash 为 true 表示校验通过但需要用 cost 重新计算哈希值保存，
+// 包括历史遗留的明文密码与 cost 低于当前配置的哈希值
+func VerifyPassword(hashed, password string, cost int) (ok bool, rehash bool) {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	hashCost, err := bcrypt.Cost([]byte(hashed))
+	if err != nil {
+		// 不是 bcrypt 哈希值，按历史遗留的明文密码进行常量时间比较
+		ok = subtle.ConstantTimeCompare([]byte(hashed), []byte(password)) == 1
+		return ok, ok
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password)) != nil {
+		return false, false
+	}
+	return true, hashCost < cost
+}
+
+// 用户不存在时用于比较的哈希值，按 cost 缓存
+var dummyHashes sync.Map
+
+// VerifyDummyPassword 用户不存在时与一个固定的哈希值进行比较，结果总是不通过，
+// 使响应时间与用户存在时一致，避免通过响应时间枚举用户名
+func VerifyDummyPassword(password string, cost int) {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	v, ok := dummyHashes.Load(cost)
+	if !ok {
+		hash, err := bcrypt.GenerateFromPassword([]byte("seckill dummy password"), cost)
+		if err != nil {
+			return
+		}
+		v, _ = dummyHashes.LoadOrStore(cost, hash)
+	}
+	_ = bcrypt.CompareHashAndPassword(v.([]byte), []byte(password))
+}
+
+// ValidatePassword 校验注册密码是否满足密码策略，minLength 为 0 时使用 DefaultPasswordMinLength
+func ValidatePassword(username, password string, minLength int) error {
+	if minLength == 0 {
+		minLength = DefaultPasswordMinLength
+	}
+	if len([]rune(password)) < minLength {
+		return code.PasswordTooShortErr
+	}
+	if len(password) > PasswordMaxLength {
+		return code.PasswordTooLongErr
+	}
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return code.PasswordTooWeakErr
+	}
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return code.PasswordContainsUsernameErr
+	}
+	return nil
+}
+
+// IsPasswordPolicyErr 判断错误是否为密码策略校验错误
+func IsPasswordPolicyErr(e error) bool {
+	switch e {
+	case code.PasswordTooShortErr, code.PasswordTooLongErr, code.PasswordTooWeakErr, code.PasswordContainsUsernameErr:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package secret
+
+import (
+	"golang.org/x/crypto/bcrypt"
+	"seckill/infra/code"
+	"strings"
+	"testing"
+)
+
+func TestValidatePassword(t *testing.T) {
+	tests := []struct {
+		name      string
+		username  string
+		password  string
+		minLength int
+		want      error
+	}{
+		{"满足策略", "alice", "secret123", 0, nil},
+		{"长度不足", "alice", "abc123", 0, code.PasswordTooShortErr},
+		{"自定义最小长度", "alice", "abc123", 6, nil},
+		{"中文按字符计算最小长度", "alice", "密码密码密码a1", 0, nil},
+		{"恰好 72 个字节", "alice", strings.Repeat("a", 71) + "1", 0, nil},
+		{"超过 72 个字节", "alice", strings.Repeat("a", 72) + "1", 0, code.PasswordTooLongErr},
+		{"中文按字节计算最大长度", "alice", strings.Repeat("密", 24) + "a1", 0, code.PasswordTooLongErr},
+		{"只有字母", "alice", "abcdefgh", 0, code.PasswordTooWeakErr},
+		{"只有数字", "alice", "12345678", 0, code.PasswordTooWeakErr},
+		{"包含用户名忽略大小写", "alice", "xxALICE123", 0, code.PasswordContainsUsernameErr},
+		{"用户名为空", "", "secret123", 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePassword(tt.username, tt.password, tt.minLength)
+			if err != tt.want {
+				t.Errorf("ValidatePassword() = %v, want %v", err, tt.want)
+			}
+			if err != nil && !IsPasswordPolicyErr(err) {
+				t.Errorf("IsPasswordPolicyErr(%v) = false", err)
+			}
+		})
+	}
+}
+
+func TestVerifyPassword(t *testing.T) {
+	hashed, err := HashPassword("secret123", bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		hashed   string
+		password string
+		cost     int
+		ok       bool
+		rehash   bool
+	}{
+		{"哈希值匹配", hashed, "secret123", bcrypt.MinCost, true, false},
+		{"哈希值不匹配", hashed, "secret124", bcrypt.MinCost, false, false},
+		{"cost 升级后需要重新计算", hashed, "secret123", bcrypt.MinCost + 1, true, true},
+		{"明文密码匹配后需要重新计算", "secret123", "secret123", bcrypt.MinCost, true, true},
+		{"明文密码不匹配", "secret123", "secret124", bcrypt.MinCost, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash := VerifyPassword(tt.hashed, tt.password, tt.cost)
+			if ok != tt.ok || rehash != tt.rehash {
+				t.Errorf("VerifyPassword() = (%v, %v), want (%v, %v)", ok, rehash, tt.ok, tt.rehash)
+			}
+		})
+	}
+}
@@ -1,17 +1,22 @@
 package secret
 
 import (
+	"fmt"
 	"github.com/dgrijalva/jwt-go"
+	"seckill/conf"
 	"seckill/infra/code"
+	"seckill/infra/utils/key"
 	"strings"
 	"time"
 )
 
 const (
-	// SecKey 服务器密钥
-	SecKey = "hello second kill"
-	// ExpiresTime JWT 过期时间，单位：秒
-	ExpiresTime = 60*60
+	// ExpiresTime 访问令牌默认的过期时间，单位：秒
+	ExpiresTime = 15*60
+	// RefreshExpiresTime 刷新令牌默认的过期时间，单位：秒
+	RefreshExpiresTime = 30*24*60*60
+	// RefreshedTokenHeader 滑动会话时返回新访问令牌的响应头
+	RefreshedTokenHeader = "X-Refreshed-Token"
 	// Issuer JWT 签发人
 	Issuer      = "second kill"
 	// TokenPrefix JWT 生成 token 所添加的前缀
@@ -23,41 +28,81 @@ type CustomClaims struct {
 	UserId uint `json:"userId"`
 	Username string `json:"username"`
 	Kind     int8 `json:"kind"`
+	// 签发时用户的令牌版本号
+	TokenVersion int64 `json:"tokenVersion"`
+	// 签发令牌的设备，退出登录时吊销该设备的刷新令牌
+	DeviceId string `json:"deviceId"`
+	// 会话开始时间，单位：毫秒，滑动续期时保持不变，早于设备退出登录时间的令牌全部失效
+	SessionAt int64 `json:"sessionAt"`
 	jwt.StandardClaims
 }
 
 // JWT 结构
 type JWT struct {
-	// SigningKey 密钥信息
-	SigningKey []byte
+	// Keys 签名与校验使用的密钥集合
+	Keys *KeySet
+	// AccessExpiration 访问令牌的有效时间
+	AccessExpiration time.Duration
+	// RefreshExpiration 刷新令牌的有效时间
+	RefreshExpiration time.Duration
+	// Sliding 是否开启滑动会话
+	Sliding bool
 }
 
-// NewJWT 创建一个 JWT 实例
-func NewJWT() *JWT {
-	return &JWT{
-		[]byte(SecKey),
+// NewJWT 创建一个 JWT 实例，未配置令牌有效时间时使用默认值
+func NewJWT(keys *KeySet, c conf.Jwt) *JWT {
+	registerEdDSA.Do(func() {
+		jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+			return SigningMethodEdDSA
+		})
+	})
+	j := &JWT{
+		Keys:              keys,
+		AccessExpiration:  time.Duration(c.AccessExpiration) * time.Second,
+		RefreshExpiration: time.Duration(c.RefreshExpiration) * time.Second,
+		Sliding:           c.Sliding,
+	}
+	if j.AccessExpiration <= 0 {
+		j.AccessExpiration = ExpiresTime * time.Second
+	}
+	if j.RefreshExpiration <= 0 {
+		j.RefreshExpiration = RefreshExpiresTime * time.Second
 	}
+	return j
 }
 
 // CreateToken 创建 JWT
 func (j *JWT) CreateToken(claims CustomClaims) (token string, err error) {
-	// 通过 HS256 算法生成 tokenClaims ,这就是我们的 HEADER 部分和 PAYLOAD。
-	tokenClaims := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	token, err = tokenClaims.SignedString(j.SigningKey)
+	// 使用签发密钥的算法生成 tokenClaims，并通过 kid 标记签发密钥，这就是我们的 HEADER 部分和 PAYLOAD。
+	key := j.Keys.Signing()
+	tokenClaims := jwt.NewWithClaims(key.Method, claims)
+	tokenClaims.Header["kid"] = key.Kid
+	token, err = tokenClaims.SignedString(key.signKey)
 	// 返回添加了前缀的 token
 	return TokenPrefix + token, err
 }
 
+// 根据 kid 查找校验密钥，令牌的算法必须与密钥的算法一致，防止算法混淆攻击
+func (j *JWT) verifyKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := j.Keys.Lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q", token.Method.Alg())
+	}
+	return key.verifyKey, nil
+}
+
 // ParseToken 解析 JWT
 func (j *JWT) ParseToken(tokenStr string) (*CustomClaims, error) {
 	auth := strings.Fields(tokenStr)
-	if len(auth) < 1 {
+	if len(auth) < 2 {
 		return nil, code.TokenInvalidErr
 	}
 	// 解析 token 时去除前缀的影响
-	token, err := jwt.ParseWithClaims(auth[1], &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return j.SigningKey, nil
-	})
+	token, err := jwt.ParseWithClaims(auth[1], &CustomClaims{}, j.verifyKey)
 	if err != nil {
 		if ve, ok := err.(*jwt.ValidationError); ok {
 			if ve.Errors&jwt.ValidationErrorMalformed != 0 {
@@ -80,44 +125,12 @@ func (j *JWT) ParseToken(tokenStr string) (*CustomClaims, error) {
 	return nil, code.TokenInvalidErr
 }
 
-// RefreshToken 刷新 JWT
-func (j *JWT) RefreshToken(tokenStr string) (string, error) {
-	auth := strings.Fields(tokenStr)
-	if len(auth) < 1 {
-		return "", code.TokenInvalidErr
-	}
-	// 解析 token 时去除前缀的影响
-	token, err := jwt.ParseWithClaims(auth[1], &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return j.SigningKey, nil
-	})
-	if err != nil {
-		return "", err
-	}
-	if claims, ok := token.Claims.(*CustomClaims); ok && token.Valid {
-		claims.StandardClaims.ExpiresAt = time.Now().Add(ExpiresTime * time.Second).Unix()
-		return j.CreateToken(*claims)
-	}
-	return "", code.TokenInvalidErr
+// RenewToken 使用原来的 claims 重新签发一个 expiresIn 后过期的 JWT
+// 新令牌使用新的编号，会话开始时间保持不变，退出登录时同一会话续期得到的令牌一起失效
+func (j *JWT) RenewToken(claims CustomClaims, expiresIn time.Duration) (string, error) {
+	now := time.Now()
+	claims.StandardClaims.Id = key.CreateKey(key.NumberAndLetter, 32)
+	claims.StandardClaims.IssuedAt = now.Unix()
+	claims.StandardClaims.ExpiresAt = now.Add(expiresIn).Unix()
+	return j.CreateToken(claims)
 }
-
-// InvalidToken 让 JWT 失效
-// 这里实测，并没有产生应有的效果
-func (j *JWT) InvalidToken(tokenStr string) error {
-	auth := strings.Fields(tokenStr)
-	if len(auth) < 1 {
-		return code.TokenInvalidErr
-	}
-	// 解析 token 时去除前缀的影响
-	token, err := jwt.ParseWithClaims(auth[1], &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return j.SigningKey, nil
-	})
-	if err != nil {
-		return err
-	}
-	if claims, ok := token.Claims.(*CustomClaims); ok && token.Valid {
-		// 使这个 JWT 立即失效
-		claims.StandardClaims.ExpiresAt = time.Now().Unix()
-		return nil
-	}
-	return code.TokenInvalidErr
-}
\ No newline at end of file
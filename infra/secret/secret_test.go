@@ -0,0 +1,83 @@
+package secret
+
+import (
+	"github.com/dgrijalva/jwt-go"
+	"seckill/conf"
+	"seckill/infra/code"
+	"testing"
+	"time"
+)
+
+func newTestJWT(t *testing.T) *JWT {
+	t.Helper()
+	hs, _, _, _ := testKeys(t)
+	c := conf.Jwt{Keys: []conf.JwtKey{hs}}
+	ks, err := LoadKeySet(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewJWT(ks, c)
+}
+
+func TestNewJWTDefaults(t *testing.T) {
+	j := newTestJWT(t)
+	if j.AccessExpiration != ExpiresTime*time.Second || j.RefreshExpiration != RefreshExpiresTime*time.Second {
+		t.Errorf("NewJWT() expiration = (%v, %v), want defaults", j.AccessExpiration, j.RefreshExpiration)
+	}
+}
+
+func TestParseToken(t *testing.T) {
+	j := newTestJWT(t)
+	now := time.Now()
+	sign := func(claims jwt.StandardClaims) string {
+		token, err := j.CreateToken(CustomClaims{UserId: 1, StandardClaims: claims})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"有效令牌", sign(jwt.StandardClaims{ExpiresAt: now.Add(time.Minute).Unix()}), nil},
+		{"已过期", sign(jwt.StandardClaims{ExpiresAt: now.Add(-time.Minute).Unix()}), code.TokenExpiredErr},
+		{"尚未生效", sign(jwt.StandardClaims{NotBefore: now.Add(time.Minute).Unix()}), code.TokenNotValidYetErr},
+		{"格式错误", TokenPrefix + "not.a.jwt", code.TokenMalformedErr},
+		{"缺少前缀", "token", code.TokenInvalidErr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := j.ParseToken(tt.token); err != tt.want {
+				t.Errorf("ParseToken() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// 续期得到的令牌使用新的编号，会话开始时间保持不变
+func TestRenewToken(t *testing.T) {
+	j := newTestJWT(t)
+	claims := CustomClaims{UserId: 1, DeviceId: "phone", SessionAt: 1000, StandardClaims: jwt.StandardClaims{
+		Id:        "old",
+		ExpiresAt: time.Now().Add(time.Second).Unix(),
+	}}
+	token, err := j.RenewToken(claims, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renewed, err := j.ParseToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewed.Id == "" || renewed.Id == claims.Id {
+		t.Errorf("renewed jti = %q, want a new jti", renewed.Id)
+	}
+	if renewed.SessionAt != claims.SessionAt || renewed.DeviceId != claims.DeviceId {
+		t.Errorf("renewed session = (%d, %q), want (%d, %q)", renewed.SessionAt, renewed.DeviceId, claims.SessionAt, claims.DeviceId)
+	}
+	if renewed.ExpiresAt < time.Now().Add(time.Hour-time.Minute).Unix() {
+		t.Errorf("renewed ExpiresAt = %d, want about an hour from now", renewed.ExpiresAt)
+	}
+}
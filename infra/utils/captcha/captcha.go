@@ -0,0 +1,151 @@
+package captcha
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math/big"
+	"strconv"
+)
+
+const (
+	// 字符点阵的宽高
+	glyphWidth  = 3
+	glyphHeight = 5
+	// 字符点阵的放大倍数
+	scale = 6
+	// 字符间距
+	spacing = 8
+	// 图片边距
+	padding = 10
+	// 干扰点数量
+	noiseDots = 120
+	// 干扰线数量
+	noiseLines = 4
+)
+
+// 字符点阵，每个字符由 5 行 3 列组成，1 表示需要绘制的点
+var glyphs = map[rune][glyphHeight]string{
+	'0': {"111", "101", "101", "101", "111"},
+	'1': {"010", "110", "010", "010", "111"},
+	'2': {"111", "001", "111", "100", "111"},
+	'3': {"111", "001", "111", "001", "111"},
+	'4': {"101", "101", "111", "001", "001"},
+	'5': {"111", "100", "111", "001", "111"},
+	'6': {"111", "100", "111", "101", "111"},
+	'7': {"111", "001", "010", "010", "010"},
+	'8': {"111", "101", "111", "101", "111"},
+	'9': {"111", "101", "111", "001", "111"},
+	'+': {"000", "010", "111", "010", "000"},
+	'-': {"000", "000", "111", "000", "000"},
+	'x': {"000", "101", "010", "101", "000"},
+	'=': {"000", "111", "000", "111", "000"},
+	'?': {"111", "001", "010", "000", "010"},
+	' ': {"000", "000", "000", "000", "000"},
+}
+
+// Generate 生成一道算术验证码题目，返回题目与答案
+func Generate() (question string, answer string) {
+	a, b := randInt(1, 20), randInt(1, 20)
+	switch randInt(0, 2) {
+	case 0:
+		return fmt.Sprintf("%d+%d=?", a, b), strconv.Itoa(a + b)
+	case 1:
+		// 保证结果不为负数
+		if a < b {
+			a, b = b, a
+		}
+		return fmt.Sprintf("%d-%d=?", a, b), strconv.Itoa(a - b)
+	default:
+		b = randInt(1, 9)
+		return fmt.Sprintf("%dx%d=?", a, b), strconv.Itoa(a * b)
+	}
+}
+
+// Render 把题目绘制成带干扰的 png 图片
+func Render(question string) ([]byte, error) {
+	width := padding*2 + len(question)*(glyphWidth*scale+spacing)
+	height := padding*2 + glyphHeight*scale + scale*2
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	// 背景
+	bg := color.RGBA{R: 240, G: 240, B: 240, A: 255}
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, bg)
+		}
+	}
+	// 干扰点
+	for i := 0; i < noiseDots; i++ {
+		img.Set(randInt(0, width-1), randInt(0, height-1), randColor())
+	}
+	// 字符，每个字符随机上下偏移
+	x := padding
+	for _, r := range question {
+		g, ok := glyphs[r]
+		if !ok {
+			return nil, fmt.Errorf("captcha: unsupported char %q", r)
+		}
+		y := padding + randInt(0, scale*2)
+		c := randColor()
+		for row := 0; row < glyphHeight; row++ {
+			for col := 0; col < glyphWidth; col++ {
+				if g[row][col] == '1' {
+					fillRect(img, x+col*scale, y+row*scale, scale, c)
+				}
+			}
+		}
+		x += glyphWidth*scale + spacing
+	}
+	// 干扰线
+	for i := 0; i < noiseLines; i++ {
+		drawLine(img, 0, randInt(0, height-1), width-1, randInt(0, height-1), randColor())
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DataURL 把 png 图片转换为可直接在前端展示的 data url
+func DataURL(data []byte) string {
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// 填充一个边长为 size 的正方形
+func fillRect(img *image.RGBA, x, y, size int, c color.Color) {
+	for i := 0; i < size; i++ {
+		for j := 0; j < size; j++ {
+			img.Set(x+i, y+j, c)
+		}
+	}
+}
+
+// 绘制一条从 (x0, y0) 到 (x1, y1) 的直线
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	steps := x1 - x0
+	for i := 0; i <= steps; i++ {
+		y := y0 + (y1-y0)*i/steps
+		img.Set(x0+i, y, c)
+	}
+}
+
+// 随机生成一个较深的颜色
+func randColor() color.Color {
+	return color.RGBA{
+		R: uint8(randInt(0, 150)),
+		G: uint8(randInt(0, 150)),
+		B: uint8(randInt(0, 150)),
+		A: 255,
+	}
+}
+
+// 生成 [min, max] 之间的随机数
+func randInt(min, max int) int {
+	n, _ := rand.Int(rand.Reader, big.NewInt(int64(max-min+1)))
+	return min + int(n.Int64())
+}
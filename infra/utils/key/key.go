@@ -8,6 +8,7 @@ import (
 
 const (
 	Number            = "1234567890"
+	NumberAndLetter   = "1234567890abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 )
 
 // CreateKey 创建随机key，str：key 的生成源，len：key 的生成长度
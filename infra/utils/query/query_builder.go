@@ -0,0 +1,103 @@
+package query
+
+import (
+	"reflect"
+	"strings"
+)
+
+// like 查询中需要转义的字符，mysql 默认使用 \ 作为转义符
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Builder 动态 sql 查询条件构造器
+// 条件值一律通过占位符传递，列名只能由代码传入，不能来自用户输入
+type Builder struct {
+	conditions []string
+	args       []interface{}
+}
+
+// NewBuilder 创建一个空的条件构造器
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// Eq column = value
+func (b *Builder) Eq(column string, value interface{}) *Builder {
+	return b.add(column+" = ?", value)
+}
+
+// Like column like %value%，value 中的 % _ \ 会被转义，按字面量匹配
+func (b *Builder) Like(column string, value string) *Builder {
+	return b.add(column+" LIKE ?", "%"+likeEscaper.Replace(value)+"%")
+}
+
+// Lt column < value
+func (b *Builder) Lt(column string, value interface{}) *Builder {
+	return b.add(column+" < ?", value)
+}
+
+// Gt column > value
+func (b *Builder) Gt(column string, value interface{}) *Builder {
+	return b.add(column+" > ?", value)
+}
+
+// Gte column >= value
+func (b *Builder) Gte(column string, value interface{}) *Builder {
+	return b.add(column+" >= ?", value)
+}
+
+// Lte column <= value
+func (b *Builder) Lte(column string, value interface{}) *Builder {
+	return b.add(column+" <= ?", value)
+}
+
+// In column in (values...)，values 必须是切片，空切片不添加条件
+func (b *Builder) In(column string, values interface{}) *Builder {
+	v := reflect.ValueOf(values)
+	if v.Kind() != reflect.Slice || v.Len() == 0 {
+		return b
+	}
+	return b.add(column+" IN (?)", values)
+}
+
+// Or 把多个构造器的条件分别用括号括起来后以 OR 连接，作为一个条件添加，没有条件的构造器会被忽略
+func (b *Builder) Or(builders ...*Builder) *Builder {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	for _, o := range builders {
+		if len(o.conditions) == 0 {
+			continue
+		}
+		conditions = append(conditions, "("+o.Sql()+")")
+		args = append(args, o.args...)
+	}
+	if len(conditions) == 0 {
+		return b
+	}
+	return b.add("("+strings.Join(conditions, " OR ")+")", args...)
+}
+
+// NotDeleted 过滤已被软删除的记录
+func (b *Builder) NotDeleted() *Builder {
+	return b.add("deleted_at IS NULL")
+}
+
+// Sql 获取以 AND 连接的 where 条件，没有条件时返回恒真条件
+func (b *Builder) Sql() string {
+	if len(b.conditions) == 0 {
+		return "1 = 1"
+	}
+	return strings.Join(b.conditions, " AND ")
+}
+
+// Args 获取与 Sql 中占位符一一对应的参数
+func (b *Builder) Args() []interface{} {
+	return b.args
+}
+
+func (b *Builder) add(condition string, args ...interface{}) *Builder {
+	b.conditions = append(b.conditions, condition)
+	b.args = append(b.args, args...)
+	return b
+}
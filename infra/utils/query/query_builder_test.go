@@ -0,0 +1,74 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *Builder
+		sql     string
+		args    []interface{}
+	}{
+		{
+			name:    "空条件",
+			builder: NewBuilder(),
+			sql:     "1 = 1",
+		},
+		{
+			name:    "比较条件以 AND 连接",
+			builder: NewBuilder().Eq("id", 1).Gt("price", 10).Gte("stock", 1).Lt("price", 100).Lte("stock", 50),
+			sql:     "id = ? AND price > ? AND stock >= ? AND price < ? AND stock <= ?",
+			args:    []interface{}{1, 10, 1, 100, 50},
+		},
+		{
+			name:    "like 转义通配符",
+			builder: NewBuilder().Like("name", `50%_off\`),
+			sql:     "name LIKE ?",
+			args:    []interface{}{`%50\%\_off\\%`},
+		},
+		{
+			name:    "in 切片",
+			builder: NewBuilder().In("status", []int8{0, 1}),
+			sql:     "status IN (?)",
+			args:    []interface{}{[]int8{0, 1}},
+		},
+		{
+			name:    "in 空切片不添加条件",
+			builder: NewBuilder().In("status", []int8{}),
+			sql:     "1 = 1",
+		},
+		{
+			name:    "in 非切片不添加条件",
+			builder: NewBuilder().In("status", 1),
+			sql:     "1 = 1",
+		},
+		{
+			name: "or 忽略空构造器",
+			builder: NewBuilder().NotDeleted().Or(
+				NewBuilder().Eq("a", 1).Eq("b", 2),
+				NewBuilder(),
+				NewBuilder().Like("c", "x"),
+			),
+			sql:  "deleted_at IS NULL AND ((a = ? AND b = ?) OR (c LIKE ?))",
+			args: []interface{}{1, 2, "%x%"},
+		},
+		{
+			name:    "or 全部为空不添加条件",
+			builder: NewBuilder().Or(NewBuilder(), NewBuilder()),
+			sql:     "1 = 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.builder.Sql(); got != tt.sql {
+				t.Errorf("Sql() = %q, want %q", got, tt.sql)
+			}
+			if got := tt.builder.Args(); !reflect.DeepEqual(got, tt.args) {
+				t.Errorf("Args() = %#v, want %#v", got, tt.args)
+			}
+		})
+	}
+}
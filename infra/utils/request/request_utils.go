@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"seckill/infra/code"
 	"seckill/infra/secret"
+	"seckill/model"
 	"strings"
 )
 
@@ -25,6 +26,18 @@ func GetCurrentCustomClaims(ctx *gin.Context) (claims *secret.CustomClaims, e er
 	return claims, nil
 }
 
+// GetCurrentPrincipal 获取当前用户的角色与权限
+func GetCurrentPrincipal(ctx *gin.Context) (p model.Principal, e error) {
+	v, ok := ctx.Get("principal")
+	if !ok {
+		return p, code.TokenInvalidErr
+	}
+	if p, ok = v.(model.Principal); !ok {
+		return p, code.TokenInvalidErr
+	}
+	return p, nil
+}
+
 // GetIP 获取当前请求的 IP 地址
 func GetIP(r *http.Request) (ip string) {
 	// 尝试从 X-Forwarded-For 中获取
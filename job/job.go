@@ -0,0 +1,65 @@
+package job
+
+import (
+	"context"
+	"seckill/conf"
+	"seckill/service"
+	"sync"
+)
+
+// Jobs 定时任务
+type Jobs struct {
+	stockReconcile *stockReconcile
+	seckillWarmUp  *seckillWarmUp
+	// 定时任务的运行上下文，取消后定时任务执行完当前一轮即退出
+	runCtx context.Context
+	stop   context.CancelFunc
+	// 正在运行的定时任务
+	running sync.WaitGroup
+}
+
+// New 创建定时任务
+func New(stockService service.IStockService, goodsService service.IGoodsService, reconcile conf.Reconcile) *Jobs {
+	j := &Jobs{
+		stockReconcile: &stockReconcile{
+			stockService: stockService,
+			cfg:          reconcile,
+		},
+		seckillWarmUp: &seckillWarmUp{
+			goodsService: goodsService,
+		},
+	}
+	j.runCtx, j.stop = context.WithCancel(context.Background())
+	return j
+}
+
+// Run 启动定时任务
+func (j *Jobs) Run() {
+	j.start(j.stockReconcile.Run)
+	j.start(j.seckillWarmUp.Run)
+}
+
+// start 在协程中启动定时任务
+func (j *Jobs) start(run func(c context.Context)) {
+	j.running.Add(1)
+	go func() {
+		defer j.running.Done()
+		run(j.runCtx)
+	}()
+}
+
+// Shutdown 停止定时任务，并等待正在执行的任务完成，c 超时后不再等待
+func (j *Jobs) Shutdown(c context.Context) error {
+	j.stop()
+	done := make(chan struct{})
+	go func() {
+		j.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-c.Done():
+		return c.Err()
+	}
+}
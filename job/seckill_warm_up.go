@@ -0,0 +1,32 @@
+package job
+
+import (
+	"context"
+	"log"
+	"seckill/service"
+	"time"
+)
+
+// seckillWarmUp 秒杀商品预热与清理定时任务
+type seckillWarmUp struct {
+	goodsService service.IGoodsService
+}
+
+// Run 启动时恢复持久化的任务，之后每秒执行一次到期的预热与清理任务
+func (j *seckillWarmUp) Run(c context.Context) {
+	if err := j.goodsService.RehydrateSeckillJobs(); err != nil {
+		log.Printf("goodsService.RehydrateSeckillJobs() failed, err: %v", err)
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := j.goodsService.RunDueSeckillJobs(); err != nil {
+			log.Printf("goodsService.RunDueSeckillJobs() failed, err: %v", err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package job
+
+import (
+	"context"
+	"log"
+	"seckill/conf"
+	"seckill/service"
+	"time"
+)
+
+// stockReconcile 库存对账定时任务
+type stockReconcile struct {
+	stockService service.IStockService
+	cfg          conf.Reconcile
+}
+
+// Run 按配置的时间间隔定时对账库存
+func (j *stockReconcile) Run(c context.Context) {
+	cfg := j.cfg
+	if cfg.Interval <= 0 {
+		log.Println("库存对账定时任务未开启")
+		return
+	}
+	ticker := time.NewTicker(time.Duration(cfg.Interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Done():
+			return
+		case <-ticker.C:
+		}
+		list, err := j.stockService.Reconcile(!cfg.Repair)
+		if err != nil {
+			log.Printf("stockService.Reconcile() failed, err: %v", err)
+			continue
+		}
+		log.Printf("库存对账完成，%d 个商品存在库存偏差", len(list))
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"io"
 	"log"
 	"os"
-	"seckill/router"
+	"seckill/app"
 )
 
 func init() {
@@ -20,12 +20,34 @@ func init() {
 }
 
 func main() {
+	// 数据库迁移子命令：seckill migrate up|down|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		command := "up"
+		if len(os.Args) > 2 {
+			command = os.Args[2]
+		}
+		if err := app.Migrate("config.yaml", command); err != nil {
+			log.Fatal("数据库迁移错误：", err)
+		}
+		return
+	}
+	// 角色管理子命令：seckill role grant|revoke <username> <role>
+	if len(os.Args) > 1 && os.Args[1] == "role" {
+		if len(os.Args) != 5 {
+			log.Fatal("用法：seckill role grant|revoke <username> <role>")
+		}
+		if err := app.Role("config.yaml", os.Args[2], os.Args[3], os.Args[4]); err != nil {
+			log.Fatal("角色管理错误：", err)
+		}
+		return
+	}
 	// 启用发布模式
 	gin.SetMode(gin.ReleaseMode)
-	// 启动
-	err := router.InitRouter().Run()
+	a, err := app.New("config.yaml")
 	if err != nil {
-		log.Fatal("项目启动错误：", err)
-		return
+		log.Fatal("项目初始化错误：", err)
+	}
+	if err = a.Run(); err != nil {
+		log.Fatal(err)
 	}
 }
@@ -3,13 +3,16 @@ package middleware
 import (
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"seckill/infra/code"
 	"seckill/infra/secret"
 	"seckill/infra/utils/response"
 	"seckill/model"
+	"seckill/service"
+	"time"
 )
 
-// Auth 登录用户认证
-func Auth() gin.HandlerFunc {
+// Auth 登录用户认证，检查令牌是否已被吊销，并加载用户的角色与权限
+func Auth(userService service.IUserService, roleService service.IRoleService, j *secret.JWT) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		result := model.Result{}
 		// 首先在请求头获取 token
@@ -22,7 +25,6 @@ func Auth() gin.HandlerFunc {
 			return
 		}
 		// 解析 token
-		j := secret.NewJWT()
 		claims, err := j.ParseToken(auth)
 		if err != nil {
 			ctx.Abort()
@@ -31,11 +33,37 @@ func Auth() gin.HandlerFunc {
 			response.Fail(ctx, result)
 			return
 		}
-		// 认证通过则刷新 JWT 过期时间
-		_, _ = j.RefreshToken(auth)
+		if err = userService.CheckToken(claims); err != nil {
+			ctx.Abort()
+			result.Code = http.StatusUnauthorized
+			if err != code.TokenRevokedErr {
+				result.Code = http.StatusInternalServerError
+			}
+			result.Message = err.Error()
+			response.Fail(ctx, result)
+			return
+		}
+		principal, err := roleService.FindPrincipal(claims.UserId)
+		if err != nil {
+			ctx.Abort()
+			result.Code = http.StatusInternalServerError
+			result.Message = err.Error()
+			response.Fail(ctx, result)
+			return
+		}
+		// 开启滑动会话时，访问令牌的剩余有效时间不足一半则签发新的访问令牌
+		if j.Sliding {
+			expiration := j.AccessExpiration
+			if time.Until(time.Unix(claims.ExpiresAt, 0)) < expiration/2 {
+				if token, err := j.RenewToken(*claims, expiration); err == nil {
+					ctx.Header(secret.RefreshedTokenHeader, token)
+				}
+			}
+		}
 
 		// 继续交由下一个路由处理，并将解析出的信息传递下去
 		ctx.Set("claims", claims)
+		ctx.Set("principal", principal)
 		ctx.Next()
 	}
 }
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"seckill/infra/code"
+	"seckill/infra/utils/request"
+	"seckill/infra/utils/response"
+	"seckill/model"
+)
+
+// RequirePermission 权限校验，当前用户的角色中没有 perm 权限时拒绝访问，需要在 Auth 之后使用
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		result := model.Result{}
+		principal, err := request.GetCurrentPrincipal(ctx)
+		// 没有登录信息
+		if err != nil {
+			ctx.Abort()
+			result.Code = http.StatusUnauthorized
+			result.Message = err.Error()
+			response.Fail(ctx, result)
+			return
+		}
+		if !principal.Can(perm) {
+			ctx.Abort()
+			result.Code = http.StatusForbidden
+			result.Message = code.StatusForbiddenErr.Error()
+			response.Fail(ctx, result)
+			return
+		}
+		ctx.Next()
+	}
+}
@@ -10,15 +10,9 @@ import (
 	"seckill/model"
 )
 
-var (
-	tokenBucket *limit.TokenBucket
-)
-func init() {
-	tokenBucket = limit.NewTokenBucket(int(conf.Config.Total), int(conf.Config.Rate))
-}
-
 // SysLimit 使用令牌桶算法针对整个系统进行限流
-func SysLimit() gin.HandlerFunc {
+func SysLimit(c conf.RateLimit) gin.HandlerFunc {
+	tokenBucket := limit.NewTokenBucket(int(c.Total), int(c.Rate))
 	return func(context *gin.Context) {
 		var (
 			result model.Result
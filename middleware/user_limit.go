@@ -4,10 +4,10 @@ import (
 	"context"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
 	"log"
 	"net/http"
 	"seckill/conf"
-	"seckill/infra/cache"
 	"seckill/infra/code"
 	"seckill/infra/utils/request"
 	"seckill/infra/utils/response"
@@ -25,7 +25,7 @@ var (
 )
 
 // UserLimit 对当个 IP 的请求进行限流
-func UserLimit() gin.HandlerFunc {
+func UserLimit(redis *redis.Client, c conf.RateLimit) gin.HandlerFunc {
 	return func(context *gin.Context) {
 		var (
 			result model.Result
@@ -38,7 +38,7 @@ func UserLimit() gin.HandlerFunc {
 		clientIP = request.GetIP(context.Request)
 		k = fmt.Sprintf(rateLimitKey, clientIP)
 		// 记录该 IP 的请求次数，使其 + 1
-		count, e = cache.Client.Incr(ctx, k).Result()
+		count, e = redis.Incr(ctx, k).Result()
 		if e != nil {
 			log.Printf("rdb.Incr() failed, err: %v", e)
 			context.Abort()
@@ -49,7 +49,7 @@ func UserLimit() gin.HandlerFunc {
 		}
 
 		// 给该 IP 的请求次数记录设置一个过期时间
-		if e = cache.Client.Expire(ctx, k, time.Duration(conf.Config.RateLimit.Time)*time.Second).Err(); e != nil {
+		if e = redis.Expire(ctx, k, time.Duration(c.Time)*time.Second).Err(); e != nil {
 			log.Printf("rdb.Expire() failed, err: %v", e)
 			context.Abort()
 			result.Code = http.StatusInternalServerError
@@ -59,7 +59,7 @@ func UserLimit() gin.HandlerFunc {
 		}
 
 		// 如果在规定时间段内的请求超过了规定的次数上限，则说明该 IP 存在恶意攻击行为，需要对其请求进行限制
-		if count > conf.Config.RateLimit.Count {
+		if count > c.Count {
 			context.Abort()
 			result.Code = http.StatusTooManyRequests
 			result.Message = code.TooManyRequests.Error()
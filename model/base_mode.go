@@ -1,8 +1,7 @@
 package model
 
 import (
-	"bytes"
-	"fmt"
+	"seckill/infra/utils/query"
 )
 
 type Model struct {
@@ -12,32 +11,17 @@ type Model struct {
 	DeletedAt *LocalTime `json:"deletedAt" sql:"index" gorm:"type:datetime;comment:'删除时间'" swaggerignore:"true"`
 }
 
-// GetWhereSql 获取动态 sql 查询的 where 前缀
-func (m Model) GetWhereSql() bytes.Buffer {
-	var sql bytes.Buffer
+// Where 把 Model 中非空的字段作为等值条件添加到 b 中，并过滤已删除的记录
+func (m Model) Where(b *query.Builder) *query.Builder {
 	timeZero := LocalTime{}.ZeroValue()
-	sql.WriteString("1 = 1 ")
 	if m.ID != 0 {
-		sql.WriteString("and id = ")
-		sql.WriteString(fmt.Sprintf("%d ", m.ID))
+		b.Eq("id", m.ID)
 	}
 	if m.CreatedAt != timeZero {
-		sql.WriteString("and create_at = ")
-		sql.WriteString("'")
-		sql.WriteString(m.CreatedAt.String())
-		sql.WriteString("' ")
+		b.Eq("created_at", m.CreatedAt)
 	}
 	if m.UpdatedAt != timeZero {
-		sql.WriteString("and update_at = ")
-		sql.WriteString("'")
-		sql.WriteString(m.UpdatedAt.String())
-		sql.WriteString("' ")
+		b.Eq("updated_at", m.UpdatedAt)
 	}
-	if m.DeletedAt != nil && (*m.DeletedAt) != timeZero {
-		sql.WriteString("and delete_at = ")
-		sql.WriteString("'")
-		sql.WriteString(m.DeletedAt.String())
-		sql.WriteString("' ")
-	}
-	return sql
-}
\ No newline at end of file
+	return b.NotDeleted()
+}
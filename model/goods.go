@@ -1,10 +1,9 @@
 package model
 
 import (
-	"log"
 	"seckill/infra/code"
-	"seckill/infra/db"
 	"seckill/infra/utils/bean"
+	"strings"
 	"time"
 )
 
@@ -25,6 +24,8 @@ type Goods struct {
 	Price       float64   `gorm:"type:decimal(20,2);comment:'现价'"`
 	Amount      int       `gorm:"comment:'商品总量'"`
 	Stock       int       `gorm:"comment:'商品剩余数量'"`
+	LimitPerUser int      `gorm:"default:1;comment:'每人限购数量'"`
+	NeedCaptcha bool      `gorm:"default:false;comment:'秒杀前是否需要验证码'"`
 	StartTime   LocalTime `gorm:"type:datetime;comment:'秒杀开始时间'"`
 	EndTime     LocalTime `gorm:"type:datetime;comment:'秒杀结束时间'"`
 	UserId      uint      `gorm:"comment:'创建人'"`
@@ -39,6 +40,8 @@ type GoodsDTO struct {
 	Price       float64   `json:"price" binding:"required" minimum:"0.0" default:"0.0"`
 	Amount      int       `json:"amount" binding:"required" minimum:"1" default:"0"`
 	Stock       int       `json:"stock" binding:"required" minimum:"0" default:"0"`
+	LimitPerUser int      `json:"limitPerUser" binding:"omitempty,min=1" minimum:"1" default:"1"`
+	NeedCaptcha bool      `json:"needCaptcha" default:"false"`
 	StartTime   LocalTime `json:"startTime" binding:"required"`
 	EndTime     LocalTime `json:"endTime" binding:"required"`
 	UserId      uint      `json:"userId" swaggerignore:"true"`
@@ -53,6 +56,8 @@ type GoodsVO struct {
 	Price       float64   `json:"price"`
 	Amount      int       `json:"amount"`
 	Stock       int       `json:"stock"`
+	LimitPerUser int      `json:"limitPerUser"`
+	NeedCaptcha bool      `json:"needCaptcha"`
 	StartTime   LocalTime `json:"startTime"`
 	EndTime     LocalTime `json:"endTime"`
 	UserId      uint      `json:"userId"`
@@ -70,6 +75,58 @@ type GoodsQueryCondition struct {
 	StartTime LocalTime `json:"startTime"`
 	EndTime   LocalTime `json:"endTime"`
 	UserId    uint      `json:"userId" swaggerignore:"true"`
+	// 商品状态列表，满足任意一个状态即可，状态的计算方式与 Goods.ToVO 一致
+	Statuses []int8 `json:"statuses"`
+	// 价格范围
+	PriceMin float64 `json:"priceMin"`
+	PriceMax float64 `json:"priceMax"`
+	// 秒杀开始时间范围
+	StartFrom LocalTime `json:"startFrom"`
+	StartTo   LocalTime `json:"startTo"`
+	// 秒杀结束时间范围
+	EndFrom LocalTime `json:"endFrom"`
+	EndTo   LocalTime `json:"endTo"`
+	// 排序字段，按顺序依次排序，字段名前加 - 表示倒序，如 ["price", "-startTime"]
+	Sort []string `json:"sort"`
+}
+
+// 商品列表允许排序的字段与对应的列
+var goodsSortColumns = map[string]string{
+	"id":        "id",
+	"price":     "price",
+	"stock":     "stock",
+	"startTime": "start_time",
+	"endTime":   "end_time",
+	"createdAt": "created_at",
+}
+
+// Validate 校验分页与排序参数
+func (c GoodsQueryCondition) Validate() error {
+	if e := c.PageDTO.Validate(); e != nil {
+		return e
+	}
+	for _, s := range c.Sort {
+		if _, ok := goodsSortColumns[strings.TrimPrefix(s, "-")]; !ok {
+			return code.SortParamErr
+		}
+	}
+	return nil
+}
+
+// OrderBy 获取排序语句，不在白名单中的字段会被忽略，最后按 id 排序保证分页结果稳定
+func (c GoodsQueryCondition) OrderBy() string {
+	orders := make([]string, 0, len(c.Sort)+1)
+	for _, s := range c.Sort {
+		column, ok := goodsSortColumns[strings.TrimPrefix(s, "-")]
+		if !ok {
+			continue
+		}
+		if strings.HasPrefix(s, "-") {
+			column += " desc"
+		}
+		orders = append(orders, column)
+	}
+	return strings.Join(append(orders, "id"), ", ")
 }
 
 // TableName 继承接口指定表名
@@ -77,6 +134,14 @@ func (g Goods) TableName() string {
 	return "goods"
 }
 
+// GetLimitPerUser 获取每人限购数量，未设置时每人限购 1 件
+func (g Goods) GetLimitPerUser() int {
+	if g.LimitPerUser <= 0 {
+		return 1
+	}
+	return g.LimitPerUser
+}
+
 // ToVO Goods 转为 GoodsVO
 func (g Goods) ToVO() (vo GoodsVO, e error) {
 	if e = bean.SimpleCopyProperties(&vo, g); e != nil {
@@ -102,15 +167,6 @@ func (g Goods) ToVO() (vo GoodsVO, e error) {
 		// 该商品的秒杀活动已结束
 		vo.Status = Ended
 	}
+	vo.LimitPerUser = g.GetLimitPerUser()
 	return vo, nil
 }
-
-
-func init() {
-	g := Goods{}
-	// 表不存在的时候创建表
-	if !db.DB.HasTable(g) {
-		log.Printf("正在创建 %s 表\n", g.TableName())
-		db.DB.Debug().CreateTable(g)
-	}
-}
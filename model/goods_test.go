@@ -0,0 +1,32 @@
+package model
+
+import (
+	"seckill/infra/code"
+	"testing"
+)
+
+func TestGoodsQueryConditionSort(t *testing.T) {
+	tests := []struct {
+		name    string
+		sort    []string
+		err     error
+		orderBy string
+	}{
+		{"默认按 id 排序", nil, nil, "id"},
+		{"价格升序", []string{"price"}, nil, "price, id"},
+		{"多字段排序", []string{"-startTime", "price"}, nil, "start_time desc, price, id"},
+		{"不在白名单中的字段", []string{"price; drop table goods"}, code.SortParamErr, "id"},
+		{"不能按列名排序", []string{"start_time"}, code.SortParamErr, "id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := GoodsQueryCondition{Sort: tt.sort}
+			if err := c.Validate(); err != tt.err {
+				t.Errorf("Validate() = %v, want %v", err, tt.err)
+			}
+			if got := c.OrderBy(); got != tt.orderBy {
+				t.Errorf("OrderBy() = %q, want %q", got, tt.orderBy)
+			}
+		})
+	}
+}
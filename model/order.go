@@ -1,9 +1,6 @@
 package model
 
 import (
-	"log"
-	"seckill/conf"
-	"seckill/infra/db"
 	"time"
 )
 
@@ -16,17 +13,29 @@ const (
 	Paying int8 = 1
 	// Paid 订单已支付
 	Paid int8 = 2
+	// Refunding 订单退款中
+	Refunding int8 = 3
+	// Refunded 订单已退款
+	Refunded int8 = 4
+	// Shipped 订单已发货
+	Shipped int8 = 5
+	// Completed 订单已完成
+	Completed int8 = 6
 
 	// SecondKilling 秒杀排队中
 	SecondKilling = 0
 	// SecondKillOk 秒杀成功
 	SecondKillOk = 1
+	// SecondKillFailed 秒杀失败
+	SecondKillFailed = 2
+	// SecondKillSaleOut 商品已售罄
+	SecondKillSaleOut = 3
 )
 
 // Order 订单
 type Order struct {
 	Model
-	OrderId string `gorm:"type:varchar(25);comment:'订单id';index:idx_orders_order_id"`
+	OrderId string `gorm:"type:varchar(25);comment:'订单id';unique_index:idx_orders_order_id"`
 	UserId  uint   `gorm:"type:int;comment:'下单用户id';index:idx_orders_user_id"`
 	GoodsId uint   `gorm:"type:int;comment:'商品id';index:idx_orders_goods_id"`
 }
@@ -34,12 +43,14 @@ type Order struct {
 // OrderInfo 订单信息
 type OrderInfo struct {
 	Model
-	OrderId    string  `gorm:"type:varchar(25);comment:'订单id';index:idx_order_info_order_id"`
+	OrderId    string  `gorm:"type:varchar(25);comment:'订单id';unique_index:idx_order_info_order_id"`
 	UserId     uint    `gorm:"type:int;comment:'下单用户id';index:idx_order_info_user_id"`
 	GoodsId    uint    `gorm:"type:int;comment:'商品id';index:idx_order_info_goods_id"`
 	GoodsName  string  `gorm:"type:varchar(50);comment:'商品名称'"`
 	GoodsImg   string  `gorm:"type:varchar(255);comment:'商品图片url'"`
 	GoodsPrice float64 `gorm:"type:decimal(20,2);comment:'商品价格'"`
+	Quantity   int     `gorm:"type:int;default:1;comment:'购买数量'"`
+	TotalPrice float64 `gorm:"type:decimal(20,2);comment:'订单总价'"`
 	PaymentId  int     `gorm:"type:int;comment:'支付id';index:idx_order_info_payment_id"`
 	Status     int8    `gorm:"type:tinyint(1);comment:'订单状态';index:idx_order_info_status"`
 }
@@ -52,6 +63,8 @@ type OrderInfoVO struct {
 	GoodsName  string  `json:"goodsName"`
 	GoodsImg   string  `json:"goodsImg"`
 	GoodsPrice float64 `json:"goodsPrice"`
+	Quantity   int     `json:"quantity"`
+	TotalPrice float64 `json:"totalPrice"`
 	Status     int8    `json:"status"`
 	Duration   int64   `json:"duration"`
 	Timeout    int64   `json:"timeout"`
@@ -68,14 +81,60 @@ type OrderInfoQueryCondition struct {
 	GoodsPrice float64 `json:"goodsPrice"`
 	PaymentId  int     `json:"paymentId"`
 	Status     int8    `json:"status"`
+	// 订单状态列表，满足任意一个状态即可
+	Statuses []int8 `json:"statuses"`
+	// 下单时间范围
+	CreatedFrom LocalTime `json:"createdFrom"`
+	CreatedTo   LocalTime `json:"createdTo"`
+	// 游标分页：上一页返回的 next_cursor，首页传 0，不传时按页码分页
+	Cursor *uint `json:"cursor"`
+}
+
+// SecondKillDTO 秒杀传输模型
+type SecondKillDTO struct {
+	GoodsId  int `json:"goodsId" binding:"required"`
+	// 购买数量，默认为 1
+	Quantity int `json:"quantity" binding:"omitempty,min=1" minimum:"1" default:"1"`
+}
+
+// OrderRequest 异步创建订单请求
+type OrderRequest struct {
+	OrderId  string
+	UserId   int
+	GoodsId  int
+	Quantity int
+}
+
+// CaptchaVO 秒杀验证码视图模型
+type CaptchaVO struct {
+	// 验证码图片，data url 格式
+	Image  string `json:"image"`
+	// 验证码有效时间，单位：秒
+	Expire int64  `json:"expire"`
+}
+
+// RefundDTO 申请退款传输模型
+type RefundDTO struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// RefundAuditDTO 退款审核传输模型
+type RefundAuditDTO struct {
+	// 是否同意退款
+	Approve bool   `json:"approve"`
+	Remark  string `json:"remark"`
 }
 
 // SecondKillResult 秒杀结果
 type SecondKillResult struct {
-	// 秒杀状态，0：排队中，1：成功，2：失败
+	// 秒杀状态，0：排队中，1：成功，2：失败，3：已售罄
 	Status  int8   `json:"status"`
 	// 订单编号
 	OrderId string `json:"orderId"`
+	// 失败原因错误码
+	Code    int    `json:"code,omitempty"`
+	// 失败原因
+	Message string `json:"message,omitempty"`
 }
 
 // TableName 继承接口指定表名
@@ -88,9 +147,24 @@ func (orderInfo OrderInfo) TableName() string {
 	return "order_info"
 }
 
-// ToVO 把 OrderInfo 转为 OrderInfoVO
-func (orderInfo OrderInfo) ToVO() OrderInfoVO {
-	expiration := conf.Config.Order.Expiration
+// GetQuantity 获取购买数量，数量未记录的历史订单为 1 件
+func (orderInfo OrderInfo) GetQuantity() int {
+	if orderInfo.Quantity <= 0 {
+		return 1
+	}
+	return orderInfo.Quantity
+}
+
+// GetTotalPrice 获取订单总价，总价未记录的历史订单按商品价格 * 购买数量计算
+func (orderInfo OrderInfo) GetTotalPrice() float64 {
+	if orderInfo.TotalPrice <= 0 {
+		return orderInfo.GoodsPrice * float64(orderInfo.GetQuantity())
+	}
+	return orderInfo.TotalPrice
+}
+
+// ToVO 把 OrderInfo 转为 OrderInfoVO，expiration 为订单的超时时间，单位：秒
+func (orderInfo OrderInfo) ToVO(expiration int64) OrderInfoVO {
 	orderVO := OrderInfoVO{
 		Model: orderInfo.Model,
 		OrderId:    orderInfo.OrderId,
@@ -98,6 +172,8 @@ func (orderInfo OrderInfo) ToVO() OrderInfoVO {
 		GoodsName:  orderInfo.GoodsName,
 		GoodsImg:   orderInfo.GoodsImg,
 		GoodsPrice: orderInfo.GoodsPrice,
+		Quantity:   orderInfo.GetQuantity(),
+		TotalPrice: orderInfo.GetTotalPrice(),
 		Status:     orderInfo.Status,
 		Duration:   0,
 		Timeout:    expiration,
@@ -107,17 +183,3 @@ func (orderInfo OrderInfo) ToVO() OrderInfoVO {
 	}
 	return orderVO
 }
-
-func init() {
-	o := Order{}
-	// 表不存在的时候创建表
-	if !db.DB.HasTable(o) {
-		log.Printf("正在创建 %s 表\n", o.TableName())
-		db.DB.Debug().CreateTable(o)
-	}
-	oi := OrderInfo{}
-	if !db.DB.HasTable(oi) {
-		log.Printf("正在创建 %s 表\n", oi.TableName())
-		db.DB.Debug().CreateTable(oi)
-	}
-}
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"fmt"
+)
+
+const (
+	// OperatorSystem 系统操作，如订单超时关闭
+	OperatorSystem = "system"
+	// OperatorPayment 支付网关回调
+	OperatorPayment = "payment"
+)
+
+// orderTransitions 订单状态机，记录每个状态允许流转到的下一个状态
+var orderTransitions = map[int8][]int8{
+	Unpaid:    {Paying, Closed},
+	Paying:    {Unpaid, Paid},
+	Paid:      {Refunding, Shipped},
+	Refunding: {Refunded, Paid},
+	Shipped:   {Completed},
+}
+
+// orderStatusNames 订单状态名称
+var orderStatusNames = map[int8]string{
+	Closed:    "已关闭",
+	Unpaid:    "未支付",
+	Paying:    "支付中",
+	Paid:      "已支付",
+	Refunding: "退款中",
+	Refunded:  "已退款",
+	Shipped:   "已发货",
+	Completed: "已完成",
+}
+
+// OrderTransition 订单状态流转
+type OrderTransition struct {
+	OrderId string
+	From    int8
+	To      int8
+	// 状态流转时需要同时更新的订单字段
+	Attrs map[string]interface{}
+	// 操作人
+	Operator string
+	// 备注
+	Remark string
+}
+
+// OrderStatusHistory 订单状态流转记录
+type OrderStatusHistory struct {
+	Model
+	OrderId    string `json:"orderId" gorm:"type:varchar(25);comment:'订单id';index:idx_order_status_history_order_id"`
+	FromStatus int8   `json:"fromStatus" gorm:"type:tinyint(1);comment:'原状态'"`
+	ToStatus   int8   `json:"toStatus" gorm:"type:tinyint(1);comment:'新状态'"`
+	Operator   string `json:"operator" gorm:"type:varchar(32);comment:'操作人'"`
+	Remark     string `json:"remark" gorm:"type:varchar(255);comment:'备注'"`
+}
+
+// CanTransit 判断订单状态能否从 from 流转到 to
+func CanTransit(from, to int8) bool {
+	for _, v := range orderTransitions[from] {
+		if v == to {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderStatusName 获取订单状态名称
+func OrderStatusName(status int8) string {
+	if name, ok := orderStatusNames[status]; ok {
+		return name
+	}
+	return fmt.Sprintf("未知状态(%d)", status)
+}
+
+// UserOperator 用户操作人标识
+func UserOperator(userId uint) string {
+	return fmt.Sprintf("user:%d", userId)
+}
+
+// TableName 继承接口指定表名
+func (h OrderStatusHistory) TableName() string {
+	return "order_status_history"
+}
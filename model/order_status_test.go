@@ -0,0 +1,50 @@
+package model
+
+import "testing"
+
+func TestCanTransit(t *testing.T) {
+	tests := []struct {
+		from, to int8
+		want     bool
+	}{
+		{Unpaid, Paying, true},
+		{Unpaid, Closed, true},
+		{Unpaid, Paid, false},
+		{Paying, Paid, true},
+		{Paying, Unpaid, true},
+		{Paying, Closed, false},
+		{Paid, Refunding, true},
+		{Paid, Shipped, true},
+		{Paid, Unpaid, false},
+		{Refunding, Refunded, true},
+		{Refunding, Paid, true},
+		{Shipped, Completed, true},
+		{Shipped, Refunding, false},
+		{Closed, Unpaid, false},
+		{Refunded, Paid, false},
+		{Completed, Refunding, false},
+		{Unpaid, Unpaid, false},
+	}
+	for _, tt := range tests {
+		if got := CanTransit(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransit(%s, %s) = %v, want %v", OrderStatusName(tt.from), OrderStatusName(tt.to), got, tt.want)
+		}
+	}
+}
+
+func TestOrderStatusName(t *testing.T) {
+	tests := []struct {
+		status int8
+		want   string
+	}{
+		{Unpaid, "未支付"},
+		{Closed, "已关闭"},
+		{Completed, "已完成"},
+		{42, "未知状态(42)"},
+	}
+	for _, tt := range tests {
+		if got := OrderStatusName(tt.status); got != tt.want {
+			t.Errorf("OrderStatusName(%d) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
@@ -1,5 +1,14 @@
 package model
 
+import "seckill/infra/code"
+
+const (
+	// DefaultPageSize 默认每页数据量
+	DefaultPageSize = 10
+	// MaxPageSize 每页最多能查询的数据量
+	MaxPageSize = 100
+)
+
 // PageDTO 分页查询 DTO
 type PageDTO struct {
 	Index int `json:"index"`
@@ -8,28 +17,68 @@ type PageDTO struct {
 
 // PageVO 分页视图 VO
 type PageVO struct {
-	List interface{} `json:"list"` // 页面数据
-	Index   int  `json:"index"`  // 当前页
-	Total   int  `json:"total"`  // 总页数
-	HasPrev bool `json:"has_prev"` // 是否有上一页
-	HasNext bool `json:"has_next"` // 是否有下一页
+	List    interface{} `json:"list"`     // 页面数据
+	Index   int         `json:"index"`    // 当前页
+	Size    int         `json:"size"`     // 每页数据量
+	Rows    int         `json:"rows"`     // 总行数
+	Total   int         `json:"total"`    // 总页数
+	HasPrev bool        `json:"has_prev"` // 是否有上一页
+	HasNext bool        `json:"has_next"` // 是否有下一页
+	// 游标分页时下一页的游标，游标分页不统计总行数与总页数
+	NextCursor uint `json:"next_cursor,omitempty"`
+}
+
+// Validate 校验分页参数，页码从 1 开始，每页数据量不能超过 MaxPageSize
+func (p PageDTO) Validate() error {
+	if p.Index < 0 || p.Size < 0 || p.Size > MaxPageSize {
+		return code.PageParamErr
+	}
+	return nil
+}
+
+// GetIndex 获取当前页码
+func (p PageDTO) GetIndex() int {
+	if p.Index == 0 {
+		return 1
+	}
+	return p.Index
 }
 
 // GetOffset 获取分页偏移量
 func (p PageDTO) GetOffset() int {
-	offset := 0
-	if p.Index != 0 {
-		offset = (p.Index-1)*p.Size
-	}
-	return offset
+	return (p.GetIndex() - 1) * p.GetLimit()
 }
 
 // GetLimit 获取每页数据量
 func (p PageDTO) GetLimit() int {
-	// 默认每页 10 条数据
-	limit := 10
-	if p.Size != 0 {
-		limit = p.Size
+	if p.Size == 0 {
+		return DefaultPageSize
+	}
+	return p.Size
+}
+
+// NewPageVO 根据分页参数与总行数创建分页视图
+func NewPageVO(list interface{}, p PageDTO, rows int) PageVO {
+	size := p.GetLimit()
+	total := (rows + size - 1) / size
+	return PageVO{
+		List:    list,
+		Index:   p.GetIndex(),
+		Size:    size,
+		Rows:    rows,
+		Total:   total,
+		HasPrev: p.GetIndex() > 1,
+		HasNext: p.GetIndex() < total,
+	}
+}
+
+// NewCursorPageVO 创建游标分页视图，nextCursor 为 0 表示没有下一页
+func NewCursorPageVO(list interface{}, p PageDTO, cursor uint, nextCursor uint) PageVO {
+	return PageVO{
+		List:       list,
+		Size:       p.GetLimit(),
+		HasPrev:    cursor != 0,
+		HasNext:    nextCursor != 0,
+		NextCursor: nextCursor,
 	}
-	return limit
 }
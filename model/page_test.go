@@ -0,0 +1,96 @@
+package model
+
+import (
+	"seckill/infra/code"
+	"testing"
+)
+
+func TestPageDTO(t *testing.T) {
+	tests := []struct {
+		name   string
+		page   PageDTO
+		err    error
+		index  int
+		limit  int
+		offset int
+	}{
+		{"默认值", PageDTO{}, nil, 1, DefaultPageSize, 0},
+		{"第 3 页", PageDTO{Index: 3, Size: 20}, nil, 3, 20, 40},
+		{"每页最大数据量", PageDTO{Index: 1, Size: MaxPageSize}, nil, 1, MaxPageSize, 0},
+		{"超过每页最大数据量", PageDTO{Size: MaxPageSize + 1}, code.PageParamErr, 0, 0, 0},
+		{"负数页码", PageDTO{Index: -1}, code.PageParamErr, 0, 0, 0},
+		{"负数数据量", PageDTO{Size: -1}, code.PageParamErr, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.page.Validate(); err != tt.err {
+				t.Errorf("Validate() = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+			if got := tt.page.GetIndex(); got != tt.index {
+				t.Errorf("GetIndex() = %d, want %d", got, tt.index)
+			}
+			if got := tt.page.GetLimit(); got != tt.limit {
+				t.Errorf("GetLimit() = %d, want %d", got, tt.limit)
+			}
+			if got := tt.page.GetOffset(); got != tt.offset {
+				t.Errorf("GetOffset() = %d, want %d", got, tt.offset)
+			}
+		})
+	}
+}
+
+func TestNewPageVO(t *testing.T) {
+	tests := []struct {
+		name    string
+		page    PageDTO
+		rows    int
+		total   int
+		hasPrev bool
+		hasNext bool
+	}{
+		{"没有数据", PageDTO{}, 0, 0, false, false},
+		{"只有一页", PageDTO{}, 10, 1, false, false},
+		{"第一页", PageDTO{Index: 1, Size: 10}, 11, 2, false, true},
+		{"中间页", PageDTO{Index: 2, Size: 10}, 25, 3, true, true},
+		{"最后一页", PageDTO{Index: 3, Size: 10}, 25, 3, true, false},
+		{"超出总页数", PageDTO{Index: 5, Size: 10}, 25, 3, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vo := NewPageVO(nil, tt.page, tt.rows)
+			if vo.Rows != tt.rows || vo.Total != tt.total || vo.HasPrev != tt.hasPrev || vo.HasNext != tt.hasNext {
+				t.Errorf("NewPageVO() = %+v, want total %d, hasPrev %v, hasNext %v", vo, tt.total, tt.hasPrev, tt.hasNext)
+			}
+			if vo.Index != tt.page.GetIndex() || vo.Size != tt.page.GetLimit() {
+				t.Errorf("NewPageVO() index, size = (%d, %d), want (%d, %d)",
+					vo.Index, vo.Size, tt.page.GetIndex(), tt.page.GetLimit())
+			}
+		})
+	}
+}
+
+func TestNewCursorPageVO(t *testing.T) {
+	tests := []struct {
+		name       string
+		cursor     uint
+		nextCursor uint
+		hasPrev    bool
+		hasNext    bool
+	}{
+		{"首页", 0, 90, false, true},
+		{"中间页", 90, 80, true, true},
+		{"最后一页", 10, 0, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vo := NewCursorPageVO(nil, PageDTO{}, tt.cursor, tt.nextCursor)
+			if vo.HasPrev != tt.hasPrev || vo.HasNext != tt.hasNext || vo.NextCursor != tt.nextCursor ||
+				vo.Size != DefaultPageSize {
+				t.Errorf("NewCursorPageVO() = %+v", vo)
+			}
+		})
+	}
+}
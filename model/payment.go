@@ -0,0 +1,39 @@
+package model
+
+const (
+	// PaymentPaying 支付中
+	PaymentPaying int8 = 0
+	// PaymentSuccess 支付成功
+	PaymentSuccess int8 = 1
+	// PaymentFailed 支付失败
+	PaymentFailed int8 = 2
+	// PaymentRefunded 已退款
+	PaymentRefunded int8 = 3
+)
+
+// Payment 支付记录
+type Payment struct {
+	Model
+	PaymentNo string  `gorm:"type:varchar(25);comment:'支付流水号';unique_index:idx_payments_payment_no"`
+	OrderId   string  `gorm:"type:varchar(25);comment:'订单id';index:idx_payments_order_id"`
+	UserId    uint    `gorm:"type:int;comment:'支付用户id'"`
+	Amount    float64 `gorm:"type:decimal(20,2);comment:'支付金额'"`
+	Gateway   string  `gorm:"type:varchar(20);comment:'支付网关'"`
+	TradeNo   string  `gorm:"type:varchar(64);comment:'支付网关交易号'"`
+	RefundNo  string  `gorm:"type:varchar(64);comment:'支付网关退款交易号'"`
+	Status    int8    `gorm:"type:tinyint(1);comment:'支付状态'"`
+}
+
+// PayVO 发起支付后的视图模型
+type PayVO struct {
+	OrderId   string  `json:"orderId"`
+	PaymentNo string  `json:"paymentNo"`
+	Amount    float64 `json:"amount"`
+	// 支付页面地址，由支付网关返回
+	PayUrl string `json:"payUrl"`
+}
+
+// TableName 继承接口指定表名
+func (p Payment) TableName() string {
+	return "payments"
+}
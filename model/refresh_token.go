@@ -0,0 +1,37 @@
+package model
+
+// RefreshToken 刷新令牌，每个设备一个令牌族，每次刷新都会轮换出同一族的新令牌
+type RefreshToken struct {
+	Model
+	UserId   uint   `gorm:"type:int;comment:'用户id';index:idx_refresh_tokens_user_id"`
+	DeviceId string `gorm:"type:varchar(64);comment:'设备id'"`
+	// 同一次登录轮换出来的令牌属于同一个令牌族，检测到重用时吊销整个令牌族
+	FamilyId string `gorm:"type:varchar(32);comment:'令牌族id';index:idx_refresh_tokens_family_id"`
+	// 只保存令牌的 sha256 哈希值
+	TokenHash string     `gorm:"type:char(64);comment:'令牌哈希值';unique_index:idx_refresh_tokens_token_hash"`
+	ExpiresAt LocalTime  `gorm:"type:datetime;comment:'过期时间'"`
+	UsedAt    *LocalTime `gorm:"type:datetime;comment:'轮换时间'"`
+	RevokedAt *LocalTime `gorm:"type:datetime;comment:'吊销时间'"`
+}
+
+// RefreshTokenDTO 刷新令牌请求
+type RefreshTokenDTO struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+// TokenVO 登录或刷新令牌后返回的令牌
+type TokenVO struct {
+	// 访问令牌
+	Token string `json:"token"`
+	// 访问令牌的有效时间，单位：秒
+	ExpiresIn int64 `json:"expiresIn"`
+	// 刷新令牌，只能使用一次，使用后返回新的刷新令牌
+	RefreshToken string `json:"refreshToken"`
+	// 刷新令牌的有效时间，单位：秒
+	RefreshExpiresIn int64 `json:"refreshExpiresIn"`
+}
+
+// TableName 继承接口指定表名
+func (t RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
@@ -0,0 +1,121 @@
+package model
+
+import "sort"
+
+const (
+	// RoleCustomer 顾客，可以参与秒杀并管理自己的订单
+	RoleCustomer = "customer"
+	// RoleSeller 商家，可以管理自己的商品并审核自己商品的退款
+	RoleSeller = "seller"
+	// RoleOperator 运营，可以管理所有商家的商品与退款，并进行库存对账等运维操作
+	RoleOperator = "operator"
+	// RoleAdmin 管理员，拥有全部权限，并且可以授予、撤销用户的角色
+	RoleAdmin = "admin"
+)
+
+const (
+	// PermOrderWrite 参与秒杀、支付、取消订单与申请退款
+	PermOrderWrite = "order:write"
+	// PermGoodsWrite 添加、更新、删除自己的商品
+	PermGoodsWrite = "goods:write"
+	// PermGoodsManage 更新、删除任意商家的商品
+	PermGoodsManage = "goods:manage"
+	// PermRefundAudit 审核自己商品的退款申请
+	PermRefundAudit = "refund:audit"
+	// PermRefundManage 审核任意商品的退款申请
+	PermRefundManage = "refund:manage"
+	// PermStockReconcile 库存对账
+	PermStockReconcile = "stock:reconcile"
+	// PermQueueRead 查询订单队列的运行统计
+	PermQueueRead = "queue:read"
+	// PermRoleManage 授予、撤销用户的角色
+	PermRoleManage = "role:manage"
+)
+
+// RolePermissions 每个角色拥有的权限
+var RolePermissions = map[string][]string{
+	RoleCustomer: {PermOrderWrite},
+	RoleSeller:   {PermGoodsWrite, PermRefundAudit},
+	RoleOperator: {PermGoodsWrite, PermGoodsManage, PermRefundAudit, PermRefundManage, PermStockReconcile, PermQueueRead},
+	RoleAdmin: {PermOrderWrite, PermGoodsWrite, PermGoodsManage, PermRefundAudit, PermRefundManage, PermStockReconcile,
+		PermQueueRead, PermRoleManage},
+}
+
+// IsValidRole 判断 role 是否为系统中定义的角色
+func IsValidRole(role string) bool {
+	_, ok := RolePermissions[role]
+	return ok
+}
+
+// DefaultRoles 注册时根据用户类别授予的默认角色，商家同时也是顾客
+func DefaultRoles(kind int8) []string {
+	if kind == NormalSeller {
+		return []string{RoleCustomer, RoleSeller}
+	}
+	return []string{RoleCustomer}
+}
+
+// UserRole 用户角色DO
+type UserRole struct {
+	ID        uint      `json:"-" gorm:"primary_key"`
+	CreatedAt LocalTime `json:"grantedAt" gorm:"type:datetime;comment:'授予时间'"`
+	UserId    uint      `json:"userId" gorm:"type:int;comment:'用户id';unique_index:idx_user_roles_user_id_role"`
+	Role      string    `json:"role" gorm:"type:varchar(20);comment:'角色';unique_index:idx_user_roles_user_id_role"`
+}
+
+// TableName 继承接口指定表名
+func (r UserRole) TableName() string {
+	return "user_roles"
+}
+
+// RoleDTO 授予角色DTO
+type RoleDTO struct {
+	Role string `json:"role" example:"operator" binding:"required"`
+}
+
+// UserRoleVO 用户的角色与权限
+type UserRoleVO struct {
+	UserId      uint     `json:"userId"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+// Principal 当前登录用户及其拥有的权限，由认证中间件放入请求上下文
+type Principal struct {
+	UserId      uint
+	Roles       []string
+	permissions map[string]struct{}
+}
+
+// NewPrincipal 根据用户拥有的角色创建 Principal，未定义的角色会被忽略
+func NewPrincipal(userId uint, roles []string) Principal {
+	p := Principal{UserId: userId, Roles: roles, permissions: make(map[string]struct{})}
+	for _, role := range roles {
+		for _, perm := range RolePermissions[role] {
+			p.permissions[perm] = struct{}{}
+		}
+	}
+	return p
+}
+
+// Can 判断当前用户是否拥有 perm 权限
+func (p Principal) Can(perm string) bool {
+	_, ok := p.permissions[perm]
+	return ok
+}
+
+// CanManage 判断当前用户能否操作属于 ownerId 的资源：
+// 资源属于当前用户，或者当前用户拥有可以操作任意用户资源的 override 权限
+func (p Principal) CanManage(ownerId uint, override string) bool {
+	return p.UserId == ownerId || p.Can(override)
+}
+
+// Permissions 当前用户拥有的全部权限，按字典序排列
+func (p Principal) Permissions() []string {
+	list := make([]string, 0, len(p.permissions))
+	for perm := range p.permissions {
+		list = append(list, perm)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPrincipal(t *testing.T) {
+	tests := []struct {
+		name  string
+		roles []string
+		perm  string
+		want  bool
+	}{
+		{"顾客可以下单", []string{RoleCustomer}, PermOrderWrite, true},
+		{"顾客不能管理商品", []string{RoleCustomer}, PermGoodsWrite, false},
+		{"商家同时是顾客", DefaultRoles(NormalSeller), PermOrderWrite, true},
+		{"商家可以审核自己的退款", DefaultRoles(NormalSeller), PermRefundAudit, true},
+		{"商家不能审核任意退款", DefaultRoles(NormalSeller), PermRefundManage, false},
+		{"运营可以对账", []string{RoleOperator}, PermStockReconcile, true},
+		{"运营不能授予角色", []string{RoleOperator}, PermRoleManage, false},
+		{"管理员可以授予角色", []string{RoleAdmin}, PermRoleManage, true},
+		{"未定义的角色被忽略", []string{"root"}, PermRoleManage, false},
+		{"没有角色", nil, PermOrderWrite, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewPrincipal(1, tt.roles).Can(tt.perm); got != tt.want {
+				t.Errorf("Can(%q) = %v, want %v", tt.perm, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrincipalCanManage(t *testing.T) {
+	tests := []struct {
+		name    string
+		roles   []string
+		ownerId uint
+		want    bool
+	}{
+		{"自己的资源", []string{RoleSeller}, 1, true},
+		{"他人的资源", []string{RoleSeller}, 2, false},
+		{"拥有 override 权限", []string{RoleOperator}, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewPrincipal(1, tt.roles).CanManage(tt.ownerId, PermGoodsManage); got != tt.want {
+				t.Errorf("CanManage(%d) = %v, want %v", tt.ownerId, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrincipalPermissions(t *testing.T) {
+	got := NewPrincipal(1, []string{RoleSeller, RoleCustomer, RoleSeller}).Permissions()
+	want := []string{PermGoodsWrite, PermOrderWrite, PermRefundAudit}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Permissions() = %v, want %v", got, want)
+	}
+}
+
+func TestDefaultRoles(t *testing.T) {
+	for _, role := range append(DefaultRoles(NormalSeller), DefaultRoles(NormalCustomer)...) {
+		if !IsValidRole(role) {
+			t.Errorf("default role %q is not defined", role)
+		}
+	}
+	if IsValidRole("root") {
+		t.Error("IsValidRole(\"root\") = true, want false")
+	}
+}
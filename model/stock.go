@@ -0,0 +1,34 @@
+package model
+
+// StockShortageNote 缓存库存低于期望库存时的说明
+const StockShortageNote = "缓存库存低于期望库存，可能是归还库存失败或对账期间的并发导致，不会自动修复，需要人工确认"
+
+// StockDrift 商品库存偏差
+type StockDrift struct {
+	GoodsId uint `json:"goodsId"`
+	// 商品总量
+	Amount int `json:"amount"`
+	// 未关闭的订单数量
+	LiveOrders int `json:"liveOrders"`
+	// 队列中还未创建订单的消息数量
+	InFlight int `json:"inFlight"`
+	// 数据库中的库存与期望库存
+	DBStock         int `json:"dbStock"`
+	ExpectedDBStock int `json:"expectedDbStock"`
+	// 缓存中的库存与期望库存，缓存库存未初始化时不做比较
+	RedisInitialized   bool `json:"redisInitialized"`
+	RedisStock         int  `json:"redisStock"`
+	ExpectedRedisStock int  `json:"expectedRedisStock"`
+	// 是否已修复
+	Repaired bool `json:"repaired"`
+	// 需要人工确认的说明
+	Note string `json:"note,omitempty"`
+}
+
+// HasDrift 是否存在库存偏差
+func (d StockDrift) HasDrift() bool {
+	if d.DBStock != d.ExpectedDBStock {
+		return true
+	}
+	return d.RedisInitialized && d.RedisStock != d.ExpectedRedisStock
+}
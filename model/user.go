@@ -1,10 +1,5 @@
 package model
 
-import (
-	"log"
-	"seckill/infra/db"
-)
-
 const (
 	// NormalCustomer 买家（顾客）
 	NormalCustomer = 0
@@ -16,6 +11,8 @@ const (
 type LoginUser struct {
 	Username string `json:"username" example:"tom" binding:"required"`
 	Password string `json:"password" example:"123" binding:"required"`
+	// 登录设备，每个设备持有独立的刷新令牌，默认为 default
+	DeviceId string `json:"deviceId" example:"web"`
 }
 
 // RegisterUser 用户注册DTO
@@ -28,20 +25,13 @@ type RegisterUser struct {
 type User struct {
 	Model `swaggerignore:"true"`
 	Username   string `json:"username" gorm:"type:varchar(20);comment:'用户名';unique_index:idx_users_username"`
-	Password   string `json:"password" gorm:"type:varchar(32);comment:'用户密码'"`
+	Password   string `json:"-" gorm:"type:varchar(100);comment:'用户密码（bcrypt 哈希值）'"`
 	Kind       int8    `json:"kind" gorm:"type:tinyint(1);comment:'用户类别（0-客户，1-商家）'"`
+	// 令牌版本号，退出所有登录时加 1，版本号小于该值的令牌全部失效
+	TokenVersion int64 `json:"-" gorm:"type:bigint;not null;default:0;comment:'令牌版本号'"`
 }
 
 // TableName 继承接口指定表名
 func (u User)TableName() string {
 	return "users"
 }
-
-func init() {
-	u := User{}
-	// 表不存在的时候创建表
-	if !db.DB.HasTable(u) {
-		log.Printf("正在创建 %s 表\n", u.TableName())
-		db.DB.Debug().CreateTable(u)
-	}
-}
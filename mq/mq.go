@@ -2,34 +2,127 @@ package mq
 
 import (
 	"context"
-	"seckill/infra/cache"
+	"fmt"
+	"log"
 	"seckill/service"
+	"sync"
+	"time"
 )
 
 var (
 	ctx = context.Background()
-	OrderTimeout *orderTimeout
-	PrecreateOrder *precreateOrder
 )
 
 const (
 	// 订单超时延迟队列
 	orderTimeoutDelayQueue = "order_timeout_delay_queue"
+	// 消费者异常退出后的重启间隔
+	restartInterval = time.Second
 )
 
-func Init() {
-	OrderTimeout = &orderTimeout{
-		orderService: service.OrderService,
-		redis:        cache.Client,
+// Consumers 消息消费者
+type Consumers struct {
+	orderTimeout   *orderTimeout
+	precreateOrder *precreateOrder
+	soldOut        *soldOut
+	// 消费者的运行上下文，取消后消费者处理完当前消息即退出
+	runCtx context.Context
+	stop   context.CancelFunc
+	// 正在运行的消费者
+	running sync.WaitGroup
+}
+
+// NewConsumers 创建消息消费者，workers 为订单消费者数量
+func NewConsumers(orderService service.IOrderService, goodsService service.IGoodsService,
+	orderTimeoutQueue *OrderTimeoutQueue, precreateOrderQueue *PrecreateOrderQueue,
+	soldOutNotifier *SoldOutNotifier, workers int) *Consumers {
+	if workers <= 0 {
+		workers = 1
 	}
-	PrecreateOrder = &precreateOrder{
-		orderService: service.OrderService,
-		redis:        cache.Client,
+	m := &Consumers{
+		orderTimeout: &orderTimeout{
+			OrderTimeoutQueue: orderTimeoutQueue,
+			orderService:      orderService,
+		},
+		precreateOrder: &precreateOrder{
+			PrecreateOrderQueue: precreateOrderQueue,
+			orderService:        orderService,
+		},
+		soldOut: &soldOut{
+			SoldOutNotifier: soldOutNotifier,
+			goodsService:    goodsService,
+		},
 	}
+	for i := 0; i < workers; i++ {
+		m.precreateOrder.stats = append(m.precreateOrder.stats, &WorkerStats{Worker: i})
+	}
+	m.runCtx, m.stop = context.WithCancel(context.Background())
+	return m
 }
 
 // Run 对队列进行消息监听和消费
-func Run() {
-	go OrderTimeout.Receive()
-	go PrecreateOrder.Receive()
-}
\ No newline at end of file
+func (m *Consumers) Run() {
+	m.start("OrderTimeout.Receive", m.orderTimeout.Receive)
+	for i := range m.precreateOrder.stats {
+		worker := i
+		m.start(fmt.Sprintf("PrecreateOrder.Receive-%d", worker), func(c context.Context) {
+			m.precreateOrder.Receive(c, worker)
+		})
+	}
+	m.start("PrecreateOrder.Recover", m.precreateOrder.Recover)
+	m.start("SoldOut.Receive", m.soldOut.Receive)
+}
+
+// WorkerStats 获取各个订单消费者的运行统计
+func (m *Consumers) WorkerStats() []WorkerStats {
+	return m.precreateOrder.Stats()
+}
+
+// start 在守护协程中启动消费者
+func (m *Consumers) start(name string, receive func(c context.Context)) {
+	m.running.Add(1)
+	go func() {
+		defer m.running.Done()
+		guard(m.runCtx, name, receive)
+	}()
+}
+
+// guard 守护消费者协程，消费者 panic 或退出后自动重启，c 取消后不再重启
+func guard(c context.Context, name string, receive func(c context.Context)) {
+	for {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("消费者【%s】异常退出, err: %v", name, r)
+				}
+			}()
+			receive(c)
+		}()
+		if c.Err() != nil {
+			log.Printf("消费者【%s】已停止", name)
+			return
+		}
+		log.Printf("消费者【%s】将在 %v 后重启", name, restartInterval)
+		select {
+		case <-c.Done():
+		case <-time.After(restartInterval):
+		}
+	}
+}
+
+// Shutdown 通知消费者停止接收新消息，并等待消费者处理完已取出的消息，c 超时后不再等待
+// 未处理完的消息留在处理中列表，会在可见性超时后重新投递
+func (m *Consumers) Shutdown(c context.Context) error {
+	m.stop()
+	done := make(chan struct{})
+	go func() {
+		m.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-c.Done():
+		return c.Err()
+	}
+}
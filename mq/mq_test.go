@@ -0,0 +1,75 @@
+package mq
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGuard(t *testing.T) {
+	tests := []struct {
+		name  string
+		panic bool
+		calls int
+	}{
+		{"取消后不再重启", false, 1},
+		{"panic 后自动重启", true, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			calls := 0
+			guard(c, tt.name, func(c context.Context) {
+				calls++
+				if tt.panic && calls == 1 {
+					panic("boom")
+				}
+				cancel()
+			})
+			if calls != tt.calls {
+				t.Errorf("calls = %d, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestConsumersShutdown(t *testing.T) {
+	tests := []struct {
+		name string
+		// 消费者收到停止通知后还需要的处理时间
+		drain time.Duration
+		want  error
+	}{
+		{"等待消费者处理完成", 10 * time.Millisecond, nil},
+		{"超时后不再等待", time.Second, context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Consumers{}
+			m.runCtx, m.stop = context.WithCancel(context.Background())
+			stopped := make(chan struct{})
+			m.start(tt.name, func(c context.Context) {
+				<-c.Done()
+				time.Sleep(tt.drain)
+				close(stopped)
+			})
+			c, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			if err := m.Shutdown(c); err != tt.want {
+				t.Fatalf("Shutdown() error = %v, want %v", err, tt.want)
+			}
+			select {
+			case <-stopped:
+				if tt.want != nil {
+					t.Errorf("Shutdown() returned after consumer stopped")
+				}
+			default:
+				if tt.want == nil {
+					t.Errorf("Shutdown() returned before consumer stopped")
+				}
+			}
+			<-stopped
+		})
+	}
+}
@@ -1,26 +1,48 @@
 package mq
 
 import (
+	"context"
 	"github.com/go-redis/redis/v8"
 	"log"
-	"seckill/conf"
+	"seckill/infra/code"
 	"seckill/model"
 	"seckill/service"
 	"strconv"
 	"time"
 )
 
-// orderTimeout 订单超时模型
+const (
+	// 支付中的订单每隔多少秒查询一次支付结果
+	payingCheckInterval = 60
+	// 处理订单失败后延后多少秒再重新处理
+	failedCheckInterval = 5
+	// 拉取队列失败后的等待时间
+	pullFailedSleep = 500 * time.Millisecond
+)
+
+// OrderTimeoutQueue 订单超时延迟队列
+type OrderTimeoutQueue struct {
+	redis *redis.Client
+	// 订单超时时间，单位：秒
+	expiration int64
+}
+
+// NewOrderTimeoutQueue 创建一个订单超时延迟队列
+func NewOrderTimeoutQueue(redis *redis.Client, expiration int64) *OrderTimeoutQueue {
+	return &OrderTimeoutQueue{redis: redis, expiration: expiration}
+}
+
+// orderTimeout 订单超时消费者
 type orderTimeout struct {
+	*OrderTimeoutQueue
 	orderService service.IOrderService
-	redis *redis.Client
 }
 
-// Send 往队列中发送数据
-func (mq *orderTimeout) Send(orderId string) {
+// Send 往队列中发送数据，订单已在队列中时保留原有的超时时间
+func (mq *OrderTimeoutQueue) Send(orderId string) {
 	// 把订单编号发送到延迟队列中，并以 Score 的方式设置超时时间
-	if err := mq.redis.ZAdd(ctx, orderTimeoutDelayQueue, &redis.Z{
-		Score:  float64(time.Now().Unix() + conf.Config.Expiration),
+	if err := mq.redis.ZAddNX(ctx, orderTimeoutDelayQueue, &redis.Z{
+		Score:  float64(time.Now().Unix() + mq.expiration),
 		Member: orderId,
 	}).Err(); err != nil {
 		log.Printf("订单【%s】加入延迟队列失败, err: %v", orderId, err)
@@ -30,8 +52,18 @@ func (mq *orderTimeout) Send(orderId string) {
 	return
 }
 
+// 延后 seconds 秒再检查订单
+func (mq *OrderTimeoutQueue) delay(orderId string, seconds int64) {
+	if err := mq.redis.ZAdd(ctx, orderTimeoutDelayQueue, &redis.Z{
+		Score:  float64(time.Now().Unix() + seconds),
+		Member: orderId,
+	}).Err(); err != nil {
+		log.Printf("订单【%s】延后检查失败, err: %v", orderId, err)
+	}
+}
+
 // Remove 从队列中移除数据
-func (mq *orderTimeout) Remove(orderId string) {
+func (mq *OrderTimeoutQueue) Remove(orderId string) {
 	if err := mq.redis.ZRem(ctx, orderTimeoutDelayQueue, orderId).Err(); err != nil {
 		log.Printf("订单【%s】移除延迟队列失败, err: %v", orderId, err)
 	} else {
@@ -41,13 +73,13 @@ func (mq *orderTimeout) Remove(orderId string) {
 }
 
 // Receive 消费队列数据
-func (mq *orderTimeout) Receive() {
+func (mq *orderTimeout) Receive(c context.Context) {
 	var (
 		list      []string
 		err       error
 		orderInfo model.OrderInfo
 	)
-	for {
+	for c.Err() == nil {
 		// 从延迟队列中的拉取订单数据，以当前时间戳作为最大 Score 来拉取，每次拉取一条数据
 		// 即：把到当前时间依旧未支付的订单当做超时订单处理，直接关闭该订单
 		if list, err = mq.redis.ZRangeByScore(ctx, orderTimeoutDelayQueue, &redis.ZRangeBy{
@@ -57,21 +89,51 @@ func (mq *orderTimeout) Receive() {
 			Count:  1,
 		}).Result(); err != nil {
 			log.Printf("redis.ZRangeByScore() failed, err: %v", err)
+			// redis 出错时等待一段时间再拉取，避免空转
+			select {
+			case <-c.Done():
+			case <-time.After(pullFailedSleep):
+			}
 			continue
 		}
 		// 没有订单数据时睡眠
 		if len(list) == 0 {
-			time.Sleep(100 * time.Millisecond)
+			select {
+			case <-c.Done():
+			case <-time.After(100 * time.Millisecond):
+			}
 			continue
 		}
 		// 用订单编号来查询订单数据
 		if orderInfo, err = mq.orderService.GetOrderInfo(list[0]); err != nil {
 			log.Printf("orderService.GetOrderInfo() failed, orderId: %s, err: %v", list[0], err)
+			if err == code.RecordNotFoundErr {
+				// 订单不存在，不再需要检查
+				mq.Remove(list[0])
+			} else {
+				mq.delay(list[0], failedCheckInterval)
+			}
+			continue
+		}
+		// 支付中的订单主动查询支付结果，仍在支付中时延后再检查
+		if orderInfo.Status == model.Paying {
+			if orderInfo, err = mq.orderService.ResolvePaying(orderInfo); err != nil {
+				log.Printf("orderService.ResolvePaying() failed, orderId: %s, err: %v", list[0], err)
+			}
+			if err != nil || orderInfo.Status == model.Paying {
+				mq.delay(list[0], payingCheckInterval)
+				continue
+			}
+		}
+		// 订单已不处于未支付状态，不再需要超时关闭，已关闭的订单交给 CloseOrder 补齐归还库存等后续步骤
+		if orderInfo.Status != model.Unpaid && orderInfo.Status != model.Closed {
+			mq.Remove(orderInfo.OrderId)
 			continue
 		}
 		// 关闭该订单
 		if err = mq.orderService.CloseOrder(int(orderInfo.UserId), orderInfo.OrderId); err != nil {
 			log.Printf("orderService.CloseOrder() failed, orderId: %s, err: %v", orderInfo.OrderId, err)
+			mq.delay(orderInfo.OrderId, failedCheckInterval)
 			continue
 		}
 		log.Printf("订单【%s】已关闭", orderInfo.OrderId)
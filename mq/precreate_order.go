@@ -1,76 +1,433 @@
 package mq
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"github.com/go-redis/redis/v8"
 	"log"
+	"seckill/conf"
 	"seckill/infra/code"
+	"seckill/model"
 	"seckill/service"
+	"strconv"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	// 订单队列在 redis 中的 key
-	precreateOrderKey = "precreate_order_queue"
+	// PrecreateOrderKey 订单队列在 redis 中的 key
+	PrecreateOrderKey = "precreate_order_queue"
+	// 正在处理中的订单消息列表
+	precreateOrderProcessingKey = "precreate_order_processing"
+	// 处理中消息的可见性超时时间，score 为超时的时间戳
+	precreateOrderDeadlineKey = "precreate_order_deadline"
+	// 等待重试的订单消息，score 为可重试的时间戳
+	precreateOrderRetryKey = "precreate_order_retry"
+	// 死信队列，存放重试多次依旧无法消费的订单消息
+	PrecreateOrderDeadLetterKey = "precreate_order_dead_letter"
 )
 
-// precreateOrder 预创建订单模型
+const (
+	// 未配置时消息的可见性超时时间，单位：秒
+	defaultVisibilityTimeout = 30
+	// 未配置时消息的最大重试次数
+	defaultMaxRetry = 3
+	// 未配置时首次重试的等待时间，单位：秒
+	defaultRetryInterval = 2
+	// 未配置时消费者阻塞等待消息的最长时间，单位：秒
+	defaultPopTimeout = 1
+)
+
+// 把处理超时的消息从处理中列表放回到订单队列
+// KEYS[1]：处理中列表，KEYS[2]：超时时间集合，KEYS[3]：订单队列，ARGV[1]：当前时间戳
+var requeueExpiredScript = redis.NewScript(`
+local list = redis.call('ZRANGEBYSCORE', KEYS[2], 0, ARGV[1])
+for _, v in ipairs(list) do
+	redis.call('ZREM', KEYS[2], v)
+	if redis.call('LREM', KEYS[1], 1, v) > 0 then
+		redis.call('RPUSH', KEYS[3], v)
+	end
+end
+return #list
+`)
+
+// 把到达重试时间的消息放回到订单队列
+// KEYS[1]：重试集合，KEYS[2]：订单队列，ARGV[1]：当前时间戳
+var requeueRetryScript = redis.NewScript(`
+local list = redis.call('ZRANGEBYSCORE', KEYS[1], 0, ARGV[1])
+for _, v in ipairs(list) do
+	redis.call('ZREM', KEYS[1], v)
+	redis.call('LPUSH', KEYS[2], v)
+end
+return #list
+`)
+
+// PrecreateOrderQueue 预创建订单队列
+type PrecreateOrderQueue struct {
+	redis *redis.Client
+	cfg   conf.Queue
+}
+
+// NewPrecreateOrderQueue 创建一个预创建订单队列，未配置或配置不大于 0 的项使用默认值
+func NewPrecreateOrderQueue(redis *redis.Client, cfg conf.Queue) *PrecreateOrderQueue {
+	if cfg.VisibilityTimeout <= 0 {
+		cfg.VisibilityTimeout = defaultVisibilityTimeout
+	}
+	if cfg.MaxRetry <= 0 {
+		cfg.MaxRetry = defaultMaxRetry
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = defaultRetryInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1
+	}
+	if cfg.PopTimeout <= 0 {
+		cfg.PopTimeout = defaultPopTimeout
+	}
+	return &PrecreateOrderQueue{redis: redis, cfg: cfg}
+}
+
+// precreateOrder 预创建订单消费者
 type precreateOrder struct {
+	*PrecreateOrderQueue
 	orderService service.IOrderService
-	redis *redis.Client
+	// 各个消费者的运行统计，下标为消费者编号
+	stats []*WorkerStats
+}
+
+// WorkerStats 订单消费者运行统计
+type WorkerStats struct {
+	// 消费者编号
+	Worker int `json:"worker"`
+	// 处理的批次数
+	Batches int64 `json:"batches"`
+	// 处理的消息数
+	Processed int64 `json:"processed"`
+	// 创建订单成功的消息数
+	Succeeded int64 `json:"succeeded"`
+	// 秒杀失败或进入死信队列的消息数
+	Failed int64 `json:"failed"`
+	// 进入重试的消息数
+	Retried int64 `json:"retried"`
+	// 最后一次处理消息的时间戳
+	LastActive int64 `json:"lastActive"`
 }
 
 // PrecreateOrderMsg 订单消息体
 type PrecreateOrderMsg struct {
-	UserId  int `json:"user_id"`
-	GoodsId int `json:"goods_id"`
+	OrderId string `json:"order_id"`
+	UserId  int    `json:"user_id"`
+	GoodsId int    `json:"goods_id"`
+	// 购买数量
+	Quantity int `json:"quantity"`
+	// 已重试次数
+	Retry int `json:"retry,omitempty"`
 }
 
-// Send 把订单消息推送到队列中
-func (mq *precreateOrder) Send(msg PrecreateOrderMsg) error {
+// Marshal 序列化订单消息
+func (msg PrecreateOrderMsg) Marshal() ([]byte, error) {
 	data, e := json.Marshal(msg)
 	if e != nil {
-		return code.SerializeErr
+		return nil, code.SerializeErr
 	}
-	return mq.redis.LPush(ctx, precreateOrderKey, data).Err()
+	return data, nil
 }
 
-// Receive 从队列中消费消息
-func (mq *precreateOrder) Receive() {
-	var (
-		popStr string	// 获取到的消息字符串
-		err    error
-	)
-	// 循环消费
-	for {
-		if popStr, err = mq.redis.RPop(ctx, precreateOrderKey).Result(); err != nil {
-			if err == redis.Nil {
-				err = nil
-			} else {
-				log.Printf("redis.BRPop() failed, err: %v", err)
-				return
-			}
+// GetQuantity 获取购买数量，未携带数量的消息为 1 件
+func (msg PrecreateOrderMsg) GetQuantity() int {
+	if msg.Quantity <= 0 {
+		return 1
+	}
+	return msg.Quantity
+}
+
+// Send 把订单消息推送到队列中
+func (mq *PrecreateOrderQueue) Send(msg PrecreateOrderMsg) error {
+	data, e := msg.Marshal()
+	if e != nil {
+		return e
+	}
+	return mq.redis.LPush(ctx, PrecreateOrderKey, data).Err()
+}
+
+// Receive 从队列中消费消息，worker 为消费者编号
+// 消息出队时会被原子地转移到处理中列表，订单入库或处理完成（失败、进入重试或进入死信队列）后才会被确认移除，
+// 消费者在处理过程中崩溃时，消息会在可见性超时后由 Recover 重新放回队列，保证消息至少被消费一次。
+// c 取消后，消费者处理完当前批次的消息再退出
+func (mq *precreateOrder) Receive(c context.Context, worker int) {
+	for c.Err() == nil {
+		batch := mq.pop(c)
+		if len(batch) == 0 {
+			continue
 		}
-		if len(popStr) == 0 {
-			// 队列中没有数据时，睡眠 0.5 秒
+		mq.handle(worker, batch)
+	}
+}
+
+// 阻塞等待第一条消息，再非阻塞地取出同一批次的其余消息
+// 消费者停止时不再等待新消息，已被转移到处理中列表的消息由 Recover 负责重新投递
+func (mq *precreateOrder) pop(c context.Context) (batch []string) {
+	cfg := mq.cfg
+	timeout := time.Duration(cfg.PopTimeout) * time.Second
+	popStr, err := mq.redis.BRPopLPush(c, PrecreateOrderKey, precreateOrderProcessingKey, timeout).Result()
+	if err != nil {
+		if err != redis.Nil && c.Err() == nil {
+			log.Printf("redis.BRPopLPush() failed, err: %v", err)
+			// redis 出错时，睡眠 0.5 秒
 			time.Sleep(500 * time.Millisecond)
-			continue
 		}
+		return
+	}
+	batch = append(batch, popStr)
+	for len(batch) < cfg.BatchSize {
+		if popStr, err = mq.redis.RPopLPush(ctx, PrecreateOrderKey, precreateOrderProcessingKey).Result(); err != nil {
+			if err != redis.Nil {
+				log.Printf("redis.RPopLPush() failed, err: %v", err)
+			}
+			break
+		}
+		batch = append(batch, popStr)
+	}
+	// 设置消息的可见性超时时间
+	deadline := float64(time.Now().Unix() + cfg.VisibilityTimeout)
+	members := make([]*redis.Z, len(batch))
+	for i, v := range batch {
+		members[i] = &redis.Z{Score: deadline, Member: v}
+	}
+	if err = mq.redis.ZAdd(ctx, precreateOrderDeadlineKey, members...).Err(); err != nil {
+		log.Printf("redis.ZAdd() failed, err: %v", err)
+	}
+	return
+}
+
+// 处理一批订单消息
+func (mq *precreateOrder) handle(worker int, batch []string) {
+	var (
+		raws []string
+		msgs []PrecreateOrderMsg
+		reqs []model.OrderRequest
+	)
+	stats := mq.stats[worker]
+	atomic.AddInt64(&stats.Batches, 1)
+	atomic.AddInt64(&stats.Processed, int64(len(batch)))
+	atomic.StoreInt64(&stats.LastActive, time.Now().Unix())
+	for _, popStr := range batch {
 		var msg PrecreateOrderMsg
-		if err = json.Unmarshal([]byte(popStr), &msg); err != nil {
+		if err := json.Unmarshal([]byte(popStr), &msg); err != nil || msg.GoodsId == 0 || msg.UserId == 0 {
+			// 无法解析的消息直接进入死信队列
+			log.Printf("订单消息【%s】格式错误, err: %v", popStr, err)
+			mq.deadLetter(popStr)
+			atomic.AddInt64(&stats.Failed, 1)
 			continue
 		}
-		if msg.GoodsId == 0 || msg.UserId == 0 {
+		raws = append(raws, popStr)
+		msgs = append(msgs, msg)
+		reqs = append(reqs, model.OrderRequest{
+			OrderId:  msg.OrderId,
+			UserId:   msg.UserId,
+			GoodsId:  msg.GoodsId,
+			Quantity: msg.GetQuantity(),
+		})
+	}
+	if len(reqs) == 0 {
+		return
+	}
+	// 创建订单，订单入库后立即确认消息，缩短消息在处理中列表里停留的时间，避免超时后被重复投递
+	acked := make([]bool, len(reqs))
+	errs := mq.orderService.CreateOrders(reqs, func(i int) {
+		mq.ack(raws[i])
+		acked[i] = true
+	})
+	for i, err := range errs {
+		popStr, msg := raws[i], msgs[i]
+		if err == nil {
+			if !acked[i] {
+				mq.ack(popStr)
+			}
+			atomic.AddInt64(&stats.Succeeded, 1)
+			if err = mq.orderService.UnLock(msg.UserId, msg.GoodsId); err != nil {
+				log.Printf("orderService.UnLocks() failed, err: %v", err)
+			}
 			continue
 		}
-		// 创建订单
-		if err = mq.orderService.CreateOrder(msg.UserId, msg.GoodsId); err != nil {
-			log.Printf("orderService.CreateOrder() failed, err: %v", err)
+		log.Printf("orderService.CreateOrder() failed, err: %v", err)
+		if errors.Is(err, code.GoodsSaleOut) || errors.Is(err, code.StockNotEnough) ||
+			errors.Is(err, code.PurchaseLimitErr) {
+			// 商品已售罄、库存不足或超出限购数量，重试也无法成功
+			var reason code.Code
+			errors.As(err, &reason)
+			mq.fail(msg, reason)
+			mq.ack(popStr)
+			atomic.AddInt64(&stats.Failed, 1)
 			continue
 		}
-		if err = mq.orderService.UnLock(msg.UserId, msg.GoodsId); err != nil {
-			log.Printf("orderService.UnLocks() failed, err: %v", err)
-			continue
+		// 订单已经入库时只需要重新投递补齐后续步骤，不能归还库存
+		if mq.retry(popStr, msg, acked[i]) {
+			atomic.AddInt64(&stats.Retried, 1)
+		} else {
+			atomic.AddInt64(&stats.Failed, 1)
+		}
+	}
+}
+
+// Stats 获取各个消费者的运行统计
+func (mq *precreateOrder) Stats() []WorkerStats {
+	list := make([]WorkerStats, len(mq.stats))
+	for i, v := range mq.stats {
+		list[i] = WorkerStats{
+			Worker:     v.Worker,
+			Batches:    atomic.LoadInt64(&v.Batches),
+			Processed:  atomic.LoadInt64(&v.Processed),
+			Succeeded:  atomic.LoadInt64(&v.Succeeded),
+			Failed:     atomic.LoadInt64(&v.Failed),
+			Retried:    atomic.LoadInt64(&v.Retried),
+			LastActive: atomic.LoadInt64(&v.LastActive),
+		}
+	}
+	return list
+}
+
+// 确认消息，把消息从处理中列表中移除
+func (mq *precreateOrder) ack(popStr string) {
+	if _, err := mq.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, precreateOrderProcessingKey, 1, popStr)
+		pipe.ZRem(ctx, precreateOrderDeadlineKey, popStr)
+		return nil
+	}); err != nil {
+		log.Printf("订单消息【%s】确认失败, err: %v", popStr, err)
+	}
+}
+
+// 消费失败的消息按指数退避进入重试集合，超过最大重试次数则进入死信队列，进入死信队列时返回 false
+// created 表示订单已经入库，此时进入死信队列不记录秒杀失败，也不归还库存
+func (mq *precreateOrder) retry(popStr string, msg PrecreateOrderMsg, created bool) bool {
+	c := mq.cfg
+	if msg.Retry >= c.MaxRetry {
+		if !created {
+			mq.fail(msg, code.SeckillFailedErr)
+		}
+		mq.deadLetter(popStr)
+		return false
+	}
+	msg.Retry++
+	data, err := msg.Marshal()
+	if err != nil {
+		mq.deadLetter(popStr)
+		return false
+	}
+	// 第 n 次重试的等待时间为 RetryInterval * 2^(n-1)
+	backoff := c.RetryInterval << uint(msg.Retry-1)
+	if _, err = mq.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, precreateOrderRetryKey, &redis.Z{
+			Score:  float64(time.Now().Unix() + backoff),
+			Member: string(data),
+		})
+		pipe.LRem(ctx, precreateOrderProcessingKey, 1, popStr)
+		pipe.ZRem(ctx, precreateOrderDeadlineKey, popStr)
+		return nil
+	}); err != nil {
+		log.Printf("订单消息【%s】加入重试队列失败, err: %v", popStr, err)
+		return true
+	}
+	log.Printf("订单消息【%s】将在 %d 秒后进行第 %d 次重试", popStr, backoff, msg.Retry)
+	return true
+}
+
+// 记录秒杀失败的结果并归还预减的库存
+func (mq *precreateOrder) fail(msg PrecreateOrderMsg, reason code.Code) {
+	if err := mq.orderService.FailSecondKill(msg.UserId, msg.GoodsId, msg.GetQuantity(), reason); err != nil {
+		log.Printf("orderService.FailSecondKill() failed, msg: %v, err: %v", msg, err)
+	}
+}
+
+// 把消息转移到死信队列
+func (mq *precreateOrder) deadLetter(popStr string) {
+	if _, err := mq.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, PrecreateOrderDeadLetterKey, popStr)
+		pipe.LRem(ctx, precreateOrderProcessingKey, 1, popStr)
+		pipe.ZRem(ctx, precreateOrderDeadlineKey, popStr)
+		return nil
+	}); err != nil {
+		log.Printf("订单消息【%s】加入死信队列失败, err: %v", popStr, err)
+		return
+	}
+	log.Printf("订单消息【%s】已加入死信队列", popStr)
+}
+
+// Recover 恢复处理超时与到达重试时间的消息
+func (mq *precreateOrder) Recover(c context.Context) {
+	for {
+		now := strconv.FormatInt(time.Now().Unix(), 10)
+		mq.watchProcessing()
+		keys := []string{precreateOrderProcessingKey, precreateOrderDeadlineKey, PrecreateOrderKey}
+		if n, err := requeueExpiredScript.Run(ctx, mq.redis, keys, now).Int(); err != nil {
+			log.Printf("requeueExpiredScript.Run() failed, err: %v", err)
+		} else if n > 0 {
+			log.Printf("%d 条处理超时的订单消息已重新入队", n)
 		}
+		keys = []string{precreateOrderRetryKey, PrecreateOrderKey}
+		if n, err := requeueRetryScript.Run(ctx, mq.redis, keys, now).Int(); err != nil {
+			log.Printf("requeueRetryScript.Run() failed, err: %v", err)
+		} else if n > 0 {
+			log.Printf("%d 条订单消息已重新入队等待重试", n)
+		}
+		select {
+		case <-c.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// 为处理中列表里还没有超时时间的消息补上超时时间
+// 消费者在消息出队后、设置超时时间前崩溃时，消息会遗留在处理中列表里
+func (mq *precreateOrder) watchProcessing() {
+	list, err := mq.redis.LRange(ctx, precreateOrderProcessingKey, 0, -1).Result()
+	if err != nil {
+		log.Printf("redis.LRange() failed, err: %v", err)
+		return
+	}
+	if len(list) == 0 {
+		return
 	}
-}
\ No newline at end of file
+	deadline := float64(time.Now().Unix() + mq.cfg.VisibilityTimeout)
+	members := make([]*redis.Z, len(list))
+	for i, v := range list {
+		members[i] = &redis.Z{Score: deadline, Member: v}
+	}
+	if err = mq.redis.ZAddNX(ctx, precreateOrderDeadlineKey, members...).Err(); err != nil {
+		log.Printf("redis.ZAddNX() failed, err: %v", err)
+	}
+}
+
+// InFlight 获取队列中还未确认的订单消息，包括等待消费、处理中和等待重试的消息
+// 处理中的消息对应的订单可能已经入库，由调用方排除
+func (mq *PrecreateOrderQueue) InFlight() (msgs []PrecreateOrderMsg, err error) {
+	var (
+		pending    *redis.StringSliceCmd
+		processing *redis.StringSliceCmd
+		retrying   *redis.StringSliceCmd
+	)
+	// 在同一个事务中读取，保证消息在几个队列之间转移时不会被重复统计或漏统计
+	if _, err = mq.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pending = pipe.LRange(ctx, PrecreateOrderKey, 0, -1)
+		processing = pipe.LRange(ctx, precreateOrderProcessingKey, 0, -1)
+		retrying = pipe.ZRange(ctx, precreateOrderRetryKey, 0, -1)
+		return nil
+	}); err != nil {
+		log.Printf("redis.TxPipelined() failed, err: %v", err)
+		err = code.RedisErr
+		return
+	}
+	for _, cmd := range []*redis.StringSliceCmd{pending, processing, retrying} {
+		for _, v := range cmd.Val() {
+			var msg PrecreateOrderMsg
+			if json.Unmarshal([]byte(v), &msg) == nil {
+				msgs = append(msgs, msg)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,298 @@
+package mq
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"seckill/conf"
+	"seckill/infra/code"
+	"seckill/model"
+	"seckill/service"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// 只实现订单消费者用到的方法的 service.IOrderService
+type fakeOrderService struct {
+	service.IOrderService
+	// 按订单编号返回的创建结果
+	errs map[string]error
+	// 在返回结果之前已经入库的订单编号
+	committed map[string]bool
+	failed    []code.Code
+	unlocked  int
+	// 每个订单入库后处理中列表的长度
+	processingAfterCommit []int64
+	redis                 *redis.Client
+}
+
+func (s *fakeOrderService) CreateOrders(list []model.OrderRequest, committed func(i int)) (errs []error) {
+	for i, r := range list {
+		if s.committed[r.OrderId] {
+			committed(i)
+			if s.redis != nil {
+				s.processingAfterCommit = append(s.processingAfterCommit, s.redis.LLen(ctx, precreateOrderProcessingKey).Val())
+			}
+		}
+		errs = append(errs, s.errs[r.OrderId])
+	}
+	return
+}
+
+func (s *fakeOrderService) FailSecondKill(userId, goodsId, quantity int, reason code.Code) error {
+	s.failed = append(s.failed, reason)
+	return nil
+}
+
+func (s *fakeOrderService) UnLock(userId, goodsId int) error {
+	s.unlocked++
+	return nil
+}
+
+// 创建连接到 miniredis 的订单消费者
+func newTestConsumer(t *testing.T, svc *fakeOrderService, cfg conf.Queue) (*miniredis.Miniredis, *precreateOrder) {
+	t.Helper()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	return mr, &precreateOrder{
+		PrecreateOrderQueue: NewPrecreateOrderQueue(rdb, cfg),
+		orderService:        svc,
+		stats:               []*WorkerStats{{}},
+	}
+}
+
+// 模拟消息已被消费者取出，处于处理中列表
+func processing(t *testing.T, mq *precreateOrder, msgs ...PrecreateOrderMsg) (batch []string) {
+	t.Helper()
+	for _, msg := range msgs {
+		data, err := msg.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mq.redis.LPush(ctx, precreateOrderProcessingKey, data)
+		mq.redis.ZAdd(ctx, precreateOrderDeadlineKey, &redis.Z{Score: float64(time.Now().Unix() + 30), Member: data})
+		batch = append(batch, string(data))
+	}
+	return
+}
+
+func TestHandle(t *testing.T) {
+	tests := []struct {
+		name      string
+		retry     int
+		err       error
+		committed bool
+		// 消息的去向：ack、retry 或 dead
+		want     string
+		failed   []code.Code
+		unlocked int
+	}{
+		{"创建订单成功", 0, nil, true, "ack", nil, 1},
+		{"商品已售罄", 0, code.GoodsSaleOut, false, "ack", []code.Code{code.GoodsSaleOut}, 0},
+		{"库存不足", 0, code.StockNotEnough, false, "ack", []code.Code{code.StockNotEnough}, 0},
+		{"超出限购", 0, code.PurchaseLimitErr, false, "ack", []code.Code{code.PurchaseLimitErr}, 0},
+		{"临时错误进入重试", 0, errors.New("db down"), false, "retry", nil, 0},
+		{"超过最大重试次数", defaultMaxRetry, errors.New("db down"), false, "dead", []code.Code{code.SeckillFailedErr}, 0},
+		{"订单已入库时不记录秒杀失败", defaultMaxRetry, errors.New("db down"), true, "dead", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := PrecreateOrderMsg{OrderId: "O1", UserId: 1, GoodsId: 1, Retry: tt.retry}
+			svc := &fakeOrderService{
+				errs:      map[string]error{"O1": tt.err},
+				committed: map[string]bool{"O1": tt.committed},
+			}
+			mr, mq := newTestConsumer(t, svc, conf.Queue{})
+			mq.handle(0, processing(t, mq, msg))
+			if mr.Exists(precreateOrderProcessingKey) || mr.Exists(precreateOrderDeadlineKey) {
+				t.Error("message is still in the processing list")
+			}
+			retrying, _ := mq.redis.ZRange(ctx, precreateOrderRetryKey, 0, -1).Result()
+			dead, _ := mr.List(PrecreateOrderDeadLetterKey)
+			switch tt.want {
+			case "ack":
+				if len(retrying) != 0 || len(dead) != 0 {
+					t.Errorf("retry = %v, dead letter = %v, want both empty", retrying, dead)
+				}
+			case "retry":
+				msg.Retry++
+				data, _ := msg.Marshal()
+				if len(retrying) != 1 || retrying[0] != string(data) || len(dead) != 0 {
+					t.Errorf("retry = %v, dead letter = %v, want [%s] and empty", retrying, dead, data)
+				}
+			case "dead":
+				if len(retrying) != 0 || len(dead) != 1 {
+					t.Errorf("retry = %v, dead letter = %v, want empty and one message", retrying, dead)
+				}
+			}
+			if len(svc.failed) != len(tt.failed) || len(tt.failed) > 0 && svc.failed[0] != tt.failed[0] {
+				t.Errorf("FailSecondKill() reasons = %v, want %v", svc.failed, tt.failed)
+			}
+			if svc.unlocked != tt.unlocked {
+				t.Errorf("UnLock() calls = %d, want %d", svc.unlocked, tt.unlocked)
+			}
+		})
+	}
+}
+
+// 无法解析或缺少必要字段的消息直接进入死信队列
+func TestHandleMalformed(t *testing.T) {
+	svc := &fakeOrderService{}
+	mr, mq := newTestConsumer(t, svc, conf.Queue{})
+	mq.redis.LPush(ctx, precreateOrderProcessingKey, "not json", `{"order_id":"O1"}`)
+	mq.handle(0, []string{"not json", `{"order_id":"O1"}`})
+	if dead, _ := mr.List(PrecreateOrderDeadLetterKey); len(dead) != 2 {
+		t.Errorf("dead letter = %v, want both messages", dead)
+	}
+	if mr.Exists(precreateOrderProcessingKey) {
+		t.Error("message is still in the processing list")
+	}
+}
+
+// 第 n 次重试的等待时间为 RetryInterval * 2^(n-1)
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		retry   int
+		backoff int64
+	}{
+		{0, 2},
+		{1, 4},
+		{2, 8},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.retry), func(t *testing.T) {
+			svc := &fakeOrderService{errs: map[string]error{"O1": errors.New("db down")}}
+			_, mq := newTestConsumer(t, svc, conf.Queue{RetryInterval: 2, MaxRetry: 5})
+			now := time.Now().Unix()
+			mq.handle(0, processing(t, mq, PrecreateOrderMsg{OrderId: "O1", UserId: 1, GoodsId: 1, Retry: tt.retry}))
+			list, err := mq.redis.ZRangeWithScores(ctx, precreateOrderRetryKey, 0, -1).Result()
+			if err != nil || len(list) != 1 {
+				t.Fatalf("retry = %v, err = %v, want one message", list, err)
+			}
+			if d := int64(list[0].Score) - now; d < tt.backoff || d > tt.backoff+1 {
+				t.Errorf("backoff = %d, want %d", d, tt.backoff)
+			}
+		})
+	}
+}
+
+func TestRequeueExpiredScript(t *testing.T) {
+	_, mq := newTestConsumer(t, &fakeOrderService{}, conf.Queue{})
+	now := time.Now().Unix()
+	mq.redis.LPush(ctx, precreateOrderProcessingKey, "expired", "alive")
+	mq.redis.ZAdd(ctx, precreateOrderDeadlineKey,
+		&redis.Z{Score: float64(now - 1), Member: "expired"},
+		&redis.Z{Score: float64(now + 30), Member: "alive"},
+		// 已经确认但超时时间还没有移除的消息不能重新入队
+		&redis.Z{Score: float64(now - 1), Member: "acked"},
+	)
+	keys := []string{precreateOrderProcessingKey, precreateOrderDeadlineKey, PrecreateOrderKey}
+	n, err := requeueExpiredScript.Run(ctx, mq.redis, keys, now).Int()
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue, _ := mq.redis.LRange(ctx, PrecreateOrderKey, 0, -1).Result()
+	processing, _ := mq.redis.LRange(ctx, precreateOrderProcessingKey, 0, -1).Result()
+	deadlines, _ := mq.redis.ZRange(ctx, precreateOrderDeadlineKey, 0, -1).Result()
+	if n != 2 || len(queue) != 1 || queue[0] != "expired" {
+		t.Errorf("requeueExpiredScript = %d, queue = %v, want 2 and [expired]", n, queue)
+	}
+	if len(processing) != 1 || processing[0] != "alive" || len(deadlines) != 1 || deadlines[0] != "alive" {
+		t.Errorf("processing = %v, deadlines = %v, want only alive", processing, deadlines)
+	}
+}
+
+func TestRequeueRetryScript(t *testing.T) {
+	_, mq := newTestConsumer(t, &fakeOrderService{}, conf.Queue{})
+	now := time.Now().Unix()
+	mq.redis.ZAdd(ctx, precreateOrderRetryKey,
+		&redis.Z{Score: float64(now), Member: "due"},
+		&redis.Z{Score: float64(now + 10), Member: "later"},
+	)
+	keys := []string{precreateOrderRetryKey, PrecreateOrderKey}
+	n, err := requeueRetryScript.Run(ctx, mq.redis, keys, now).Int()
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue, _ := mq.redis.LRange(ctx, PrecreateOrderKey, 0, -1).Result()
+	retrying, _ := mq.redis.ZRange(ctx, precreateOrderRetryKey, 0, -1).Result()
+	if n != 1 || len(queue) != 1 || queue[0] != "due" || len(retrying) != 1 || retrying[0] != "later" {
+		t.Errorf("requeueRetryScript = %d, queue = %v, retry = %v, want 1, [due], [later]", n, queue, retrying)
+	}
+}
+
+// 一批消息中的订单入库后立即确认，不等待同批次的其他订单
+func TestHandleBatchAck(t *testing.T) {
+	svc := &fakeOrderService{
+		errs:      map[string]error{"O3": code.GoodsSaleOut},
+		committed: map[string]bool{"O1": true, "O2": true},
+	}
+	mr, mq := newTestConsumer(t, svc, conf.Queue{BatchSize: 3})
+	svc.redis = mq.redis
+	mq.handle(0, processing(t, mq,
+		PrecreateOrderMsg{OrderId: "O1", UserId: 1, GoodsId: 1},
+		PrecreateOrderMsg{OrderId: "O2", UserId: 2, GoodsId: 1},
+		PrecreateOrderMsg{OrderId: "O3", UserId: 3, GoodsId: 1},
+	))
+	if len(svc.processingAfterCommit) != 2 || svc.processingAfterCommit[0] != 2 || svc.processingAfterCommit[1] != 1 {
+		t.Errorf("processing list after each commit = %v, want [2 1]", svc.processingAfterCommit)
+	}
+	if mr.Exists(precreateOrderProcessingKey) {
+		t.Error("message is still in the processing list")
+	}
+	stats := mq.Stats()[0]
+	if stats.Batches != 1 || stats.Processed != 3 || stats.Succeeded != 2 || stats.Failed != 1 || stats.Retried != 0 {
+		t.Errorf("Stats() = %+v, want 1 batch, 3 processed, 2 succeeded, 1 failed", stats)
+	}
+}
+
+// 阻塞等待第一条消息后取出同一批次的其余消息，并设置可见性超时时间
+func TestPop(t *testing.T) {
+	_, mq := newTestConsumer(t, &fakeOrderService{}, conf.Queue{BatchSize: 2, VisibilityTimeout: 30})
+	for _, id := range []string{"O1", "O2", "O3"} {
+		if err := mq.Send(PrecreateOrderMsg{OrderId: id, UserId: 1, GoodsId: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now().Unix()
+	batch := mq.pop(ctx)
+	if len(batch) != 2 {
+		t.Fatalf("pop() = %v, want 2 messages", batch)
+	}
+	for i, id := range []string{"O1", "O2"} {
+		var msg PrecreateOrderMsg
+		if err := json.Unmarshal([]byte(batch[i]), &msg); err != nil || msg.OrderId != id {
+			t.Errorf("batch[%d] = %s, want order %s", i, batch[i], id)
+		}
+		score, err := mq.redis.ZScore(ctx, precreateOrderDeadlineKey, batch[i]).Result()
+		if err != nil || int64(score) < now+30 || int64(score) > now+31 {
+			t.Errorf("deadline of batch[%d] = %v, err = %v, want %d", i, score, err, now+30)
+		}
+	}
+	if n := mq.redis.LLen(ctx, precreateOrderProcessingKey).Val(); n != 2 {
+		t.Errorf("processing list length = %d, want 2", n)
+	}
+	if n := mq.redis.LLen(ctx, PrecreateOrderKey).Val(); n != 1 {
+		t.Errorf("queue length = %d, want 1", n)
+	}
+}
+
+func TestNewPrecreateOrderQueueDefaults(t *testing.T) {
+	q := NewPrecreateOrderQueue(nil, conf.Queue{VisibilityTimeout: -1, MaxRetry: -1})
+	want := conf.Queue{
+		VisibilityTimeout: defaultVisibilityTimeout,
+		MaxRetry:          defaultMaxRetry,
+		RetryInterval:     defaultRetryInterval,
+		BatchSize:         1,
+		PopTimeout:        defaultPopTimeout,
+	}
+	if q.cfg != want {
+		t.Errorf("cfg = %+v, want %+v", q.cfg, want)
+	}
+}
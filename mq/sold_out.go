@@ -0,0 +1,60 @@
+package mq
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"log"
+	"seckill/service"
+	"strconv"
+)
+
+const (
+	// 商品售罄标识失效通知频道
+	soldOutChannel = "goods_sold_out_channel"
+)
+
+// SoldOutNotifier 商品售罄标识失效通知
+type SoldOutNotifier struct {
+	redis *redis.Client
+}
+
+// NewSoldOutNotifier 创建一个商品售罄标识失效通知
+func NewSoldOutNotifier(redis *redis.Client) *SoldOutNotifier {
+	return &SoldOutNotifier{redis: redis}
+}
+
+// soldOut 商品售罄标识失效通知的订阅者
+type soldOut struct {
+	*SoldOutNotifier
+	goodsService service.IGoodsService
+}
+
+// Publish 通知所有实例清除商品的本地售罄标识
+func (mq *SoldOutNotifier) Publish(goodsId int) {
+	if err := mq.redis.Publish(ctx, soldOutChannel, goodsId).Err(); err != nil {
+		log.Printf("商品【%d】售罄标识失效通知发送失败, err: %v", goodsId, err)
+	}
+}
+
+// Receive 订阅售罄标识失效通知，清除本实例的售罄标识
+func (mq *soldOut) Receive(c context.Context) {
+	pubsub := mq.redis.Subscribe(ctx, soldOutChannel)
+	defer pubsub.Close()
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-c.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			goodsId, err := strconv.Atoi(msg.Payload)
+			if err != nil {
+				log.Printf("售罄标识失效通知【%s】格式错误, err: %v", msg.Payload, err)
+				continue
+			}
+			mq.goodsService.ClearLocalSoldOut(goodsId)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"seckill/conf"
+	"seckill/infra/code"
+	"seckill/infra/utils/key"
+	"seckill/payment"
+	"sync"
+	"time"
+)
+
+// Name 本地模拟支付网关名称
+const Name = "mock"
+
+// mockGateway 本地模拟支付网关，用于本地开发与测试
+// 发起支付后会在配置的延迟时间之后向回调地址发送支付成功的签名回调
+type mockGateway struct {
+	// 支付配置信息
+	cfg conf.Payment
+	// 支付回调签名密钥
+	secret string
+	// 已发起的支付，key 为支付流水号，value 为 payment.QueryResponse
+	payments sync.Map
+	// 已完成的退款，key 为退款单号，value 为退款交易号
+	refunds sync.Map
+}
+
+// New 创建一个本地模拟支付网关
+func New(cfg conf.Payment, secret string) *mockGateway {
+	return &mockGateway{cfg: cfg, secret: secret}
+}
+
+func (g *mockGateway) Name() string {
+	return Name
+}
+
+func (g *mockGateway) Pay(req payment.PayRequest) (res payment.PayResponse, e error) {
+	res.TradeNo = "MOCK" + time.Now().Format("20060102150405") + key.CreateKey(key.Number, 6)
+	res.PayUrl = "mock://pay/" + req.PaymentNo
+	g.payments.Store(req.PaymentNo, payment.QueryResponse{
+		Status:  payment.QueryPaying,
+		TradeNo: res.TradeNo,
+		Amount:  payment.FormatAmount(req.Amount),
+	})
+	delay := g.cfg.MockNotifyDelay
+	if delay > 0 {
+		go func() {
+			time.Sleep(time.Duration(delay) * time.Second)
+			g.notify(req, res.TradeNo)
+		}()
+	}
+	return
+}
+
+func (g *mockGateway) Refund(req payment.RefundRequest) (res payment.RefundResponse, e error) {
+	tradeNo := "MOCKR" + time.Now().Format("20060102150405") + key.CreateKey(key.Number, 6)
+	v, _ := g.refunds.LoadOrStore(req.RefundNo, tradeNo)
+	res.RefundTradeNo = v.(string)
+	log.Printf("支付【%s】模拟退款完成, refundNo: %s", req.PaymentNo, req.RefundNo)
+	return
+}
+
+func (g *mockGateway) Query(paymentNo string) (res payment.QueryResponse, e error) {
+	v, ok := g.payments.Load(paymentNo)
+	if !ok {
+		// 服务重启后模拟网关不再保留支付记录，按支付失败处理
+		return payment.QueryResponse{Status: payment.NotifyFail}, nil
+	}
+	return v.(payment.QueryResponse), nil
+}
+
+func (g *mockGateway) VerifyNotify(n payment.Notify) error {
+	if !payment.VerifySign(n.Params(), g.secret, n.Sign) {
+		return code.PaymentSignErr
+	}
+	return nil
+}
+
+// 模拟支付网关的异步回调
+func (g *mockGateway) notify(req payment.PayRequest, tradeNo string) {
+	n := payment.Notify{
+		PaymentNo: req.PaymentNo,
+		TradeNo:   tradeNo,
+		OrderId:   req.OrderId,
+		Amount:    payment.FormatAmount(req.Amount),
+		Status:    payment.NotifySuccess,
+		Timestamp: time.Now().Unix(),
+	}
+	// 模拟用户完成支付
+	g.payments.Store(req.PaymentNo, payment.QueryResponse{
+		Status:  n.Status,
+		TradeNo: n.TradeNo,
+		Amount:  n.Amount,
+	})
+	n.Sign = payment.Sign(n.Params(), g.secret)
+	data, err := json.Marshal(n)
+	if err != nil {
+		log.Printf("json.Marshal() failed, err: %v", err)
+		return
+	}
+	resp, err := http.Post(g.cfg.NotifyUrl, "application/json", bytes.NewReader(data))
+	if err != nil {
+		log.Printf("支付【%s】模拟回调失败, err: %v", req.PaymentNo, err)
+		return
+	}
+	_ = resp.Body.Close()
+	log.Printf("支付【%s】模拟回调完成, status: %s", req.PaymentNo, resp.Status)
+}
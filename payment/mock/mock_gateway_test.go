@@ -0,0 +1,87 @@
+package mock
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"seckill/conf"
+	"seckill/infra/code"
+	"seckill/payment"
+	"testing"
+)
+
+func TestPayAndNotify(t *testing.T) {
+	notified := make(chan payment.Notify, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n payment.Notify
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Error(err)
+		}
+		notified <- n
+	}))
+	defer server.Close()
+	g := New(conf.Payment{NotifyUrl: server.URL}, "secret")
+	req := payment.PayRequest{PaymentNo: "P1", OrderId: "O1", Amount: 9.9}
+	res, err := g.Pay(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q, _ := g.Query("P1"); q.Status != payment.QueryPaying || q.TradeNo != res.TradeNo || q.Amount != "9.90" {
+		t.Errorf("Query() before notify = %+v, want paying", q)
+	}
+	g.notify(req, res.TradeNo)
+	n := <-notified
+	if err := g.VerifyNotify(n); err != nil {
+		t.Errorf("VerifyNotify() error = %v", err)
+	}
+	if n.Status != payment.NotifySuccess || n.OrderId != "O1" || n.Amount != "9.90" {
+		t.Errorf("notify = %+v, want success", n)
+	}
+	if q, _ := g.Query("P1"); q.Status != payment.NotifySuccess {
+		t.Errorf("Query() after notify = %+v, want success", q)
+	}
+}
+
+func TestVerifyNotify(t *testing.T) {
+	g := New(conf.Payment{}, "secret")
+	signed := func(n payment.Notify, secret string) payment.Notify {
+		n.Sign = payment.Sign(n.Params(), secret)
+		return n
+	}
+	n := payment.Notify{PaymentNo: "P1", OrderId: "O1", Amount: "9.90", Status: payment.NotifySuccess, Timestamp: 1}
+	tampered := signed(n, "secret")
+	tampered.Amount = "0.01"
+	tests := []struct {
+		name   string
+		notify payment.Notify
+		want   error
+	}{
+		{"签名正确", signed(n, "secret"), nil},
+		{"密钥错误", signed(n, "other"), code.PaymentSignErr},
+		{"金额被篡改", tampered, code.PaymentSignErr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := g.VerifyNotify(tt.notify); err != tt.want {
+				t.Errorf("VerifyNotify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryUnknown(t *testing.T) {
+	if q, _ := New(conf.Payment{}, "secret").Query("P1"); q.Status != payment.NotifyFail {
+		t.Errorf("Query() unknown payment = %+v, want fail", q)
+	}
+}
+
+// 同一个退款单号多次退款只会退款一次
+func TestRefundIdempotent(t *testing.T) {
+	g := New(conf.Payment{}, "secret")
+	first, _ := g.Refund(payment.RefundRequest{RefundNo: "R1", PaymentNo: "P1"})
+	second, _ := g.Refund(payment.RefundRequest{RefundNo: "R1", PaymentNo: "P1"})
+	other, _ := g.Refund(payment.RefundRequest{RefundNo: "R2", PaymentNo: "P1"})
+	if first.RefundTradeNo == "" || first != second || other == first {
+		t.Errorf("Refund() = %v, %v, %v, want the same trade no for the same refund no", first, second, other)
+	}
+}
@@ -0,0 +1,127 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// NotifySuccess 支付成功的回调状态
+	NotifySuccess = "SUCCESS"
+	// NotifyFail 支付失败的回调状态
+	NotifyFail = "FAIL"
+	// QueryPaying 查询支付结果时，用户还未完成支付的状态
+	QueryPaying = "PAYING"
+)
+
+// IPaymentGateway 支付网关接口，接入新的支付渠道时实现该接口并在 app.newPaymentGateway 中按名称装配即可
+type IPaymentGateway interface {
+	// Name 支付网关名称
+	Name() string
+	// Pay 向支付网关发起支付
+	Pay(req PayRequest) (PayResponse, error)
+	// Query 向支付网关查询支付结果，用于回调丢失时主动确认支付状态
+	Query(paymentNo string) (QueryResponse, error)
+	// VerifyNotify 校验支付网关异步回调的签名
+	VerifyNotify(n Notify) error
+	// Refund 向支付网关发起退款，同一个退款单号多次调用只会退款一次
+	Refund(req RefundRequest) (RefundResponse, error)
+}
+
+// PayRequest 发起支付的请求参数
+type PayRequest struct {
+	PaymentNo string
+	OrderId   string
+	Amount    float64
+	Subject   string
+}
+
+// PayResponse 发起支付的响应结果
+type PayResponse struct {
+	// 支付网关交易号
+	TradeNo string
+	// 支付页面地址
+	PayUrl string
+}
+
+// QueryResponse 查询支付结果的响应结果
+type QueryResponse struct {
+	// 支付状态，SUCCESS、FAIL 或 PAYING
+	Status string
+	// 支付网关交易号
+	TradeNo string
+	// 支付金额，保留两位小数
+	Amount string
+}
+
+// RefundRequest 发起退款的请求参数
+type RefundRequest struct {
+	RefundNo  string
+	PaymentNo string
+	TradeNo   string
+	Amount    float64
+	Reason    string
+}
+
+// RefundResponse 发起退款的响应结果
+type RefundResponse struct {
+	// 支付网关退款交易号
+	RefundTradeNo string
+}
+
+// Notify 支付网关异步回调参数
+type Notify struct {
+	PaymentNo string `json:"paymentNo" binding:"required"`
+	TradeNo   string `json:"tradeNo"`
+	OrderId   string `json:"orderId" binding:"required"`
+	// 支付金额，保留两位小数
+	Amount string `json:"amount" binding:"required"`
+	// 支付状态，SUCCESS 或 FAIL
+	Status    string `json:"status" binding:"required"`
+	Timestamp int64  `json:"timestamp" binding:"required"`
+	Sign      string `json:"sign" binding:"required"`
+}
+
+// Params 获取参与签名的回调参数
+func (n Notify) Params() map[string]string {
+	return map[string]string{
+		"paymentNo": n.PaymentNo,
+		"tradeNo":   n.TradeNo,
+		"orderId":   n.OrderId,
+		"amount":    n.Amount,
+		"status":    n.Status,
+		"timestamp": strconv.FormatInt(n.Timestamp, 10),
+	}
+}
+
+// FormatAmount 格式化支付金额
+func FormatAmount(amount float64) string {
+	return fmt.Sprintf("%.2f", amount)
+}
+
+// Sign 对参数进行签名
+// 参数按 key 的字典序排序后以 k1=v1&k2=v2 的格式拼接，再使用 HMAC-SHA256 计算签名
+func Sign(params map[string]string, secret string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + params[k]
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join(pairs, "&")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySign 校验签名
+func VerifySign(params map[string]string, secret, sign string) bool {
+	return hmac.Equal([]byte(Sign(params, secret)), []byte(sign))
+}
@@ -0,0 +1,57 @@
+package payment
+
+import "testing"
+
+func TestVerifySign(t *testing.T) {
+	params := map[string]string{"paymentNo": "P1", "orderId": "O1", "amount": "9.90", "status": NotifySuccess}
+	sign := Sign(params, "secret")
+	tampered := map[string]string{"paymentNo": "P1", "orderId": "O1", "amount": "0.01", "status": NotifySuccess}
+	extra := map[string]string{"paymentNo": "P1", "orderId": "O1", "amount": "9.90", "status": NotifySuccess, "x": ""}
+	tests := []struct {
+		name   string
+		params map[string]string
+		secret string
+		sign   string
+		want   bool
+	}{
+		{"签名正确", params, "secret", sign, true},
+		{"参数被篡改", tampered, "secret", sign, false},
+		{"多出参数", extra, "secret", sign, false},
+		{"密钥错误", params, "other", sign, false},
+		{"签名为空", params, "secret", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifySign(tt.params, tt.secret, tt.sign); got != tt.want {
+				t.Errorf("VerifySign() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 参数按 key 的字典序以 k1=v1&k2=v2 拼接，与 map 的遍历顺序无关
+func TestSign(t *testing.T) {
+	// echo -n 'a=1&b=2' | openssl dgst -sha256 -hmac secret
+	const want = "604fe97c66c6393ff22e3cae366eee1131e351ebc736bf12f5d62e1755b7a233"
+	for i := 0; i < 10; i++ {
+		if got := Sign(map[string]string{"b": "2", "a": "1"}, "secret"); got != want {
+			t.Fatalf("Sign() = %s, want %s", got, want)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		amount float64
+		want   string
+	}{
+		{9.9, "9.90"},
+		{0.1 + 0.2, "0.30"},
+		{100, "100.00"},
+	}
+	for _, tt := range tests {
+		if got := FormatAmount(tt.amount); got != tt.want {
+			t.Errorf("FormatAmount(%v) = %q, want %q", tt.amount, got, tt.want)
+		}
+	}
+}
@@ -3,39 +3,51 @@ package router
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
+	"github.com/go-redis/redis/v8"
 	"github.com/swaggo/files"       // swagger embed files
 	"github.com/swaggo/gin-swagger" // gin-swagger middleware
 	"gopkg.in/go-playground/validator.v9"
 	"net/http"
 	"reflect"
+	"seckill/conf"
 	"seckill/handler"
+	"seckill/infra/secret"
 	"seckill/infra/utils/response"
 	"seckill/middleware"
 	"seckill/model"
-	"seckill/mq"
-	"seckill/service/goods"
-	"seckill/service/order"
-	"seckill/service/user"
+	"seckill/service"
 
 	// swagger 文档生成在本项目中的目录，必须导入这个目录文档才能正常显示
 	_ "seckill/docs" // docs is generated by Swag CLI, you have to import it.
 )
 
-var (
-	// 全局路由引擎
-	myRouter *gin.Engine
-
-	goodsHandler *handler.GoodsHandler
-	userHandler *handler.UserHandler
-	orderHandler *handler.OrderHandler
-)
+// Handlers 路由依赖的 handler 集合
+type Handlers struct {
+	Goods *handler.GoodsHandler
+	User  *handler.UserHandler
+	Order *handler.OrderHandler
+	Stock *handler.StockHandler
+	Queue *handler.QueueHandler
+	Jwks  *handler.JwksHandler
+	Role  *handler.RoleHandler
+}
 
-func init() {
-	myRouter = gin.Default()
+// New 创建路由引擎并注册中间件与路由
+func New(h Handlers, rateLimit conf.RateLimit, redis *redis.Client, userService service.IUserService, roleService service.IRoleService,
+	jwt *secret.JWT) *gin.Engine {
+	myRouter := gin.Default()
 	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
 		// 注册 model.LocalTime 类型的自定义校验规则
 		v.RegisterCustomTypeFunc(ValidateJSONDateType, model.LocalTime{})
 	}
+	//myRouter.Use(middleware.CostumerLog())
+	myRouter.Use(middleware.Cors())
+	myRouter.Use(middleware.SysLimit(rateLimit))
+	myRouter.Use(middleware.UserLimit(redis, rateLimit))
+
+	swaggerRouter(myRouter)
+	customRouter(myRouter, h, middleware.Auth(userService, roleService, jwt))
+	return myRouter
 }
 
 // ValidateJSONDateType 解决验证器 binding:"required" 无法正常工作的问题
@@ -52,37 +64,6 @@ func ValidateJSONDateType(field reflect.Value) interface{} {
 	return nil
 }
 
-// InitRouter 初始化路由器
-func InitRouter() * gin.Engine{
-	//myRouter.Use(middleware.CostumerLog())
-	myRouter.Use(middleware.Cors())
-	myRouter.Use(middleware.SysLimit())
-	myRouter.Use(middleware.UserLimit())
-
-	initService()
-	initHandler()
-	swaggerRouter()
-	customRouter()
-
-	mq.Run()
-	return myRouter
-}
-
-// 初始化 service 层
-func initService() {
-	defer mq.Init()
-	goods.InitService()
-	order.InitService()
-	user.InitService()
-}
-
-// 初始化 handler 层
-func initHandler() {
-	goodsHandler = handler.NewGoodsHandler()
-	userHandler = handler.NewUserHandler()
-	orderHandler = handler.NewOrderHandler()
-}
-
 // SwaggerRouter swagger 路由
 // 文档访问地址：http://localhost:8080/swagger/index.html
 // @title Gin swagger
@@ -93,13 +74,13 @@ func initHandler() {
 // @license.name Apache 2.0
 // @license.url http://www.apache.org/licenses/LICENSE-2.0.html
 // @host localhost:8080
-func swaggerRouter() {
+func swaggerRouter(myRouter *gin.Engine) {
 	// The url pointing to API definition
 	url := ginSwagger.URL("http://localhost:8080/swagger/doc.json")
 	myRouter.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, url))
 }
 
-func customRouter() {
+func customRouter(myRouter *gin.Engine, h Handlers, auth gin.HandlerFunc) {
 	// 首页
 	indexGroup := myRouter.Group("/")
 	{
@@ -113,36 +94,61 @@ func customRouter() {
 			return
 		})
 	}
+	// 令牌校验公钥
+	myRouter.GET("/.well-known/jwks.json", h.Jwks.Keys)
 	// 业务接口
 	api := myRouter.Group("/api")
 	{
 		userGroup := api.Group("/user")
 		{
-			userGroup.POST("/register", userHandler.Register)
-			userGroup.POST("/login", userHandler.Login)
-			userGroup.POST("/logout", userHandler.Logout)
+			userGroup.POST("/register", h.User.Register)
+			userGroup.POST("/login", h.User.Login)
+			userGroup.POST("/token/refresh", h.User.RefreshToken)
+			userGroup.POST("/logout", auth, h.User.Logout)
+			userGroup.POST("/logout/all", auth, h.User.LogoutAll)
 		}
 
 		goodsGroup := api.Group("/goods")
 		{
-			goodsGroup.GET("/:id", goodsHandler.QueryGoodsVOByID)
-			goodsGroup.POST("/list", goodsHandler.QueryGoodsVOByCondition)
-			goodsGroup.POST("/", middleware.Auth(), middleware.SellerAuth(), goodsHandler.Insert)
-			goodsGroup.PUT("/", middleware.Auth(), middleware.SellerAuth(), goodsHandler.Update)
-			goodsGroup.DELETE("/:id", middleware.Auth(), middleware.SellerAuth(), goodsHandler.Delete)
-			goodsGroup.POST("/seckillInit", middleware.Auth(), middleware.SellerAuth(), goodsHandler.SecondKillGoodsInit)
+			goodsGroup.GET("/:id", h.Goods.QueryGoodsVOByID)
+			goodsGroup.POST("/list", h.Goods.QueryGoodsVOByCondition)
+			goodsGroup.POST("/", auth, middleware.RequirePermission(model.PermGoodsWrite), h.Goods.Insert)
+			goodsGroup.PUT("/", auth, middleware.RequirePermission(model.PermGoodsWrite), h.Goods.Update)
+			goodsGroup.DELETE("/:id", auth, middleware.RequirePermission(model.PermGoodsWrite), h.Goods.Delete)
+			goodsGroup.POST("/seckillInit", auth, middleware.RequirePermission(model.PermGoodsWrite), h.Goods.SecondKillGoodsInit)
 		}
 
 		seckill := api.Group("/seckill")
 		{
-			seckill.POST("/", middleware.Auth(), orderHandler.SecondKill)
-			seckill.GET("/:goodsId", middleware.Auth(), orderHandler.GetSecondKillResult)
+			seckill.GET("/captcha/:goodsId", auth, middleware.RequirePermission(model.PermOrderWrite), h.Order.GetCaptcha)
+			seckill.GET("/path/:goodsId", auth, middleware.RequirePermission(model.PermOrderWrite), h.Order.GetSecondKillPath)
+			seckill.POST("/:path", auth, middleware.RequirePermission(model.PermOrderWrite), h.Order.SecondKill)
+			seckill.GET("/:goodsId", auth, h.Order.GetSecondKillResult)
 		}
 
 		orderGroup := api.Group("/order")
 		{
-			orderGroup.GET("/:id", middleware.Auth(), orderHandler.QueryByID)
-			orderGroup.POST("/list", middleware.Auth(), orderHandler.QueryByCondition)
+			orderGroup.GET("/:id", auth, h.Order.QueryByID)
+			orderGroup.POST("/list", auth, h.Order.QueryByCondition)
+			orderGroup.GET("/:id/history", auth, h.Order.QueryStatusHistory)
+			orderGroup.POST("/:id/pay", auth, middleware.RequirePermission(model.PermOrderWrite), h.Order.Pay)
+			orderGroup.POST("/:id/cancel", auth, middleware.RequirePermission(model.PermOrderWrite), h.Order.Cancel)
+			orderGroup.POST("/:id/refund", auth, middleware.RequirePermission(model.PermOrderWrite), h.Order.RequestRefund)
+			orderGroup.POST("/:id/refund/audit", auth, middleware.RequirePermission(model.PermRefundAudit), h.Order.AuditRefund)
+		}
+
+		adminGroup := api.Group("/admin", auth)
+		{
+			adminGroup.POST("/stock/reconcile", middleware.RequirePermission(model.PermStockReconcile), h.Stock.Reconcile)
+			adminGroup.GET("/queue/stats", middleware.RequirePermission(model.PermQueueRead), h.Queue.WorkerStats)
+			adminGroup.GET("/users/:id/roles", middleware.RequirePermission(model.PermRoleManage), h.Role.QueryUserRoles)
+			adminGroup.POST("/users/:id/roles", middleware.RequirePermission(model.PermRoleManage), h.Role.Grant)
+			adminGroup.DELETE("/users/:id/roles/:role", middleware.RequirePermission(model.PermRoleManage), h.Role.Revoke)
+		}
+
+		paymentGroup := api.Group("/payment")
+		{
+			paymentGroup.POST("/notify", h.Order.PaymentNotify)
 		}
 	}
 }
\ No newline at end of file
@@ -8,45 +8,62 @@ import (
 	"github.com/go-redis/redis/v8"
 	"github.com/jinzhu/gorm"
 	"log"
+	"seckill/conf"
 	"seckill/dao"
-	"seckill/infra/cache"
 	"seckill/infra/code"
 	"seckill/infra/utils/bean"
 	"seckill/model"
-	"seckill/service"
+	"seckill/mq"
 	"sync"
 	"time"
 )
 
 var (
-	once sync.Once
-	ctx  = context.Background()
+	ctx = context.Background()
 )
 
+// incrStockScript 返还库存缓存，库存缓存不存在时不做处理
+// 库存缓存还未预热或已被清理时，预热会从数据库重新加载库存，这里不能凭空创建一个没有过期时间的库存缓存
+// KEYS[1]：商品库存缓存 key，KEYS[2]：商品售罄标识 key，ARGV[1]：返还的数量
+var incrStockScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('INCRBY', KEYS[1], ARGV[1])
+redis.call('DEL', KEYS[2])
+return 1
+`)
+
 const (
 	CacheKey      = "goods:%d"       // 商品缓存key格式
 	CacheExpire   = 12 * time.Hour   // 缓存过期时间
 	GoodsStockKey = "goods_stock:%d" // 商品库存key格式
 )
 
-// InitService 单例模式初始化 IGoodsService 接口实例
-func InitService() {
-	once.Do(func() {
-		service.GoodsService = newGoodsService()
-	})
-}
-
 // service.IGoodsService 接口实现
 type goodsService struct {
 	dao   dao.IGoodsDao
 	redis *redis.Client
+	// 本实例的商品售罄标识，goodsId -> 标记时间
+	soldOut *sync.Map
+	// 售罄标识失效通知
+	soldOutNotifier *mq.SoldOutNotifier
+	// 商品预热配置信息
+	warmUp conf.WarmUp
+	// 订单超时时间，单位：秒
+	orderExpiration int64
 }
 
 // NewGoodsService 创建一个 service.IGoodsService 接口实例
-func newGoodsService() *goodsService {
+func NewGoodsService(goodsDao dao.IGoodsDao, redis *redis.Client, soldOutNotifier *mq.SoldOutNotifier,
+	warmUp conf.WarmUp, orderExpiration int64) *goodsService {
 	return &goodsService{
-		dao:   dao.GoodsDao,
-		redis: cache.Client,
+		dao:             goodsDao,
+		redis:           redis,
+		soldOut:         &sync.Map{},
+		soldOutNotifier: soldOutNotifier,
+		warmUp:          warmUp,
+		orderExpiration: orderExpiration,
 	}
 }
 
@@ -150,22 +167,35 @@ func (s *goodsService) FindGoodsVOByID(id int) (vo model.GoodsVO, e error) {
 	return vo, nil
 }
 
-func (s *goodsService) FindByCondition(c model.GoodsQueryCondition) ([]model.GoodsVO, error) {
-	goodsList, e := s.dao.QueryByCondition(c)
+func (s *goodsService) FindByCondition(c model.GoodsQueryCondition) (page model.PageVO, e error) {
+	if e = c.Validate(); e != nil {
+		return
+	}
+	goodsList, rows, e := s.dao.QueryByCondition(c)
 	if e != nil {
 		log.Println(e)
 		e = code.DBErr
-		return nil, e
+		return
 	}
 	list := make([]model.GoodsVO, 0)
 	for _, v := range goodsList {
 		vo, err := v.ToVO()
 		if err != nil {
-			return nil, err
+			return page, err
 		}
 		list = append(list, vo)
 	}
-	return list, nil
+	return model.NewPageVO(list, c.PageDTO, rows), nil
+}
+
+func (s *goodsService) Authorize(p model.Principal, goodsId int, override string) (g model.Goods, e error) {
+	if g, e = s.FindGoodsByID(goodsId); e != nil {
+		return
+	}
+	if !p.CanManage(g.UserId, override) {
+		e = code.StatusForbiddenErr
+	}
+	return
 }
 
 func (s *goodsService) Insert(dto model.GoodsDTO) error {
@@ -177,11 +207,12 @@ func (s *goodsService) Insert(dto model.GoodsDTO) error {
 		return code.ConvertErr
 	}
 	g.CreatedAt = model.LocalTime(time.Now())
-	if e := s.dao.Insert(g); e != nil {
+	if e := s.dao.Insert(&g); e != nil {
 		log.Println(e)
 		return code.DBErr
 	}
-	return nil
+	// 调度秒杀商品的预热与清理任务
+	return s.ScheduleSeckill(g)
 }
 
 func (s *goodsService) Update(dto model.GoodsDTO) (e error) {
@@ -207,7 +238,8 @@ func (s *goodsService) Update(dto model.GoodsDTO) (e error) {
 	if e = s.setGoodsCache(goods); e != nil {
 		return
 	}
-	return
+	// 秒杀时间可能发生了变化，重新调度预热与清理任务
+	return s.ScheduleSeckill(goods)
 }
 
 func (s *goodsService) DeleteWithPhysics(id int) (e error) {
@@ -220,7 +252,7 @@ func (s *goodsService) DeleteWithPhysics(id int) (e error) {
 	if e = s.deleteGoodsCache(id); e != nil {
 		return
 	}
-	return nil
+	return s.removeSeckill(id)
 }
 
 func (s *goodsService) DeleteWithLogic(id int) (e error) {
@@ -245,14 +277,37 @@ func (s *goodsService) DeleteWithLogic(id int) (e error) {
 	if e = s.deleteGoodsCache(id); e != nil {
 		return
 	}
-	return nil
+	return s.removeSeckill(id)
+}
+
+// 商品被删除后取消预热与清理任务，并清理秒杀缓存
+func (s *goodsService) removeSeckill(id int) (e error) {
+	if e = s.unscheduleSeckill(id); e != nil {
+		return
+	}
+	return s.TearDownSeckillGoods(id)
 }
 
 func (s *goodsService) SetGoodsStock(goodsId int, stock int) (err error) {
 	key := fmt.Sprintf(GoodsStockKey, goodsId)
-	if err = s.redis.Set(ctx, key, stock, -1).Err(); err != nil {
-		log.Printf("redis.Set() failed, err: %v", err)
+	soldOutKey := fmt.Sprintf(GoodsSoldOutKey, goodsId)
+	if _, err = s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, stock, 0)
+		if stock <= 0 {
+			pipe.Set(ctx, soldOutKey, 1, 0)
+		} else {
+			pipe.Del(ctx, soldOutKey)
+		}
+		return nil
+	}); err != nil {
+		log.Printf("redis.TxPipelined() failed, err: %v", err)
 		err = code.RedisErr
+		return
+	}
+	if stock <= 0 {
+		s.MarkSoldOut(goodsId)
+	} else {
+		s.ReleaseSoldOut(goodsId)
 	}
 	return
 }
@@ -263,31 +318,50 @@ func (s *goodsService) DecrStock(goodsId int) (stock int, err error) {
 	if res, err = s.redis.Decr(ctx, key).Result(); err != nil {
 		log.Printf("redis.Decr() failed, err: %v", err)
 		err = code.RedisErr
+		return
 	}
 	stock = int(res)
+	if stock < 0 {
+		s.MarkSoldOut(goodsId)
+	}
 	return
 }
 
-func (s *goodsService) IncrStock(goodsId int) (err error) {
-	key := fmt.Sprintf(GoodsStockKey, goodsId)
-	if err = s.redis.Incr(ctx, key).Err(); err != nil {
-		log.Printf("redis.Incr() failed, err: %v", err)
+func (s *goodsService) IncrStock(goodsId int, n int) (err error) {
+	keys := []string{fmt.Sprintf(GoodsStockKey, goodsId), fmt.Sprintf(GoodsSoldOutKey, goodsId)}
+	var res int
+	if res, err = incrStockScript.Run(ctx, s.redis, keys, n).Int(); err != nil {
+		log.Printf("incrStockScript.Run() failed, err: %v", err)
 		err = code.RedisErr
+		return
+	}
+	if res == 1 {
+		s.ReleaseSoldOut(goodsId)
 	}
 	return
 }
 
 func (s *goodsService) InitScekillGoods(userId int) (e error){
-	var list []model.Goods
-	if list, e = s.dao.QueryByCondition(model.GoodsQueryCondition{UserId: uint(userId)}); e != nil {
-		log.Println(e)
-		e = code.DBErr
-		return
-	}
-	for _, v := range list {
-		if e = s.SetGoodsStock(int(v.ID), v.Stock); e != nil {
+	c := model.GoodsQueryCondition{UserId: uint(userId)}
+	c.PageDTO.Size = model.MaxPageSize
+	// 逐页重新调度该商家所有商品的预热与清理任务，到期的任务会立即执行
+	for c.PageDTO.Index = 1; ; c.PageDTO.Index++ {
+		var (
+			list []model.Goods
+			rows int
+		)
+		if list, rows, e = s.dao.QueryByCondition(c); e != nil {
+			log.Println(e)
+			e = code.DBErr
+			return
+		}
+		for _, v := range list {
+			if e = s.ScheduleSeckill(v); e != nil {
+				return
+			}
+		}
+		if c.PageDTO.GetOffset()+len(list) >= rows || len(list) == 0 {
 			return
 		}
 	}
-	return
 }
\ No newline at end of file
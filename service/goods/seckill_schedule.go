@@ -0,0 +1,179 @@
+package goods
+
+import (
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"log"
+	"seckill/infra/code"
+	"seckill/model"
+	"strconv"
+	"time"
+)
+
+const (
+	GoodsSoldOutKey       = "goods_sold_out:%d"      // 商品售罄标识key格式
+	SeckillWarmUpJobKey   = "seckill_warm_up_jobs"   // 秒杀商品预热任务，score 为执行时间戳
+	SeckillTearDownJobKey = "seckill_tear_down_jobs" // 秒杀商品清理任务，score 为执行时间戳
+	seckillJobRetryDelay  = 10                       // 任务执行失败后的重试间隔，单位：秒
+)
+
+func (s *goodsService) TearDownAt(g model.Goods) int64 {
+	// 秒杀结束后至少等待一个订单超时时间再清理，保证超时关闭的订单返还库存时库存缓存仍然存在
+	delay := s.warmUp.TearDownDelay
+	if s.orderExpiration > delay {
+		delay = s.orderExpiration
+	}
+	return g.EndTime.Unix() + delay
+}
+
+func (s *goodsService) ScheduleSeckill(g model.Goods) (e error) {
+	warmUpAt := g.StartTime.Unix() - s.warmUp.Lead*60
+	tearDownAt := s.TearDownAt(g)
+	member := strconv.Itoa(int(g.ID))
+	if _, e = s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, SeckillWarmUpJobKey, &redis.Z{Score: float64(warmUpAt), Member: member})
+		pipe.ZAdd(ctx, SeckillTearDownJobKey, &redis.Z{Score: float64(tearDownAt), Member: member})
+		return nil
+	}); e != nil {
+		log.Printf("redis.TxPipelined() failed, err: %v, goodsId: %d", e, g.ID)
+		e = code.RedisErr
+	}
+	return
+}
+
+// 取消商品的预热与清理任务
+func (s *goodsService) unscheduleSeckill(id int) (e error) {
+	member := strconv.Itoa(id)
+	if _, e = s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, SeckillWarmUpJobKey, member)
+		pipe.ZRem(ctx, SeckillTearDownJobKey, member)
+		return nil
+	}); e != nil {
+		log.Printf("redis.TxPipelined() failed, err: %v, goodsId: %d", e, id)
+		e = code.RedisErr
+	}
+	return
+}
+
+func (s *goodsService) RehydrateSeckillJobs() (e error) {
+	var list []model.Goods
+	if list, e = s.dao.QueryAll(); e != nil {
+		return
+	}
+	now := time.Now().Unix()
+	count := 0
+	for _, g := range list {
+		// 已经清理过的商品不需要再调度
+		if s.TearDownAt(g) < now {
+			continue
+		}
+		if e = s.ScheduleSeckill(g); e != nil {
+			return
+		}
+		count++
+	}
+	log.Printf("已恢复 %d 个秒杀商品的预热与清理任务", count)
+	return
+}
+
+func (s *goodsService) RunDueSeckillJobs() (e error) {
+	if e = s.runDueJobs(SeckillWarmUpJobKey, s.WarmUpSeckillGoods); e != nil {
+		return
+	}
+	return s.runDueJobs(SeckillTearDownJobKey, s.TearDownSeckillGoods)
+}
+
+// 执行到期的任务
+// 通过 ZREM 抢占任务，多个实例同时运行时每个任务只会被一个实例执行
+func (s *goodsService) runDueJobs(key string, run func(id int) error) (e error) {
+	var list []string
+	now := time.Now().Unix()
+	if list, e = s.redis.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now, 10),
+	}).Result(); e != nil {
+		log.Printf("redis.ZRangeByScore() failed, err: %v", e)
+		e = code.RedisErr
+		return
+	}
+	for _, member := range list {
+		var n int64
+		if n, e = s.redis.ZRem(ctx, key, member).Result(); e != nil {
+			log.Printf("redis.ZRem() failed, err: %v", e)
+			e = code.RedisErr
+			return
+		}
+		// 已被其他实例抢占
+		if n == 0 {
+			continue
+		}
+		id, _ := strconv.Atoi(member)
+		if err := run(id); err != nil {
+			log.Printf("秒杀商品【%d】任务【%s】执行失败，将在 %d 秒后重试, err: %v", id, key, seckillJobRetryDelay, err)
+			s.redis.ZAdd(ctx, key, &redis.Z{Score: float64(now + seckillJobRetryDelay), Member: member})
+		}
+	}
+	return
+}
+
+func (s *goodsService) WarmUpSeckillGoods(id int) (e error) {
+	var (
+		g  model.Goods
+		ok bool
+	)
+	if g, e = s.dao.QueryGoodsByID(id); e != nil {
+		e = code.DBErr
+		return
+	}
+	// 商品信息缓存
+	if e = s.setGoodsCache(g); e != nil {
+		return
+	}
+	// 库存缓存只在未初始化时设置，避免覆盖秒杀进行中的库存
+	k := fmt.Sprintf(GoodsStockKey, id)
+	if ok, e = s.redis.SetNX(ctx, k, g.Stock, 0).Result(); e != nil {
+		log.Printf("redis.SetNX() failed, err: %v", e)
+		e = code.RedisErr
+		return
+	}
+	if ok && g.Stock <= 0 {
+		if e = s.setSoldOut(id); e != nil {
+			return
+		}
+	} else if ok {
+		// 清除预热前可能残留的售罄标识
+		if e = s.redis.Del(ctx, fmt.Sprintf(GoodsSoldOutKey, id)).Err(); e != nil {
+			log.Printf("redis.Del() failed, err: %v", e)
+			e = code.RedisErr
+			return
+		}
+		s.ReleaseSoldOut(id)
+	}
+	log.Printf("秒杀商品【%d】预热完成，库存: %d", id, g.Stock)
+	return
+}
+
+func (s *goodsService) TearDownSeckillGoods(id int) (e error) {
+	keys := []string{
+		fmt.Sprintf(CacheKey, id),
+		fmt.Sprintf(GoodsStockKey, id),
+		fmt.Sprintf(GoodsSoldOutKey, id),
+	}
+	if e = s.redis.Del(ctx, keys...).Err(); e != nil {
+		log.Printf("redis.Del() failed, err: %v", e)
+		e = code.RedisErr
+		return
+	}
+	s.ReleaseSoldOut(id)
+	log.Printf("秒杀商品【%d】缓存已清理", id)
+	return
+}
+
+// 设置商品售罄标识
+func (s *goodsService) setSoldOut(id int) (e error) {
+	if e = s.redis.Set(ctx, fmt.Sprintf(GoodsSoldOutKey, id), 1, 0).Err(); e != nil {
+		log.Printf("redis.Set() failed, err: %v", e)
+		e = code.RedisErr
+	}
+	return
+}
@@ -0,0 +1,165 @@
+package goods
+
+import (
+	"errors"
+	"fmt"
+	"seckill/conf"
+	"seckill/dao"
+	"seckill/model"
+	"testing"
+	"time"
+)
+
+// 内存中的 dao.IGoodsDao，只实现预热用到的方法
+type fakeGoodsDao struct {
+	dao.IGoodsDao
+	goods map[int]model.Goods
+}
+
+func (d *fakeGoodsDao) QueryGoodsByID(id int) (model.Goods, error) {
+	g, ok := d.goods[id]
+	if !ok {
+		return model.Goods{}, errors.New("record not found")
+	}
+	return g, nil
+}
+
+func TestTearDownAt(t *testing.T) {
+	g := model.Goods{EndTime: model.LocalTime(time.Now())}
+	tests := []struct {
+		name            string
+		tearDownDelay   int64
+		orderExpiration int64
+		want            int64
+	}{
+		{"使用清理延迟", 3600, 1800, 3600},
+		{"清理延迟不小于订单超时时间", 60, 1800, 1800},
+		{"都未配置", 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &goodsService{warmUp: conf.WarmUp{TearDownDelay: tt.tearDownDelay}, orderExpiration: tt.orderExpiration}
+			if got := s.TearDownAt(g) - g.EndTime.Unix(); got != tt.want {
+				t.Errorf("TearDownAt() - EndTime = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleSeckill(t *testing.T) {
+	mr, s := newTestGoodsService(t)
+	s.warmUp = conf.WarmUp{Lead: 5, TearDownDelay: 60}
+	g := model.Goods{StartTime: model.LocalTime(time.Now()), EndTime: model.LocalTime(time.Now().Add(time.Hour))}
+	g.ID = 1
+	if err := s.ScheduleSeckill(g); err != nil {
+		t.Fatal(err)
+	}
+	warmUpAt, _ := mr.ZScore(SeckillWarmUpJobKey, "1")
+	tearDownAt, _ := mr.ZScore(SeckillTearDownJobKey, "1")
+	if int64(warmUpAt) != g.StartTime.Unix()-5*60 || int64(tearDownAt) != g.EndTime.Unix()+60 {
+		t.Errorf("jobs = (%v, %v), want (%d, %d)", warmUpAt, tearDownAt, g.StartTime.Unix()-5*60, g.EndTime.Unix()+60)
+	}
+}
+
+// 到期的任务执行后移除，未到期的任务保留，执行失败的任务延后重试
+func TestRunDueJobs(t *testing.T) {
+	mr, s := newTestGoodsService(t)
+	now := time.Now().Unix()
+	mr.ZAdd(SeckillWarmUpJobKey, float64(now-1), "1")
+	mr.ZAdd(SeckillWarmUpJobKey, float64(now-1), "2")
+	mr.ZAdd(SeckillWarmUpJobKey, float64(now+60), "3")
+	var ran []int
+	err := s.runDueJobs(SeckillWarmUpJobKey, func(id int) error {
+		ran = append(ran, id)
+		if id == 2 {
+			return errors.New("db down")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 2 {
+		t.Errorf("ran = %v, want [1 2]", ran)
+	}
+	members, _ := mr.ZMembers(SeckillWarmUpJobKey)
+	if len(members) != 2 || members[0] != "2" || members[1] != "3" {
+		t.Errorf("jobs = %v, want [2 3]", members)
+	}
+	if retryAt, _ := mr.ZScore(SeckillWarmUpJobKey, "2"); int64(retryAt) < now+seckillJobRetryDelay {
+		t.Errorf("retry at = %v, want %d", retryAt, now+seckillJobRetryDelay)
+	}
+}
+
+func TestWarmUpSeckillGoods(t *testing.T) {
+	tests := []struct {
+		name    string
+		stock   int
+		cached  string
+		want    string
+		soldOut bool
+	}{
+		{"初始化库存缓存", 10, "", "10", false},
+		{"不覆盖秒杀进行中的库存", 10, "3", "3", false},
+		{"库存为 0 时设置售罄标识", 0, "", "0", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, s := newTestGoodsService(t)
+			g := model.Goods{Stock: tt.stock}
+			g.ID = 1
+			s.dao = &fakeGoodsDao{goods: map[int]model.Goods{1: g}}
+			stockKey := fmt.Sprintf(GoodsStockKey, 1)
+			if tt.cached != "" {
+				mr.Set(stockKey, tt.cached)
+			}
+			if err := s.WarmUpSeckillGoods(1); err != nil {
+				t.Fatal(err)
+			}
+			if stock, _ := mr.Get(stockKey); stock != tt.want || mr.TTL(stockKey) != 0 {
+				t.Errorf("stock = %q ttl %v, want %q without ttl", stock, mr.TTL(stockKey), tt.want)
+			}
+			if got := mr.Exists(fmt.Sprintf(GoodsSoldOutKey, 1)); got != tt.soldOut {
+				t.Errorf("sold out flag = %v, want %v", got, tt.soldOut)
+			}
+			if !mr.Exists(fmt.Sprintf(CacheKey, 1)) {
+				t.Error("goods cache is not set")
+			}
+		})
+	}
+}
+
+func TestTearDownSeckillGoods(t *testing.T) {
+	mr, s := newTestGoodsService(t)
+	keys := []string{fmt.Sprintf(CacheKey, 1), fmt.Sprintf(GoodsStockKey, 1), fmt.Sprintf(GoodsSoldOutKey, 1)}
+	for _, k := range keys {
+		mr.Set(k, "1")
+	}
+	s.MarkSoldOut(1)
+	if err := s.TearDownSeckillGoods(1); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range keys {
+		if mr.Exists(k) {
+			t.Errorf("%s is not deleted", k)
+		}
+	}
+	if s.IsSoldOut(1) {
+		t.Error("local sold out flag is not cleared")
+	}
+}
+
+// 库存缓存还未预热或已被清理时不归还，不能创建一个没有过期时间的库存缓存
+func TestIncrStockWithoutCache(t *testing.T) {
+	mr, s := newTestGoodsService(t)
+	mr.Set(fmt.Sprintf(GoodsSoldOutKey, 1), "1")
+	if err := s.IncrStock(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(fmt.Sprintf(GoodsStockKey, 1)) {
+		t.Error("stock cache is created")
+	}
+	if !mr.Exists(fmt.Sprintf(GoodsSoldOutKey, 1)) {
+		t.Error("sold out flag is cleared")
+	}
+}
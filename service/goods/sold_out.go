@@ -0,0 +1,35 @@
+package goods
+
+import (
+	"time"
+)
+
+const (
+	// 本地售罄标识的有效时间，防止错过失效通知时商品一直被当作售罄
+	localSoldOutExpire = 10 * time.Second
+)
+
+func (s *goodsService) IsSoldOut(goodsId int) bool {
+	v, ok := s.soldOut.Load(goodsId)
+	if !ok {
+		return false
+	}
+	if time.Since(v.(time.Time)) > localSoldOutExpire {
+		s.soldOut.Delete(goodsId)
+		return false
+	}
+	return true
+}
+
+func (s *goodsService) MarkSoldOut(goodsId int) {
+	s.soldOut.Store(goodsId, time.Now())
+}
+
+func (s *goodsService) ClearLocalSoldOut(goodsId int) {
+	s.soldOut.Delete(goodsId)
+}
+
+func (s *goodsService) ReleaseSoldOut(goodsId int) {
+	s.ClearLocalSoldOut(goodsId)
+	s.soldOutNotifier.Publish(goodsId)
+}
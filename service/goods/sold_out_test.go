@@ -0,0 +1,79 @@
+package goods
+
+import (
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"seckill/conf"
+	"seckill/mq"
+	"testing"
+	"time"
+)
+
+// 创建连接到 miniredis 的 goodsService
+func newTestGoodsService(t *testing.T) (*miniredis.Miniredis, *goodsService) {
+	t.Helper()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	return mr, NewGoodsService(nil, rdb, mq.NewSoldOutNotifier(rdb), conf.WarmUp{}, 0)
+}
+
+func TestIsSoldOut(t *testing.T) {
+	tests := []struct {
+		name     string
+		markedAt time.Time
+		want     bool
+	}{
+		{"没有售罄标识", time.Time{}, false},
+		{"刚刚售罄", time.Now(), true},
+		{"售罄标识已过期", time.Now().Add(-localSoldOutExpire - time.Second), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, s := newTestGoodsService(t)
+			if !tt.markedAt.IsZero() {
+				s.soldOut.Store(1, tt.markedAt)
+			}
+			if got := s.IsSoldOut(1); got != tt.want {
+				t.Errorf("IsSoldOut() = %v, want %v", got, tt.want)
+			}
+			if _, ok := s.soldOut.Load(1); ok != tt.want {
+				t.Errorf("local sold out flag exists = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+// 归还库存后清除本地与缓存中的售罄标识，并通知其他实例
+func TestIncrStockReleasesSoldOut(t *testing.T) {
+	mr, s := newTestGoodsService(t)
+	pubsub := s.redis.Subscribe(ctx, "goods_sold_out_channel")
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mr.Set(fmt.Sprintf(GoodsStockKey, 1), "0")
+	mr.Set(fmt.Sprintf(GoodsSoldOutKey, 1), "1")
+	s.MarkSoldOut(1)
+	if err := s.IncrStock(1, 2); err != nil {
+		t.Fatalf("IncrStock() error = %v", err)
+	}
+	if stock, _ := mr.Get(fmt.Sprintf(GoodsStockKey, 1)); stock != "2" {
+		t.Errorf("stock = %q, want 2", stock)
+	}
+	if mr.Exists(fmt.Sprintf(GoodsSoldOutKey, 1)) || s.IsSoldOut(1) {
+		t.Error("sold out flag is not cleared")
+	}
+	select {
+	case msg := <-pubsub.Channel():
+		if msg.Payload != "1" {
+			t.Errorf("notification payload = %q, want 1", msg.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Error("sold out release is not published")
+	}
+}
@@ -14,7 +14,10 @@ type IGoodsService interface {
 	FindGoodsVOByID(id int) (model.GoodsVO, error)
 
 	// FindByCondition 通过条件查询多条数据
-	FindByCondition(c model.GoodsQueryCondition) ([]model.GoodsVO, error)
+	FindByCondition(c model.GoodsQueryCondition) (page model.PageVO, e error)
+
+	// Authorize 校验当前用户能否管理商品：商品属于当前用户，或者当前用户拥有 override 权限，返回校验通过的商品
+	Authorize(p model.Principal, goodsId int, override string) (model.Goods, error)
 
 	// Insert 插入数据
 	Insert(dto model.GoodsDTO) error
@@ -34,9 +37,39 @@ type IGoodsService interface {
 	// DecrStock 商品库存缓存原子 -1，并返回减少后的当前库存
 	DecrStock(goodsId int) (stock int, err error)
 
-	// IncrStock 商品库存缓存原子 +1，并返回添加后的当前库存
-	IncrStock(goodsId int) (err error)
+	// IncrStock 商品库存缓存原子 +n，库存缓存不存在时不做处理
+	IncrStock(goodsId int, n int) (err error)
+
+	// IsSoldOut 查询本实例的商品售罄标识，售罄的商品无需再访问 redis
+	IsSoldOut(goodsId int) bool
+
+	// MarkSoldOut 设置本实例的商品售罄标识
+	MarkSoldOut(goodsId int)
 
-	// InitScekillGoods 初始化参加秒杀的商品
+	// ClearLocalSoldOut 清除本实例的商品售罄标识
+	ClearLocalSoldOut(goodsId int)
+
+	// ReleaseSoldOut 清除本实例的商品售罄标识，并通知其他实例清除
+	ReleaseSoldOut(goodsId int)
+
+	// InitScekillGoods 初始化参加秒杀的商品，重新调度该商家所有商品的预热与清理任务
 	InitScekillGoods(userId int) (e error)
+
+	// ScheduleSeckill 调度商品在秒杀开始前预热、在秒杀结束后清理缓存
+	ScheduleSeckill(g model.Goods) (e error)
+
+	// RehydrateSeckillJobs 根据数据库中的商品恢复预热与清理任务，服务启动时调用
+	RehydrateSeckillJobs() (e error)
+
+	// TearDownAt 商品缓存的清理时间
+	TearDownAt(g model.Goods) int64
+
+	// RunDueSeckillJobs 执行已到期的预热与清理任务
+	RunDueSeckillJobs() (e error)
+
+	// WarmUpSeckillGoods 预热秒杀商品：加载商品信息缓存、库存缓存与售罄标识
+	WarmUpSeckillGoods(id int) (e error)
+
+	// TearDownSeckillGoods 清理秒杀商品的缓存
+	TearDownSeckillGoods(id int) (e error)
 }
@@ -1,14 +1,27 @@
 package service
 
-import "seckill/model"
+import (
+	"seckill/infra/code"
+	"seckill/model"
+	"seckill/payment"
+)
 
 type IOrderService interface {
-	// SecondKill 秒杀
-	SecondKill(userId, goodsId int) (e error)
+	// GetCaptcha 秒杀开始后为用户生成秒杀验证码
+	GetCaptcha(userId, goodsId int) (vo model.CaptchaVO, e error)
+
+	// GetSecondKillPath 秒杀开始后为用户生成一个短期有效的秒杀地址，商品需要验证码时先校验验证码
+	GetSecondKillPath(userId, goodsId int, answer string) (path string, e error)
+
+	// SecondKill 秒杀，quantity 为购买数量，path 为 GetSecondKillPath 生成的秒杀地址
+	SecondKill(userId, goodsId, quantity int, path string) (e error)
 
 	// GetSecondKillResult 获取秒杀结果
 	GetSecondKillResult(userId, goodsId int) (res model.SecondKillResult, e error)
 
+	// FailSecondKill 记录异步下单失败的秒杀结果，并归还预减的库存
+	FailSecondKill(userId, goodsId, quantity int, reason code.Code) (e error)
+
 	// GetOrderId 从订单编号缓存中获取订单编号
 	GetOrderId(userId, goodsId int) (orderId string, err error)
 
@@ -18,11 +31,30 @@ type IOrderService interface {
 	// GetOrderInfoVO 获取订单视图信息
 	GetOrderInfoVO(orderId string, userId int) (vo model.OrderInfoVO, e error)
 
-	// GetOrderInfoVOList 获取订单视图列表
-	GetOrderInfoVOList(c model.OrderInfoQueryCondition) (list []model.OrderInfoVO, e error)
+	// GetOrderInfoVOList 分页获取订单视图列表，c.Cursor 不为空时使用游标分页
+	GetOrderInfoVOList(c model.OrderInfoQueryCondition) (page model.PageVO, e error)
+
+	// CreateOrder 创建订单，同一个订单编号只会创建一次
+	CreateOrder(orderId string, userId, goodsId, quantity int) error
+
+	// CreateOrders 批量创建订单，errs 与 list 一一对应
+	// 订单入库（或确认已经存在）后、执行后续步骤前调用 committed，i 为订单在 list 中的下标，committed 可以为 nil
+	CreateOrders(list []model.OrderRequest, committed func(i int)) (errs []error)
 
-	// CreateOrder 创建订单
-	CreateOrder(userId int, goodsId int) error
+	// PayOrder 发起订单支付
+	PayOrder(userId int, orderId string) (vo model.PayVO, e error)
+
+	// PaymentNotify 处理支付网关的异步回调
+	PaymentNotify(n payment.Notify) (e error)
+	// ResolvePaying 主动查询支付中订单的支付结果，超过支付等待时间仍未完成支付的订单回到未支付状态，
+	// 返回处理后的订单信息
+	ResolvePaying(orderInfo model.OrderInfo) (o model.OrderInfo, e error)
+
+	// RequestRefund 用户对已支付的订单申请退款
+	RequestRefund(userId int, orderId string, reason string) (e error)
+
+	// AuditRefund 审核退款申请，商家只能审核自己商品的订单，审核通过后向支付网关发起退款
+	AuditRefund(p model.Principal, orderId string, dto model.RefundAuditDTO) (e error)
 
 	// CreateOrderCache 创建订单缓存信息
 	CreateOrderCache(order model.OrderInfo) (err error)
@@ -33,6 +65,12 @@ type IOrderService interface {
 	// CloseOrder 关闭订单
 	CloseOrder(userId int, orderId string) (e error)
 
+	// CancelOrder 用户取消未支付的订单，重复取消不会报错
+	CancelOrder(userId int, orderId string) (e error)
+
+	// GetOrderStatusHistory 查询订单状态流转记录
+	GetOrderStatusHistory(userId int, orderId string) (list []model.OrderStatusHistory, e error)
+
 	// UnLock 解锁
 	UnLock(userId, goodsId int) (err error)
 }
@@ -0,0 +1,9 @@
+package service
+
+type IRiskService interface {
+	// Incr 增加用户的风险分
+	Incr(userId int, score int64) (e error)
+
+	// Check 检查用户的风险分，超过阈值时拒绝用户参与秒杀
+	Check(userId int) (e error)
+}
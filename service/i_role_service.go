@@ -0,0 +1,16 @@
+package service
+
+import "seckill/model"
+
+type IRoleService interface {
+	// FindRoles 查询用户拥有的角色，优先从缓存中获取
+	FindRoles(userId uint) (roles []string, e error)
+	// FindPrincipal 查询用户拥有的角色并创建 Principal，用于请求的权限校验
+	FindPrincipal(userId uint) (p model.Principal, e error)
+	// FindUserRoleVO 查询用户的角色与权限
+	FindUserRoleVO(userId uint) (vo model.UserRoleVO, e error)
+	// Grant 授予用户角色，用户已拥有该角色时直接返回成功
+	Grant(userId uint, role string) error
+	// Revoke 撤销用户角色，不能撤销最后一个管理员
+	Revoke(userId uint, role string) error
+}
@@ -0,0 +1,9 @@
+package service
+
+import "seckill/model"
+
+type IStockService interface {
+	// Reconcile 对账数据库与缓存中的商品库存，dryRun 为 true 时只报告偏差不做修复，
+	// 修复时缓存库存只会被调低，低于期望值的缓存库存只报告不修复
+	Reconcile(dryRun bool) (list []model.StockDrift, e error)
+}
@@ -1,14 +1,24 @@
 package service
 
-import "seckill/model"
+import (
+	"seckill/infra/secret"
+	"seckill/model"
+)
 
 type IUserService interface {
 	// Register 用户注册
 	Register(registerUser model.RegisterUser) error
-	// Login 用户登录
-	Login(loginUser model.LoginUser) (token string, e error)
+	// Login 用户登录，签发访问令牌与刷新令牌
+	Login(loginUser model.LoginUser) (vo model.TokenVO, e error)
+	// RefreshToken 使用刷新令牌换取新的访问令牌与刷新令牌，旧的刷新令牌随即失效，
+	// 再次使用已轮换的刷新令牌会吊销该设备的整个令牌族
+	RefreshToken(refreshToken string) (vo model.TokenVO, e error)
 	// FindByUsername 通过 username 查询用户信息
 	FindByUsername(username string) (user model.User, e error)
-	// Logout 用户退出登录
-	Logout(token string)
+	// Logout 用户退出登录，吊销当前令牌与当前设备的刷新令牌
+	Logout(claims *secret.CustomClaims) error
+	// LogoutAll 退出用户所有的登录，吊销用户已签发的全部令牌与刷新令牌
+	LogoutAll(userId uint) error
+	// CheckToken 检查令牌是否已被吊销
+	CheckToken(claims *secret.CustomClaims) error
 }
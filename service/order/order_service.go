@@ -2,19 +2,22 @@ package order
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/go-redis/redis/v8"
 	"github.com/jinzhu/gorm"
 	"log"
+	"seckill/conf"
 	"seckill/dao"
-	"seckill/infra/cache"
 	"seckill/infra/code"
+	"seckill/infra/utils/captcha"
 	"seckill/infra/utils/key"
 	"seckill/model"
 	"seckill/mq"
+	"seckill/payment"
 	"seckill/service"
-	"sync"
+	"seckill/service/goods"
 	"time"
 )
 
@@ -23,101 +26,265 @@ const (
 	LockKey = "lock:%d:%d"
 	// OrderIdKey 订单缓存 key
 	OrderIdKey = "order:%d:%d"
+	// BoughtKey 用户已购数量 key
+	BoughtKey = "goods_bought:%d:%d"
+	// SecondKillPathKey 用户秒杀地址 key
+	SecondKillPathKey = "seckill_path:%d:%d"
+	// SecondKillCaptchaKey 用户秒杀验证码答案 key
+	SecondKillCaptchaKey = "seckill_captcha:%d:%d"
+	// SecondKillPathLen 秒杀地址长度
+	SecondKillPathLen = 32
+	// SecondKillResultKey 秒杀结果缓存 key
+	SecondKillResultKey = "seckill_result:%d:%d"
+	// StockReturnKey 订单归还缓存库存的状态 key
+	StockReturnKey = "stock_return:%s"
+	// LockExpire redis 锁过期时间
+	LockExpire = time.Minute
+	// DefaultNotifyWindow 未配置时支付回调时间戳的有效窗口，单位：秒
+	DefaultNotifyWindow = 300
+	// DefaultPayingTimeout 未配置时等待支付结果的最长时间，单位：秒
+	DefaultPayingTimeout = 900
 )
 
 var (
-	once sync.Once
 	ctx = context.Background()
 )
 
-// InitService 单例模式初始化 IOrderService 接口实例
-func InitService() {
-	once.Do(func() {
-		service.OrderService = newOrderService()
-
-	})
-}
-
 type orderService struct {
-	dao dao.IOrderDao
+	dao          dao.IOrderDao
+	paymentDao   dao.IPaymentDao
 	goodsService service.IGoodsService
-	redis *redis.Client
+	riskService  service.IRiskService
+	gateway      payment.IPaymentGateway
+	orderTimeout *mq.OrderTimeoutQueue
+	redis        *redis.Client
+	orderCfg     conf.Order
+	paymentCfg   conf.Payment
+	captchaCfg   conf.Captcha
+	riskCfg      conf.Risk
 }
 
-func newOrderService() *orderService {
+// NewOrderService 创建一个 service.IOrderService 接口实例
+func NewOrderService(orderDao dao.IOrderDao, paymentDao dao.IPaymentDao, goodsService service.IGoodsService,
+	riskService service.IRiskService, gateway payment.IPaymentGateway, orderTimeout *mq.OrderTimeoutQueue,
+	redis *redis.Client, orderCfg conf.Order, paymentCfg conf.Payment, captchaCfg conf.Captcha,
+	riskCfg conf.Risk) *orderService {
 	return &orderService{
-		dao: dao.OrderDao,
-		goodsService: service.GoodsService,
-		redis:        cache.Client,
+		dao:          orderDao,
+		paymentDao:   paymentDao,
+		goodsService: goodsService,
+		riskService:  riskService,
+		gateway:      gateway,
+		orderTimeout: orderTimeout,
+		redis:        redis,
+		orderCfg:     orderCfg,
+		paymentCfg:   paymentCfg,
+		captchaCfg:   captchaCfg,
+		riskCfg:      riskCfg,
 	}
 }
 
-func (s *orderService) SecondKill(userId, goodsId int) (e error) {
+func (s *orderService) GetCaptcha(userId, goodsId int) (vo model.CaptchaVO, e error) {
 	var (
-		goods model.Goods
-		orderId string
-		stock   int
+		g    model.Goods
+		data []byte
 	)
-	// 获取商品信息
-	if goods, e = s.goodsService.FindGoodsByID(goodsId); e != nil {
+	if s.goodsService.IsSoldOut(goodsId) {
+		e = code.GoodsSaleOut
 		return
 	}
-	// 验证商品信息
-	if e = s.goodsService.Check(goods); e != nil {
+	if e = s.riskService.Check(userId); e != nil {
 		return
 	}
-	// 加锁
-	if e = s.tryLock(userId, goodsId, time.Now().Unix()); e != nil {
+	if g, e = s.goodsService.FindGoodsByID(goodsId); e != nil {
 		return
 	}
-	// 校验重复秒杀
-	if orderId, e = s.GetOrderId(userId, goodsId); e != nil {
-		e = code.RedisErr
+	if e = s.goodsService.Check(g); e != nil {
 		return
 	}
-	if len(orderId) > 0 {
-		e = code.RepeateSeckillErr
+	question, answer := captcha.Generate()
+	if data, e = captcha.Render(question); e != nil {
+		log.Printf("captcha.Render() failed, err: %v", e)
+		e = code.UnknownErr
 		return
 	}
-	// 预减商品库存
-	if stock, e = s.goodsService.DecrStock(goodsId); e != nil {
+	// 新的验证码会覆盖旧的验证码
+	k := fmt.Sprintf(SecondKillCaptchaKey, userId, goodsId)
+	expire := s.captchaCfg.ValidTime
+	if e = s.redis.Set(ctx, k, answer, time.Duration(expire)*time.Second).Err(); e != nil {
+		log.Printf("redis.Set() failed, err: %v", e)
 		e = code.RedisErr
 		return
 	}
-	// 没有库存了，商品已售罄
-	if stock < 0 {
-		// 把预减的库存加回去
-		if e = s.goodsService.IncrStock(goodsId); e != nil {
-			e = code.RedisErr
+	vo.Image = captcha.DataURL(data)
+	vo.Expire = expire
+	return
+}
+
+// 校验验证码，验证码无论对错都只能校验一次，校验失败时增加用户的风险分
+func (s *orderService) verifyCaptcha(userId, goodsId int, answer string) (e error) {
+	var get *redis.StringCmd
+	k := fmt.Sprintf(SecondKillCaptchaKey, userId, goodsId)
+	if _, e = s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, k)
+		pipe.Del(ctx, k)
+		return nil
+	}); e != nil && e != redis.Nil {
+		log.Printf("redis.TxPipelined() failed, err: %v", e)
+		return code.RedisErr
+	}
+	if answer != "" && get.Val() == answer {
+		return nil
+	}
+	if e = s.riskService.Incr(userId, s.riskCfg.CaptchaFailScore); e != nil {
+		return
+	}
+	return code.CaptchaErr
+}
+
+func (s *orderService) GetSecondKillPath(userId, goodsId int, answer string) (path string, e error) {
+	var g model.Goods
+	// 已售罄的商品直接返回，无需访问 redis
+	if s.goodsService.IsSoldOut(goodsId) {
+		e = code.GoodsSaleOut
+		return
+	}
+	if e = s.riskService.Check(userId); e != nil {
+		return
+	}
+	if g, e = s.goodsService.FindGoodsByID(goodsId); e != nil {
+		return
+	}
+	// 秒杀开始后才发放秒杀地址
+	if e = s.goodsService.Check(g); e != nil {
+		return
+	}
+	if g.NeedCaptcha {
+		if e = s.verifyCaptcha(userId, goodsId, answer); e != nil {
 			return
 		}
+	}
+	path = key.CreateKey(key.NumberAndLetter, SecondKillPathLen)
+	k := fmt.Sprintf(SecondKillPathKey, userId, goodsId)
+	expire := time.Duration(s.orderCfg.PathExpiration) * time.Second
+	if e = s.redis.Set(ctx, k, path, expire).Err(); e != nil {
+		log.Printf("redis.Set() failed, err: %v", e)
+		path = ""
+		e = code.RedisErr
+	}
+	return
+}
+
+// 校验并消费秒杀地址
+func (s *orderService) consumeSecondKillPath(userId, goodsId int, path string) error {
+	if path == "" {
+		return code.SeckillPathErr
+	}
+	k := fmt.Sprintf(SecondKillPathKey, userId, goodsId)
+	n, e := consumePathScript.Run(ctx, s.redis, []string{k}, path).Int()
+	if e != nil {
+		log.Printf("consumePathScript.Run() failed, err: %v", e)
+		return code.RedisErr
+	}
+	if n == 0 {
+		return code.SeckillPathErr
+	}
+	return nil
+}
+
+func (s *orderService) SecondKill(userId, goodsId, quantity int, path string) (e error) {
+	var (
+		g    model.Goods
+		data []byte
+		res  int64
+	)
+	if quantity <= 0 {
+		quantity = 1
+	}
+	if s.goodsService.IsSoldOut(goodsId) {
 		e = code.GoodsSaleOut
 		return
 	}
-	// 异步下单
+	// 秒杀地址只能使用一次，每次秒杀前需要重新获取
+	if e = s.consumeSecondKillPath(userId, goodsId, path); e != nil {
+		return
+	}
+	// 获取商品信息
+	if g, e = s.goodsService.FindGoodsByID(goodsId); e != nil {
+		return
+	}
+	// 验证商品信息
+	if e = s.goodsService.Check(g); e != nil {
+		return
+	}
+	limit := g.GetLimitPerUser()
+	if quantity > limit {
+		e = code.PurchaseLimitErr
+		return
+	}
+	// 异步下单消息，订单编号在准入时生成，用于消息重复投递时的幂等判断
 	msg := mq.PrecreateOrderMsg{
-		UserId:  userId,
-		GoodsId: goodsId,
+		OrderId:  createOrderId(),
+		UserId:   userId,
+		GoodsId:  goodsId,
+		Quantity: quantity,
+	}
+	if data, e = msg.Marshal(); e != nil {
+		return
+	}
+	// 已购数量保留到秒杀商品缓存清理时
+	boughtExpire := s.goodsService.TearDownAt(g) - time.Now().Unix()
+	if boughtExpire < int64(LockExpire.Seconds()) {
+		boughtExpire = int64(LockExpire.Seconds())
 	}
-	if e = mq.PrecreateOrder.Send(msg); e != nil {
-		log.Println(e)
+	// 重复秒杀校验、限购校验、预减库存、售罄判断、消息入队在 redis 中原子执行
+	keys := []string{
+		fmt.Sprintf(BoughtKey, userId, goodsId),
+		fmt.Sprintf(LockKey, userId, goodsId),
+		fmt.Sprintf(goods.GoodsStockKey, goodsId),
+		mq.PrecreateOrderKey,
+		fmt.Sprintf(SecondKillResultKey, userId, goodsId),
+		fmt.Sprintf(goods.GoodsSoldOutKey, goodsId),
+	}
+	if res, e = secondKillScript.Run(ctx, s.redis, keys, time.Now().Unix(), int(LockExpire.Seconds()), data,
+		quantity, limit, boughtExpire).Int64(); e != nil {
+		log.Printf("secondKillScript.Run() failed, err: %v", e)
 		e = code.RedisErr
 		return
 	}
+	switch res {
+	case admitOk:
+	case admitRepeated:
+		e = code.RepeateSeckillErr
+	case admitSaleOut:
+		// 设置本实例的售罄标识，后续请求不再访问 redis
+		s.goodsService.MarkSoldOut(goodsId)
+		e = code.GoodsSaleOut
+	case admitExceedLimit:
+		e = code.PurchaseLimitErr
+	case admitStockNotEnough:
+		e = code.StockNotEnough
+	case admitNotReady:
+		e = code.SeckillNotReady
+	default:
+		log.Printf("secondKillScript.Run() unknown result: %d", res)
+		e = code.SeckillFailedErr
+	}
 	return
 }
 
 func (s *orderService) GetSecondKillResult(userId, goodsId int) (res model.SecondKillResult, e error) {
 	var (
 		orderId string
-		goods model.Goods
+		goods   model.Goods
+		ok      bool
 	)
-	// 先验证商品是否处于秒杀活动中
 	goods, e = s.goodsService.FindGoodsByID(goodsId)
 	if e != nil {
 		return
 	}
-	if e = s.goodsService.Check(goods); e != nil {
+	// 优先查询异步下单流程记录的秒杀结果
+	if res, ok, e = s.getSecondKillResult(userId, goodsId); e != nil || ok {
 		return
 	}
 	// 在订单缓存中查询订单编号
@@ -125,47 +292,227 @@ func (s *orderService) GetSecondKillResult(userId, goodsId int) (res model.Secon
 		e = code.RedisErr
 		return
 	}
-	if len(orderId) == 0 {
-		// 秒杀排队中
-		res.Status = model.SecondKilling
-	} else {
+	if len(orderId) > 0 {
 		// 秒杀成功
 		res.Status = model.SecondKillOk
 		res.OrderId = orderId
+		return
+	}
+	// 验证商品是否处于秒杀活动中
+	if e = s.goodsService.Check(goods); e != nil {
+		return
 	}
+	// 秒杀排队中
+	res.Status = model.SecondKilling
 	return
 }
 
-func (s *orderService) CreateOrder(userId, goodsId int) (err error) {
+func (s *orderService) FailSecondKill(userId, goodsId, quantity int, reason code.Code) (e error) {
+	res := model.SecondKillResult{
+		Status:  model.SecondKillFailed,
+		Code:    reason.Code(),
+		Message: reason.Error(),
+	}
+	if reason == code.GoodsSaleOut {
+		// 商品在数据库中已没有库存，预减的库存不再归还
+		res.Status = model.SecondKillSaleOut
+		s.goodsService.MarkSoldOut(goodsId)
+	} else if e = s.goodsService.IncrStock(goodsId, quantity); e != nil {
+		// 归还预减的库存
+		return
+	}
+	// 订单没有创建成功，不计入已购数量
+	if e = s.releaseBought(userId, goodsId, quantity); e != nil {
+		return
+	}
+	if e = s.setSecondKillResult(userId, goodsId, res); e != nil {
+		return
+	}
+	// 释放锁，允许用户再次参与秒杀
+	return s.UnLock(userId, goodsId)
+}
+
+// 扣减用户已购数量
+func (s *orderService) releaseBought(userId, goodsId, quantity int) (e error) {
+	keys := []string{fmt.Sprintf(BoughtKey, userId, goodsId)}
+	if e = releaseBoughtScript.Run(ctx, s.redis, keys, quantity).Err(); e != nil {
+		log.Printf("releaseBoughtScript.Run() failed, err: %v", e)
+		e = code.RedisErr
+	}
+	return
+}
+
+// 缓存秒杀结果
+func (s *orderService) setSecondKillResult(userId, goodsId int, res model.SecondKillResult) (e error) {
+	var data []byte
+	if data, e = json.Marshal(res); e != nil {
+		log.Printf("json.Marshal() failed, err: %v", e)
+		e = code.SerializeErr
+		return
+	}
+	k := fmt.Sprintf(SecondKillResultKey, userId, goodsId)
+	expiration := time.Duration(s.orderCfg.ResultExpiration) * time.Second
+	if e = s.redis.Set(ctx, k, string(data), expiration).Err(); e != nil {
+		log.Printf("redis.Set() failed, err: %v", e)
+		e = code.RedisErr
+	}
+	return
+}
+
+// 获取缓存的秒杀结果，ok 表示是否存在秒杀结果
+func (s *orderService) getSecondKillResult(userId, goodsId int) (res model.SecondKillResult, ok bool, e error) {
+	var data string
+	k := fmt.Sprintf(SecondKillResultKey, userId, goodsId)
+	if data, e = s.redis.Get(ctx, k).Result(); e != nil {
+		if e == redis.Nil {
+			e = nil
+		} else {
+			log.Printf("redis.Get() failed, err: %v", e)
+			e = code.RedisErr
+		}
+		return
+	}
+	if e = json.Unmarshal([]byte(data), &res); e != nil {
+		log.Printf("json.Unmarshal() failed, err: %v, json: %v", e, data)
+		e = code.SerializeErr
+		return
+	}
+	ok = true
+	return
+}
+
+func (s *orderService) CreateOrder(orderId string, userId, goodsId, quantity int) error {
+	return s.CreateOrders([]model.OrderRequest{{
+		OrderId:  orderId,
+		UserId:   userId,
+		GoodsId:  goodsId,
+		Quantity: quantity,
+	}}, nil)[0]
+}
+
+func (s *orderService) CreateOrders(list []model.OrderRequest, committed func(i int)) (errs []error) {
 	var (
-		orderId string
-		goods   model.Goods
+		ids     []string
+		existed map[string]bool
+		e       error
 	)
-	// 是否重复秒杀
-	if orderId, err = s.GetOrderId(userId, goodsId); err != nil {
-		log.Printf("s.GetOrderId() failed, err: %v", err)
+	errs = make([]error, len(list))
+	for i := range list {
+		if list[i].Quantity <= 0 {
+			list[i].Quantity = 1
+		}
+		if list[i].OrderId == "" {
+			list[i].OrderId = createOrderId()
+		}
+		ids = append(ids, list[i].OrderId)
+	}
+	// 消息重复投递时订单已经创建过了
+	if existed, e = s.dao.QueryExistedOrderIds(ids); e != nil {
+		for i := range errs {
+			errs[i] = e
+		}
 		return
 	}
-	if len(orderId) > 0 {
+	var (
+		orderInfos []model.OrderInfo
+		indexes    []int
+		goodsMap   = make(map[int]model.Goods)
+		limits     = make(map[uint]int)
+	)
+	seen := make(map[string]bool, len(list))
+	for i, r := range list {
+		// 同一批次中的重复消息只处理一次
+		if seen[r.OrderId] {
+			continue
+		}
+		seen[r.OrderId] = true
+		if existed[r.OrderId] {
+			// 上一次投递可能在订单入库后、写入缓存或加入超时队列前失败，重新补齐这些步骤
+			if committed != nil {
+				committed(i)
+			}
+			errs[i] = s.resumeCreatedOrder(r.OrderId)
+			continue
+		}
+		// 查询商品信息
+		goods, ok := goodsMap[r.GoodsId]
+		if !ok {
+			if goods, e = s.goodsService.FindGoodsByID(r.GoodsId); e != nil {
+				log.Printf("goodsService.GetGoods() failed, err: %v", e)
+				errs[i] = e
+				continue
+			}
+			goodsMap[r.GoodsId] = goods
+			limits[goods.ID] = goods.GetLimitPerUser()
+		}
+		orderInfos = append(orderInfos, s.newOrderInfo(r.OrderId, r.UserId, goods, r.Quantity))
+		indexes = append(indexes, i)
+	}
+	if len(orderInfos) == 0 {
 		return
 	}
-	// 查询商品信息
-	if goods, err = s.goodsService.FindGoodsByID(goodsId); err != nil {
-		log.Printf("goodsService.GetGoods() failed, err: %v", err)
+	// 批量创建订单
+	createErrs, e := s.dao.CreateOrders(orderInfos, limits)
+	if e != nil {
+		log.Printf("orderRepository.CreateOrders() failed, err: %v", e)
+		for _, i := range indexes {
+			errs[i] = e
+		}
 		return
 	}
-	// 创建订单
-	orderInfo := s.newOrderInfo(userId, goods)
-	if err = s.dao.CreateOrder(orderInfo); err != nil {
-		log.Printf("orderRepository.CreateOrder() failed, err: %v", err)
+	// 订单已经入库，先通知调用方再执行后续步骤
+	if committed != nil {
+		for k, err := range createErrs {
+			if err == nil || errors.Is(err, code.OrderExistedErr) {
+				committed(indexes[k])
+			}
+		}
+	}
+	for k, orderInfo := range orderInfos {
+		i := indexes[k]
+		if errors.Is(createErrs[k], code.OrderExistedErr) {
+			// 查询之后其他消费者创建了同一个订单，与已存在的订单一样补齐后续步骤
+			errs[i] = s.resumeCreatedOrder(orderInfo.OrderId)
+			continue
+		}
+		if errs[i] = createErrs[k]; errs[i] != nil {
+			continue
+		}
+		errs[i] = s.afterCreateOrder(orderInfo)
+	}
+	return
+}
+
+// 补齐已经创建的订单的后续步骤，只处理仍未支付的订单，已支付或已关闭的订单不再需要处理
+func (s *orderService) resumeCreatedOrder(orderId string) (err error) {
+	var orderInfo model.OrderInfo
+	if orderInfo, err = s.dao.QueryOrderInfoByOrderId(orderId); err != nil {
+		log.Printf("dao.QueryOrderInfoByOrderId() failed, err: %v, orderId: %s", err, orderId)
 		return
 	}
+	if orderInfo.Status != model.Unpaid {
+		return nil
+	}
+	return s.afterCreateOrder(orderInfo)
+}
+
+// 订单创建成功后：创建订单信息缓存、记录秒杀结果、加入订单超时延迟队列
+// 重复执行不会产生副作用，订单重复加入超时队列时保留第一次加入时的超时时间
+func (s *orderService) afterCreateOrder(orderInfo model.OrderInfo) (err error) {
+	userId, goodsId := int(orderInfo.UserId), int(orderInfo.GoodsId)
 	// 创建订单信息缓存
 	if err = s.CreateOrderCache(orderInfo); err != nil {
 		return
 	}
+	// 记录秒杀成功的结果
+	if err = s.setSecondKillResult(userId, goodsId, model.SecondKillResult{
+		Status:  model.SecondKillOk,
+		OrderId: orderInfo.OrderId,
+	}); err != nil {
+		return
+	}
 	// 加入订单超时延迟队列
-	mq.OrderTimeout.Send(orderInfo.OrderId)
+	s.orderTimeout.Send(orderInfo.OrderId)
 	return
 }
 
@@ -175,7 +522,7 @@ func (s *orderService) GetOrderInfo(orderId string) (o model.OrderInfo, e error)
 			e = code.RecordNotFoundErr
 			return
 		}
-		println(e)
+		log.Printf("dao.QueryOrderInfoByOrderId() failed, err: %v, orderId: %s", e, orderId)
 		e = code.DBErr
 		return
 	}
@@ -191,24 +538,58 @@ func (s *orderService) GetOrderInfoVO(orderId string, userId int) (vo model.Orde
 		e = code.OrderNotFoundErr
 		return
 	}
-	vo = orderInfo.ToVO()
+	vo = orderInfo.ToVO(s.orderCfg.Expiration)
 	return
 }
 
-func (s *orderService) GetOrderInfoVOList(c model.OrderInfoQueryCondition) (list []model.OrderInfoVO, e error) {
+func (s *orderService) GetOrderInfoVOList(c model.OrderInfoQueryCondition) (page model.PageVO, e error) {
+	if e = c.PageDTO.Validate(); e != nil {
+		return
+	}
+	if c.Cursor != nil {
+		return s.getOrderInfoVOListByCursor(c, *c.Cursor)
+	}
+	var (
+		orderInfoList []model.OrderInfo
+		rows          int
+	)
+	if orderInfoList, rows, e = s.dao.QueryByCondition(c); e != nil {
+		e = code.DBErr
+		return
+	}
+	list := make([]model.OrderInfoVO, len(orderInfoList))
+	for i, v := range orderInfoList {
+		list[i] = v.ToVO(s.orderCfg.Expiration)
+	}
+	return model.NewPageVO(list, c.PageDTO, rows), nil
+}
+
+// 游标分页查询订单，多查询一条数据用于判断是否还有下一页
+func (s *orderService) getOrderInfoVOListByCursor(c model.OrderInfoQueryCondition, cursor uint) (page model.PageVO, e error) {
 	var orderInfoList []model.OrderInfo
-	if orderInfoList, e = s.dao.QueryByCondition(c); e != nil {
+	limit := c.PageDTO.GetLimit()
+	if orderInfoList, e = s.dao.QueryByCursor(c, cursor, limit+1); e != nil {
 		e = code.DBErr
 		return
 	}
-	list = make([]model.OrderInfoVO, len(orderInfoList))
+	var nextCursor uint
+	if len(orderInfoList) > limit {
+		orderInfoList = orderInfoList[:limit]
+		nextCursor = orderInfoList[limit-1].ID
+	}
+	list := make([]model.OrderInfoVO, len(orderInfoList))
 	for i, v := range orderInfoList {
-		list[i] = v.ToVO()
+		list[i] = v.ToVO(s.orderCfg.Expiration)
 	}
-	return
+	return model.NewCursorPageVO(list, c.PageDTO, cursor, nextCursor), nil
 }
 
 func (s *orderService) CloseOrder(userId int, orderId string) (e error) {
+	return s.closeOrder(userId, orderId, model.OperatorSystem)
+}
+
+// 关闭订单，返还数据库与缓存中的库存
+func (s *orderService) closeOrder(userId int, orderId string, operator string) (e error) {
 	var orderInfo model.OrderInfo
 	if orderInfo, e = s.GetOrderInfo(orderId); e != nil {
 		return
@@ -217,17 +598,25 @@ func (s *orderService) CloseOrder(userId int, orderId string) (e error) {
 		e = code.OrderNotFoundErr
 		return
 	}
-	if orderInfo.Status != model.Unpaid {
+	// 已关闭的订单可能在关闭后归还缓存库存失败，继续完成后续步骤
+	if orderInfo.Status != model.Unpaid && orderInfo.Status != model.Closed {
 		e = code.OrderStatusErr
 		return
 	}
-	if e = s.dao.CloseOrder(orderInfo); e != nil {
-		e = code.OrderCloseErr
-		return
+	if orderInfo.Status == model.Unpaid {
+		// 先标记将要归还库存，再在数据库中关闭订单
+		if e = s.markStockReturn(orderInfo); e != nil {
+			return
+		}
+		if e = s.dao.CloseOrder(orderInfo, operator); e != nil {
+			if !errors.Is(e, code.OrderStatusErr) {
+				e = code.OrderCloseErr
+			}
+			return
+		}
 	}
-	// 加缓存中的库存
-	if e = s.goodsService.IncrStock(int(orderInfo.GoodsId)); e != nil {
-		e = code.RedisErr
+	// 加缓存中的库存，订单关闭后不再计入已购数量，并释放秒杀锁使用户可以再次参与秒杀
+	if e = s.returnStock(orderInfo, true); e != nil {
 		return
 	}
 	// 删除订单缓存
@@ -236,7 +625,361 @@ func (s *orderService) CloseOrder(userId int, orderId string) (e error) {
 		return
 	}
 	// 移除延迟队列中的订单单号
-	mq.OrderTimeout.Remove(orderInfo.OrderId)
+	s.orderTimeout.Remove(orderInfo.OrderId)
+	return
+}
+
+func (s *orderService) CancelOrder(userId int, orderId string) (e error) {
+	e = s.closeOrder(userId, orderId, model.UserOperator(uint(userId)))
+	if errors.Is(e, code.OrderStatusErr) {
+		// 重复取消时订单已经是关闭状态，直接视为取消成功
+		if orderInfo, err := s.GetOrderInfo(orderId); err == nil && orderInfo.Status == model.Closed {
+			e = nil
+		}
+	}
+	return
+}
+
+func (s *orderService) GetOrderStatusHistory(userId int, orderId string) (list []model.OrderStatusHistory, e error) {
+	var orderInfo model.OrderInfo
+	if orderInfo, e = s.GetOrderInfo(orderId); e != nil {
+		return
+	}
+	if orderInfo.UserId != uint(userId) {
+		e = code.OrderNotFoundErr
+		return
+	}
+	return s.dao.QueryStatusHistory(orderId)
+}
+
+func (s *orderService) PayOrder(userId int, orderId string) (vo model.PayVO, e error) {
+	var (
+		orderInfo model.OrderInfo
+		res       payment.PayResponse
+	)
+	if orderInfo, e = s.GetOrderInfo(orderId); e != nil {
+		return
+	}
+	if orderInfo.UserId != uint(userId) {
+		e = code.OrderNotFoundErr
+		return
+	}
+	if orderInfo.Status != model.Unpaid {
+		e = code.OrderStatusErr
+		return
+	}
+	// 创建支付记录
+	p := model.Payment{
+		PaymentNo: createOrderId(),
+		OrderId:   orderInfo.OrderId,
+		UserId:    orderInfo.UserId,
+		Amount:    orderInfo.GetTotalPrice(),
+		Gateway:   s.gateway.Name(),
+		Status:    model.PaymentPaying,
+	}
+	p.CreatedAt = model.LocalTime(time.Now())
+	// 创建支付记录，订单状态：未支付 -> 支付中，并发发起支付时只有一个能成功
+	if e = s.dao.StartPayment(&p, model.OrderTransition{
+		OrderId:  orderId,
+		From:     model.Unpaid,
+		To:       model.Paying,
+		Operator: model.UserOperator(orderInfo.UserId),
+		Remark:   "发起支付：" + p.PaymentNo,
+	}); e != nil {
+		return
+	}
+	// 向支付网关发起支付
+	if res, e = s.gateway.Pay(payment.PayRequest{
+		PaymentNo: p.PaymentNo,
+		OrderId:   orderInfo.OrderId,
+		Amount:    p.Amount,
+		Subject:   orderInfo.GoodsName,
+	}); e != nil {
+		log.Printf("gateway.Pay() failed, err: %v, orderId: %s", e, orderId)
+		// 发起支付失败，订单回到未支付状态
+		if err := s.settlePayment(p, false, model.OperatorSystem, "发起支付失败"); err != nil {
+			log.Printf("settlePayment() failed, err: %v, orderId: %s", err, orderId)
+		}
+		e = code.PaymentGatewayErr
+		return
+	}
+	p.TradeNo = res.TradeNo
+	if e = s.paymentDao.Update(p); e != nil {
+		return
+	}
+	vo = model.PayVO{
+		OrderId:   orderInfo.OrderId,
+		PaymentNo: p.PaymentNo,
+		Amount:    p.Amount,
+		PayUrl:    res.PayUrl,
+	}
+	return
+}
+
+func (s *orderService) PaymentNotify(n payment.Notify) (e error) {
+	var p model.Payment
+	// 校验回调签名
+	if e = s.gateway.VerifyNotify(n); e != nil {
+		return
+	}
+	// 拒绝时间戳超出有效窗口的回调，防止签名回调被重放
+	window := s.paymentCfg.NotifyWindow
+	if window <= 0 {
+		window = DefaultNotifyWindow
+	}
+	if d := time.Now().Unix() - n.Timestamp; d > window || d < -window {
+		e = code.PaymentNotifyExpiredErr
+		return
+	}
+	if p, e = s.paymentDao.QueryByPaymentNo(n.PaymentNo); e != nil {
+		return
+	}
+	if p.OrderId != n.OrderId {
+		e = code.PaymentNotFoundErr
+		return
+	}
+	// 重复回调直接返回成功
+	if p.Status != model.PaymentPaying {
+		return
+	}
+	p.TradeNo = n.TradeNo
+	if n.Status != payment.NotifySuccess {
+		// 支付失败，订单回到未支付状态，等待用户重新支付或超时关闭
+		return s.settlePayment(p, false, model.OperatorPayment, "支付失败")
+	}
+	if n.Amount != payment.FormatAmount(p.Amount) {
+		e = code.PaymentAmountErr
+		return
+	}
+	return s.settlePayment(p, true, model.OperatorPayment, "支付成功")
+}
+
+func (s *orderService) ResolvePaying(orderInfo model.OrderInfo) (o model.OrderInfo, e error) {
+	var (
+		p   model.Payment
+		res payment.QueryResponse
+	)
+	if p, e = s.paymentDao.QueryByID(orderInfo.PaymentId); e != nil {
+		return
+	}
+	if p.Status == model.PaymentPaying {
+		// 回调可能已经丢失，主动向支付网关查询支付结果
+		if res, e = s.gateway.Query(p.PaymentNo); e != nil {
+			log.Printf("gateway.Query() failed, err: %v, orderId: %s", e, orderInfo.OrderId)
+			e = code.PaymentGatewayErr
+			return
+		}
+		if res.TradeNo != "" {
+			p.TradeNo = res.TradeNo
+		}
+		switch res.Status {
+		case payment.NotifySuccess:
+			if res.Amount != payment.FormatAmount(p.Amount) {
+				e = code.PaymentAmountErr
+				return
+			}
+			e = s.settlePayment(p, true, model.OperatorSystem, "查询到支付成功")
+		case payment.NotifyFail:
+			e = s.settlePayment(p, false, model.OperatorSystem, "查询到支付失败")
+		default:
+			// 超过支付等待时间仍未完成支付，订单回到未支付状态
+			timeout := s.paymentCfg.PayingTimeout
+			if timeout <= 0 {
+				timeout = DefaultPayingTimeout
+			}
+			if time.Since(time.Time(p.CreatedAt)) > time.Duration(timeout)*time.Second {
+				e = s.settlePayment(p, false, model.OperatorSystem, "支付超时")
+			}
+		}
+		if e != nil {
+			return
+		}
+	}
+	return s.GetOrderInfo(orderInfo.OrderId)
+}
+
+// 根据支付结果在一个事务中更新支付记录与订单状态
+// 支付成功时订单流转为已支付，支付失败时订单回到未支付状态
+func (s *orderService) settlePayment(p model.Payment, success bool, operator string, remark string) (e error) {
+	t := model.OrderTransition{
+		OrderId:  p.OrderId,
+		From:     model.Paying,
+		To:       model.Unpaid,
+		Operator: operator,
+		Remark:   remark + "：" + p.PaymentNo,
+	}
+	p.Status = model.PaymentFailed
+	if success {
+		t.To = model.Paid
+		p.Status = model.PaymentSuccess
+	}
+	if e = s.dao.SettlePayment(p, t); e != nil {
+		return
+	}
+	if success {
+		// 已支付的订单不再需要超时关闭
+		s.orderTimeout.Remove(p.OrderId)
+	}
+	return
+}
+
+func (s *orderService) RequestRefund(userId int, orderId string, reason string) (e error) {
+	var orderInfo model.OrderInfo
+	if orderInfo, e = s.GetOrderInfo(orderId); e != nil {
+		return
+	}
+	if orderInfo.UserId != uint(userId) {
+		e = code.OrderNotFoundErr
+		return
+	}
+	// 重复申请直接返回成功
+	if orderInfo.Status == model.Refunding {
+		return
+	}
+	// 订单状态：已支付 -> 退款中
+	return s.dao.Transit(model.OrderTransition{
+		OrderId:  orderId,
+		From:     model.Paid,
+		To:       model.Refunding,
+		Operator: model.UserOperator(orderInfo.UserId),
+		Remark:   "申请退款：" + reason,
+	})
+}
+
+func (s *orderService) AuditRefund(p model.Principal, orderId string, dto model.RefundAuditDTO) (e error) {
+	var orderInfo model.OrderInfo
+	if orderInfo, e = s.GetOrderInfo(orderId); e != nil {
+		return
+	}
+	// 商家只能审核自己商品的订单，拥有退款管理权限的用户可以审核任意订单
+	if _, e = s.goodsService.Authorize(p, int(orderInfo.GoodsId), model.PermRefundManage); e != nil {
+		return
+	}
+	// 重复审核通过时，上一次审核可能在退款后归还缓存库存失败，继续完成归还
+	if dto.Approve && orderInfo.Status == model.Refunded {
+		if s.orderCfg.RefundRestock {
+			e = s.returnStock(orderInfo, false)
+		}
+		return
+	}
+	operator := model.UserOperator(p.UserId)
+	if !dto.Approve {
+		// 拒绝退款，订单状态：退款中 -> 已支付
+		return s.dao.Transit(model.OrderTransition{
+			OrderId:  orderId,
+			From:     model.Refunding,
+			To:       model.Paid,
+			Operator: operator,
+			Remark:   "拒绝退款：" + dto.Remark,
+		})
+	}
+	if orderInfo.Status != model.Refunding {
+		e = code.OrderStatusErr
+		return
+	}
+	return s.refund(orderInfo, operator)
+}
+
+// 向支付网关发起退款并完成订单退款
+// 退款单号由支付流水号生成，支付网关保证同一退款单号只会退款一次，因此失败后可以安全地重试
+func (s *orderService) refund(orderInfo model.OrderInfo, operator string) (e error) {
+	var (
+		p   model.Payment
+		res payment.RefundResponse
+	)
+	if p, e = s.paymentDao.QueryByID(orderInfo.PaymentId); e != nil {
+		return
+	}
+	if res, e = s.gateway.Refund(payment.RefundRequest{
+		RefundNo:  "R" + p.PaymentNo,
+		PaymentNo: p.PaymentNo,
+		TradeNo:   p.TradeNo,
+		Amount:    p.Amount,
+		Reason:    "订单退款：" + orderInfo.OrderId,
+	}); e != nil {
+		log.Printf("gateway.Refund() failed, err: %v, orderId: %s", e, orderInfo.OrderId)
+		e = code.OrderRefundErr
+		return
+	}
+	p.RefundNo = res.RefundTradeNo
+	p.Status = model.PaymentRefunded
+	if e = s.paymentDao.Update(p); e != nil {
+		return
+	}
+	// 订单状态：退款中 -> 已退款，按配置把商品返还到秒杀库存中
+	restock := s.orderCfg.RefundRestock
+	if restock {
+		if e = s.markStockReturn(orderInfo); e != nil {
+			return
+		}
+	}
+	if e = s.dao.Refund(orderInfo, restock, operator); e != nil {
+		return
+	}
+	if restock {
+		return s.returnStock(orderInfo, false)
+	}
+	return
+}
+
+// 标记订单将要归还缓存库存，在数据库中关闭订单或退款之前调用
+// 状态保留到秒杀商品缓存清理时，之后库存缓存不存在，不再需要归还
+func (s *orderService) markStockReturn(orderInfo model.OrderInfo) (e error) {
+	var expire int64
+	if expire, e = s.stockReturnExpire(int(orderInfo.GoodsId)); e != nil {
+		return
+	}
+	k := fmt.Sprintf(StockReturnKey, orderInfo.OrderId)
+	if e = s.redis.Set(ctx, k, stockReturnPending, time.Duration(expire)*time.Second).Err(); e != nil {
+		log.Printf("redis.Set() failed, err: %v, orderId: %s", e, orderInfo.OrderId)
+		e = code.RedisErr
+	}
+	return
+}
+
+// 归还订单占用的缓存库存，只有标记了将要归还的订单才会归还，同一个订单只会归还一次
+// release 为 true 时同时扣减用户已购数量并释放秒杀锁
+func (s *orderService) returnStock(orderInfo model.OrderInfo, release bool) (e error) {
+	var (
+		expire int64
+		res    int
+	)
+	userId, goodsId := int(orderInfo.UserId), int(orderInfo.GoodsId)
+	if expire, e = s.stockReturnExpire(goodsId); e != nil {
+		return
+	}
+	keys := []string{
+		fmt.Sprintf(StockReturnKey, orderInfo.OrderId),
+		fmt.Sprintf(goods.GoodsStockKey, goodsId),
+		fmt.Sprintf(goods.GoodsSoldOutKey, goodsId),
+		fmt.Sprintf(BoughtKey, userId, goodsId),
+		fmt.Sprintf(LockKey, userId, goodsId),
+	}
+	releaseFlag := 0
+	if release {
+		releaseFlag = 1
+	}
+	if res, e = returnStockScript.Run(ctx, s.redis, keys, orderInfo.GetQuantity(), expire, releaseFlag).Int(); e != nil {
+		log.Printf("returnStockScript.Run() failed, err: %v, orderId: %s", e, orderInfo.OrderId)
+		e = code.RedisErr
+		return
+	}
+	if res == 1 {
+		s.goodsService.ReleaseSoldOut(goodsId)
+	}
+	return
+}
+
+// 订单归还库存状态的过期时间，保留到秒杀商品缓存清理时
+func (s *orderService) stockReturnExpire(goodsId int) (expire int64, e error) {
+	var g model.Goods
+	if g, e = s.goodsService.FindGoodsByID(goodsId); e != nil {
+		return
+	}
+	expire = s.goodsService.TearDownAt(g) - time.Now().Unix()
+	if expire < int64(LockExpire.Seconds()) {
+		expire = int64(LockExpire.Seconds())
+	}
 	return
 }
 
@@ -250,8 +993,12 @@ func (s *orderService) CreateOrderCache(order model.OrderInfo) (err error) {
 }
 
 func (s *orderService) DeleteOrderCache(order model.OrderInfo) (err error) {
-	k := fmt.Sprintf(OrderIdKey, order.UserId, order.GoodsId)
-	if err = s.redis.Del(ctx, k).Err(); err != nil {
+	// 同时删除秒杀结果，使用户可以再次参与秒杀
+	keys := []string{
+		fmt.Sprintf(OrderIdKey, order.UserId, order.GoodsId),
+		fmt.Sprintf(SecondKillResultKey, order.UserId, order.GoodsId),
+	}
+	if err = s.redis.Del(ctx, keys...).Err(); err != nil {
 		log.Printf("redis.Del() falied, err: %v, order: %v", err, order)
 		err = code.RedisErr
 	}
@@ -274,15 +1021,17 @@ func (s *orderService) GetOrderId(userId, goodsId int) (orderId string, err erro
 }
 
 // 创建订单信息
-func (s *orderService)newOrderInfo(userId int, goods model.Goods) model.OrderInfo {
+func (s *orderService) newOrderInfo(orderId string, userId int, goods model.Goods, quantity int) model.OrderInfo {
 	orderInfo := model.OrderInfo{
-		OrderId:    createOrderId(),
-		UserId: uint(userId),
+		OrderId:    orderId,
+		UserId:     uint(userId),
 		GoodsId:    goods.ID,
 		GoodsName:  goods.Name,
 		GoodsImg:   goods.Img,
 		GoodsPrice: goods.Price,
-		Status:     model.Unpaid,		// 默认未支付
+		Quantity:   quantity,
+		TotalPrice: goods.Price * float64(quantity),
+		Status:     model.Unpaid, // 默认未支付
 	}
 	return orderInfo
 }
@@ -292,22 +1041,6 @@ func createOrderId() string {
 	return time.Now().Format("20060102150405") + key.CreateKey(key.Number, 6)
 }
 
-// 尝试获取锁
-func (s *orderService) tryLock(userId, goodsId int, lockId int64) (err error) {
-	var res bool
-	// 用以识别具体的个人
-	k := fmt.Sprintf(LockKey, userId, goodsId)
-	if res, err = s.redis.SetNX(ctx, k, lockId, time.Minute).Result(); err != nil {
-		log.Printf("redis.SetNx() failed, err: %v", err)
-		err = code.RedisErr
-		return
-	}
-	if !res {
-		err = code.SeckillFailedErr
-	}
-	return
-}
-
 // UnLock 释放锁
 func (s *orderService) UnLock(userId, goodsId int) (err error) {
 	k := fmt.Sprintf(LockKey, userId, goodsId)
@@ -316,4 +1049,4 @@ func (s *orderService) UnLock(userId, goodsId int) (err error) {
 		err = code.RedisErr
 	}
 	return
-}
\ No newline at end of file
+}
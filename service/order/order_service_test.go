@@ -0,0 +1,213 @@
+package order
+
+import (
+	"fmt"
+	"seckill/conf"
+	"seckill/infra/code"
+	"seckill/model"
+	"seckill/payment/mock"
+	"seckill/service/goods"
+	"testing"
+)
+
+func (d *fakeOrderDao) CloseOrder(orderInfo model.OrderInfo, operator string) error {
+	return d.transit(model.OrderTransition{OrderId: orderInfo.OrderId, From: model.Unpaid, To: model.Closed,
+		Operator: operator})
+}
+
+func (d *fakeOrderDao) Transit(t model.OrderTransition) error {
+	return d.transit(t)
+}
+
+func (d *fakeOrderDao) Refund(orderInfo model.OrderInfo, restock bool, operator string) error {
+	return d.transit(model.OrderTransition{OrderId: orderInfo.OrderId, From: model.Refunding, To: model.Refunded,
+		Operator: operator})
+}
+
+// 用户 1 以 2 件的数量秒杀了商家 9 的商品，订单占用的缓存库存为 2
+func newTestCloseService(t *testing.T, status int8, stockReturn string) (*orderService, *fakeOrderDao, func(string) string) {
+	t.Helper()
+	mr, s := newTestSeckillService(t, model.Goods{UserId: 9, LimitPerUser: 2}, conf.Risk{})
+	o := &model.OrderInfo{OrderId: "O1", UserId: 1, GoodsId: testGoodsId, Quantity: 2, Status: status}
+	o.ID = 1
+	orders := &fakeOrderDao{payments: &fakePaymentDao{}, orders: map[string]*model.OrderInfo{"O1": o}}
+	s.dao = orders
+	init := map[string]string{
+		fmt.Sprintf(goods.GoodsStockKey, testGoodsId):   "8",
+		fmt.Sprintf(goods.GoodsSoldOutKey, testGoodsId): "1",
+		fmt.Sprintf(BoughtKey, 1, testGoodsId):          "2",
+		fmt.Sprintf(LockKey, 1, testGoodsId):            "1",
+		fmt.Sprintf(OrderIdKey, 1, testGoodsId):         "O1",
+	}
+	if stockReturn != "" {
+		init[fmt.Sprintf(StockReturnKey, "O1")] = stockReturn
+	}
+	for k, v := range init {
+		if err := mr.Set(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.goodsService.MarkSoldOut(testGoodsId)
+	get := func(k string) string {
+		v, _ := mr.Get(k)
+		return v
+	}
+	return s, orders, get
+}
+
+func TestCancelOrder(t *testing.T) {
+	tests := []struct {
+		name        string
+		userId      int
+		status      int8
+		stockReturn string
+		want        error
+		stock       string
+		bought      string
+	}{
+		{"取消未支付订单", 1, model.Unpaid, "", nil, "10", ""},
+		{"不是自己的订单", 2, model.Unpaid, "", code.OrderNotFoundErr, "8", "2"},
+		{"已支付订单不能取消", 1, model.Paid, "", code.OrderStatusErr, "8", "2"},
+		{"关闭后归还库存失败时继续归还", 1, model.Closed, stockReturnPending, nil, "10", ""},
+		{"重复取消不重复归还库存", 1, model.Closed, stockReturnDone, nil, "8", "2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, orders, get := newTestCloseService(t, tt.status, tt.stockReturn)
+			if err := s.CancelOrder(tt.userId, "O1"); err != tt.want {
+				t.Fatalf("CancelOrder() error = %v, want %v", err, tt.want)
+			}
+			if got := get(fmt.Sprintf(goods.GoodsStockKey, testGoodsId)); got != tt.stock {
+				t.Errorf("stock = %q, want %q", got, tt.stock)
+			}
+			if got := get(fmt.Sprintf(BoughtKey, 1, testGoodsId)); got != tt.bought {
+				t.Errorf("bought = %q, want %q", got, tt.bought)
+			}
+			// 归还库存后清除售罄标识，并释放秒杀锁
+			returned := tt.stock == "10"
+			if got := s.goodsService.IsSoldOut(testGoodsId); got == returned {
+				t.Errorf("IsSoldOut() = %v, want %v", got, !returned)
+			}
+			if got := get(fmt.Sprintf(LockKey, 1, testGoodsId)); (got == "") != returned {
+				t.Errorf("lock = %q, released want %v", got, returned)
+			}
+			if tt.want != nil {
+				return
+			}
+			if got := get(fmt.Sprintf(StockReturnKey, "O1")); got != stockReturnDone {
+				t.Errorf("stock return = %q, want %q", got, stockReturnDone)
+			}
+			if got := get(fmt.Sprintf(OrderIdKey, 1, testGoodsId)); got != "" {
+				t.Errorf("order cache = %q, want deleted", got)
+			}
+			if orders.orders["O1"].Status != model.Closed {
+				t.Errorf("status = %d, want %d", orders.orders["O1"].Status, model.Closed)
+			}
+		})
+	}
+}
+
+func TestCloseOrderOperator(t *testing.T) {
+	s, orders, _ := newTestCloseService(t, model.Unpaid, "")
+	if err := s.CloseOrder(1, "O1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(orders.history) != 1 || orders.history[0].Operator != model.OperatorSystem {
+		t.Errorf("history = %+v, want closed by %s", orders.history, model.OperatorSystem)
+	}
+	// 重复关闭时订单已是关闭状态，不再修改数据库
+	if err := s.CloseOrder(1, "O1"); err != nil || len(orders.history) != 1 {
+		t.Errorf("CloseOrder() on closed order error = %v, history = %+v", err, orders.history)
+	}
+}
+
+// 在 newTestCloseService 的基础上为订单 O1 添加一条支付成功的支付记录
+func newTestRefundService(t *testing.T, status int8, restock bool, stockReturn string) (*orderService, *fakeOrderDao, func(string) string) {
+	t.Helper()
+	s, orders, get := newTestCloseService(t, status, stockReturn)
+	s.orderCfg.RefundRestock = restock
+	s.gateway = mock.New(conf.Payment{}, testPaymentSecret)
+	s.paymentDao = orders.payments
+	_ = orders.payments.Insert(&model.Payment{OrderId: "O1", PaymentNo: "P1", TradeNo: "T1", Amount: 9.9,
+		Status: model.PaymentSuccess})
+	orders.orders["O1"].PaymentId = 1
+	return s, orders, get
+}
+
+func TestRequestRefund(t *testing.T) {
+	tests := []struct {
+		name   string
+		userId int
+		status int8
+		want   error
+		to     int8
+	}{
+		{"申请退款", 1, model.Paid, nil, model.Refunding},
+		{"重复申请", 1, model.Refunding, nil, model.Refunding},
+		{"不是自己的订单", 2, model.Paid, code.OrderNotFoundErr, model.Paid},
+		{"未支付订单不能退款", 1, model.Unpaid, code.OrderStatusErr, model.Unpaid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, orders, _ := newTestRefundService(t, tt.status, false, "")
+			if err := s.RequestRefund(tt.userId, "O1", "不想要了"); err != tt.want {
+				t.Errorf("RequestRefund() error = %v, want %v", err, tt.want)
+			}
+			if got := orders.orders["O1"].Status; got != tt.to {
+				t.Errorf("status = %d, want %d", got, tt.to)
+			}
+		})
+	}
+}
+
+func TestAuditRefund(t *testing.T) {
+	seller := model.NewPrincipal(9, []string{model.RoleSeller})
+	tests := []struct {
+		name        string
+		principal   model.Principal
+		approve     bool
+		status      int8
+		restock     bool
+		stockReturn string
+		want        error
+		to          int8
+		stock       string
+	}{
+		{"商家审核通过并返还库存", seller, true, model.Refunding, true, "", nil, model.Refunded, "10"},
+		{"审核通过不返还库存", seller, true, model.Refunding, false, "", nil, model.Refunded, "8"},
+		{"运营审核任意商品的退款", model.NewPrincipal(7, []string{model.RoleOperator}), true, model.Refunding, true, "", nil,
+			model.Refunded, "10"},
+		{"其他商家无权审核", model.NewPrincipal(8, []string{model.RoleSeller}), true, model.Refunding, true, "",
+			code.StatusForbiddenErr, model.Refunding, "8"},
+		{"拒绝退款", seller, false, model.Refunding, true, "", nil, model.Paid, "8"},
+		{"订单不在退款中", seller, true, model.Paid, true, "", code.OrderStatusErr, model.Paid, "8"},
+		{"重复审核时继续归还库存", seller, true, model.Refunded, true, stockReturnPending, nil, model.Refunded, "10"},
+		{"重复审核不重复归还库存", seller, true, model.Refunded, true, stockReturnDone, nil, model.Refunded, "8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, orders, get := newTestRefundService(t, tt.status, tt.restock, tt.stockReturn)
+			if err := s.AuditRefund(tt.principal, "O1", model.RefundAuditDTO{Approve: tt.approve}); err != tt.want {
+				t.Fatalf("AuditRefund() error = %v, want %v", err, tt.want)
+			}
+			if got := orders.orders["O1"].Status; got != tt.to {
+				t.Errorf("status = %d, want %d", got, tt.to)
+			}
+			if got := get(fmt.Sprintf(goods.GoodsStockKey, testGoodsId)); got != tt.stock {
+				t.Errorf("stock = %q, want %q", got, tt.stock)
+			}
+			// 退款的订单仍计入已购数量
+			if got := get(fmt.Sprintf(BoughtKey, 1, testGoodsId)); got != "2" {
+				t.Errorf("bought = %q, want %q", got, "2")
+			}
+			p := orders.payments.list[0]
+			if refunded := tt.want == nil && tt.approve && tt.status == model.Refunding; refunded {
+				if p.Status != model.PaymentRefunded || p.RefundNo == "" {
+					t.Errorf("payment = %+v, want refunded", p)
+				}
+			} else if p.Status != model.PaymentSuccess {
+				t.Errorf("payment status = %d, want %d", p.Status, model.PaymentSuccess)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package order
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"seckill/conf"
+	"seckill/dao"
+	"seckill/infra/code"
+	"seckill/model"
+	"seckill/mq"
+	"seckill/payment"
+	"seckill/payment/mock"
+	"testing"
+	"time"
+)
+
+// 内存中的 dao.IOrderDao，只实现订单服务测试用到的方法
+type fakeOrderDao struct {
+	dao.IOrderDao
+	orders   map[string]*model.OrderInfo
+	payments *fakePaymentDao
+	history  []model.OrderTransition
+}
+
+func (d *fakeOrderDao) QueryOrderInfoByOrderId(id string) (model.OrderInfo, error) {
+	o, ok := d.orders[id]
+	if !ok {
+		return model.OrderInfo{}, gorm.ErrRecordNotFound
+	}
+	return *o, nil
+}
+
+func (d *fakeOrderDao) StartPayment(p *model.Payment, t model.OrderTransition) error {
+	if err := d.transit(t); err != nil {
+		return err
+	}
+	_ = d.payments.Insert(p)
+	d.orders[t.OrderId].PaymentId = int(p.ID)
+	return nil
+}
+
+func (d *fakeOrderDao) SettlePayment(p model.Payment, t model.OrderTransition) error {
+	stored := d.payments.list[p.ID-1]
+	if stored.Status != model.PaymentPaying {
+		return nil
+	}
+	stored.Status, stored.TradeNo = p.Status, p.TradeNo
+	return d.transit(t)
+}
+
+func (d *fakeOrderDao) transit(t model.OrderTransition) error {
+	o := d.orders[t.OrderId]
+	if !model.CanTransit(t.From, t.To) || o.Status != t.From {
+		return code.OrderStatusErr
+	}
+	o.Status = t.To
+	d.history = append(d.history, t)
+	return nil
+}
+
+// 内存中的 dao.IPaymentDao
+type fakePaymentDao struct {
+	list []*model.Payment
+}
+
+func (d *fakePaymentDao) Insert(p *model.Payment) error {
+	p.ID = uint(len(d.list) + 1)
+	stored := *p
+	d.list = append(d.list, &stored)
+	return nil
+}
+
+func (d *fakePaymentDao) QueryByID(id int) (model.Payment, error) {
+	if id <= 0 || id > len(d.list) {
+		return model.Payment{}, code.PaymentNotFoundErr
+	}
+	return *d.list[id-1], nil
+}
+
+func (d *fakePaymentDao) QueryByPaymentNo(paymentNo string) (model.Payment, error) {
+	for _, p := range d.list {
+		if p.PaymentNo == paymentNo {
+			return *p, nil
+		}
+	}
+	return model.Payment{}, code.PaymentNotFoundErr
+}
+
+func (d *fakePaymentDao) Update(p model.Payment) error {
+	*d.list[p.ID-1] = p
+	return nil
+}
+
+// 发起支付总是失败的支付网关
+type failingGateway struct {
+	payment.IPaymentGateway
+}
+
+func (g failingGateway) Pay(payment.PayRequest) (payment.PayResponse, error) {
+	return payment.PayResponse{}, errors.New("gateway unavailable")
+}
+
+const testPaymentSecret = "secret"
+
+// 创建使用内存 dao 与模拟支付网关的 orderService，包含一个用户 1 未支付的订单 O1
+func newTestPaymentService(t *testing.T, gateway payment.IPaymentGateway) (*orderService, *fakeOrderDao) {
+	t.Helper()
+	_, rdb := newTestRedis(t)
+	payments := &fakePaymentDao{}
+	orders := &fakeOrderDao{payments: payments, orders: map[string]*model.OrderInfo{
+		"O1": {OrderId: "O1", UserId: 1, GoodsPrice: 4.95, Quantity: 2, Status: model.Unpaid},
+	}}
+	if gateway == nil {
+		gateway = mock.New(conf.Payment{}, testPaymentSecret)
+	}
+	s := NewOrderService(orders, payments, nil, nil, gateway, mq.NewOrderTimeoutQueue(rdb, 60), rdb,
+		conf.Order{}, conf.Payment{}, conf.Captcha{}, conf.Risk{})
+	return s, orders
+}
+
+func TestPayOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		userId  int
+		orderId string
+		status  int8
+		want    error
+	}{
+		{"发起支付", 1, "O1", model.Unpaid, nil},
+		{"不是自己的订单", 2, "O1", model.Unpaid, code.OrderNotFoundErr},
+		{"订单不存在", 1, "O2", model.Unpaid, code.RecordNotFoundErr},
+		{"订单已关闭", 1, "O1", model.Closed, code.OrderStatusErr},
+		{"订单支付中", 1, "O1", model.Paying, code.OrderStatusErr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, orders := newTestPaymentService(t, nil)
+			orders.orders["O1"].Status = tt.status
+			vo, err := s.PayOrder(tt.userId, tt.orderId)
+			if err != tt.want {
+				t.Fatalf("PayOrder() error = %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				if len(orders.payments.list) != 0 {
+					t.Errorf("PayOrder() created %d payments, want none", len(orders.payments.list))
+				}
+				return
+			}
+			p := orders.payments.list[0]
+			if vo.Amount != 9.9 || vo.PaymentNo != p.PaymentNo || p.TradeNo == "" || p.Status != model.PaymentPaying {
+				t.Errorf("PayOrder() = %+v, payment %+v", vo, p)
+			}
+			if o := orders.orders["O1"]; o.Status != model.Paying || o.PaymentId != int(p.ID) {
+				t.Errorf("order = %+v, want paying with payment id %d", o, p.ID)
+			}
+		})
+	}
+}
+
+// 发起支付失败时订单回到未支付状态，支付记录标记为失败，不会留下支付中的支付记录
+func TestPayOrderGatewayFailed(t *testing.T) {
+	s, orders := newTestPaymentService(t, failingGateway{mock.New(conf.Payment{}, testPaymentSecret)})
+	if _, err := s.PayOrder(1, "O1"); err != code.PaymentGatewayErr {
+		t.Fatalf("PayOrder() error = %v, want %v", err, code.PaymentGatewayErr)
+	}
+	if o := orders.orders["O1"]; o.Status != model.Unpaid {
+		t.Errorf("order status = %s, want %s", model.OrderStatusName(o.Status), model.OrderStatusName(model.Unpaid))
+	}
+	if p := orders.payments.list[0]; p.Status != model.PaymentFailed {
+		t.Errorf("payment status = %d, want %d", p.Status, model.PaymentFailed)
+	}
+	// 用户可以重新发起支付
+	if _, err := s.PayOrder(1, "O1"); err != code.PaymentGatewayErr {
+		t.Errorf("PayOrder() retry error = %v, want %v", err, code.PaymentGatewayErr)
+	}
+}
+
+func TestPaymentNotify(t *testing.T) {
+	now := time.Now().Unix()
+	tests := []struct {
+		name      string
+		orderId   string
+		amount    string
+		status    string
+		timestamp int64
+		secret    string
+		want      error
+		order     int8
+	}{
+		{"支付成功", "O1", "9.90", payment.NotifySuccess, now, testPaymentSecret, nil, model.Paid},
+		{"支付失败", "O1", "9.90", payment.NotifyFail, now, testPaymentSecret, nil, model.Unpaid},
+		{"签名错误", "O1", "9.90", payment.NotifySuccess, now, "other", code.PaymentSignErr, model.Paying},
+		{"回调已过期", "O1", "9.90", payment.NotifySuccess, now - DefaultNotifyWindow - 1, testPaymentSecret,
+			code.PaymentNotifyExpiredErr, model.Paying},
+		{"金额不一致", "O1", "0.01", payment.NotifySuccess, now, testPaymentSecret, code.PaymentAmountErr, model.Paying},
+		{"订单不一致", "O2", "9.90", payment.NotifySuccess, now, testPaymentSecret, code.PaymentNotFoundErr, model.Paying},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, orders := newTestPaymentService(t, nil)
+			vo, err := s.PayOrder(1, "O1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			n := payment.Notify{PaymentNo: vo.PaymentNo, TradeNo: "T1", OrderId: tt.orderId, Amount: tt.amount,
+				Status: tt.status, Timestamp: tt.timestamp}
+			n.Sign = payment.Sign(n.Params(), tt.secret)
+			if err := s.PaymentNotify(n); err != tt.want {
+				t.Fatalf("PaymentNotify() error = %v, want %v", err, tt.want)
+			}
+			if o := orders.orders["O1"]; o.Status != tt.order {
+				t.Errorf("order status = %s, want %s", model.OrderStatusName(o.Status), model.OrderStatusName(tt.order))
+			}
+			// 重复回调直接返回成功，不会再次流转订单状态
+			if tt.want == nil {
+				history := len(orders.history)
+				if err := s.PaymentNotify(n); err != nil || len(orders.history) != history {
+					t.Errorf("duplicate PaymentNotify() error = %v, transitions %d, want %d", err, len(orders.history), history)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package order
+
+import "github.com/go-redis/redis/v8"
+
+// 秒杀准入脚本的返回码
+const (
+	// admitOk 准入成功，库存已预减且消息已入队
+	admitOk = 0
+	// admitRepeated 重复秒杀，上一次秒杀还在处理中
+	admitRepeated = 1
+	// admitSaleOut 商品已售罄
+	admitSaleOut = 2
+	// admitExceedLimit 超出每人限购数量
+	admitExceedLimit = 3
+	// admitStockNotEnough 剩余库存不足购买数量
+	admitStockNotEnough = 4
+	// admitNotReady 商品库存缓存还未预热或已被清理
+	admitNotReady = 5
+)
+
+// 订单归还缓存库存的状态
+const (
+	// stockReturnPending 订单将要归还库存，在数据库中关闭订单或退款之前设置
+	stockReturnPending = "pending"
+	// stockReturnDone 订单已经归还库存
+	stockReturnDone = "done"
+)
+
+// returnStockScript 归还订单占用的缓存库存，只有归还状态为 stockReturnPending 时才归还，归还后设置为 stockReturnDone，
+// 数据库已提交而归还失败时可以安全地重试，不会重复归还；库存缓存不存在时只修改归还状态。
+// 返回 1 表示已归还并且库存缓存存在，需要清除售罄标识，其他情况返回 0
+// KEYS[1]：订单归还库存状态 key，即 StockReturnKey
+// KEYS[2]：商品库存缓存 key，KEYS[3]：商品售罄标识 key
+// KEYS[4]：用户已购数量 key，即 BoughtKey，KEYS[5]：秒杀锁 key，即 LockKey
+// ARGV[1]：归还的数量，ARGV[2]：归还状态的过期时间，单位：秒
+// ARGV[3]：为 1 时同时扣减用户已购数量并释放秒杀锁
+var returnStockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= '` + stockReturnPending + `' then
+	return 0
+end
+redis.call('SET', KEYS[1], '` + stockReturnDone + `', 'EX', ARGV[2])
+if ARGV[3] == '1' then
+	if redis.call('EXISTS', KEYS[4]) == 1 and redis.call('DECRBY', KEYS[4], ARGV[1]) <= 0 then
+		redis.call('DEL', KEYS[4])
+	end
+	redis.call('DEL', KEYS[5])
+end
+if redis.call('EXISTS', KEYS[2]) == 0 then
+	return 0
+end
+redis.call('INCRBY', KEYS[2], ARGV[1])
+redis.call('DEL', KEYS[3])
+return 1
+`)
+
+// consumePathScript 校验并消费秒杀地址，地址一致时删除，保证一个秒杀地址只能使用一次
+// KEYS[1]：秒杀地址 key，即 SecondKillPathKey
+// ARGV[1]：请求携带的秒杀地址
+var consumePathScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// releaseBoughtScript 扣减用户已购数量
+// 已购数量已过期时不做处理，避免创建一个没有过期时间的负数计数让用户超出限购，扣减后不大于 0 时直接删除
+// KEYS[1]：用户已购数量 key，即 BoughtKey
+// ARGV[1]：扣减的数量
+var releaseBoughtScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+if redis.call('DECRBY', KEYS[1], ARGV[1]) <= 0 then
+	redis.call('DEL', KEYS[1])
+end
+return 1
+`)
+
+// secondKillScript 秒杀准入 Lua 脚本
+// 把 重复秒杀校验、限购校验、预减库存、售罄判断、异步下单消息入队 放在 redis 服务端一次性原子执行，
+// 避免多次往返之间服务崩溃导致的库存泄露或锁残留。
+//
+// KEYS[1]：用户已购数量 key，即 BoughtKey
+// KEYS[2]：秒杀锁 key，即 LockKey
+// KEYS[3]：商品库存缓存 key
+// KEYS[4]：预创建订单队列 key
+// KEYS[5]：秒杀结果缓存 key，准入成功时清除上一次的秒杀结果
+// KEYS[6]：商品售罄标识 key，库存为 0 时设置
+// ARGV[1]：锁的值
+// ARGV[2]：锁的过期时间，单位：秒
+// ARGV[3]：预创建订单消息
+// ARGV[4]：购买数量
+// ARGV[5]：每人限购数量
+// ARGV[6]：已购数量的过期时间，单位：秒
+var secondKillScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	return 1
+end
+local quantity = tonumber(ARGV[4])
+local bought = tonumber(redis.call('GET', KEYS[1])) or 0
+if bought + quantity > tonumber(ARGV[5]) then
+	return 3
+end
+if redis.call('EXISTS', KEYS[6]) == 1 then
+	return 2
+end
+local stock = tonumber(redis.call('GET', KEYS[3]))
+if stock == nil then
+	return 5
+end
+if stock <= 0 then
+	redis.call('SET', KEYS[6], 1)
+	return 2
+end
+if stock < quantity then
+	return 4
+end
+redis.call('DECRBY', KEYS[3], quantity)
+redis.call('INCRBY', KEYS[1], quantity)
+redis.call('EXPIRE', KEYS[1], ARGV[6])
+redis.call('SET', KEYS[2], ARGV[1], 'EX', ARGV[2])
+redis.call('LPUSH', KEYS[4], ARGV[3])
+redis.call('DEL', KEYS[5])
+return 0
+`)
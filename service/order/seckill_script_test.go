@@ -0,0 +1,227 @@
+package order
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"testing"
+)
+
+// 创建连接到 miniredis 的 redis 客户端
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+	return mr, redis.NewClient(&redis.Options{Addr: mr.Addr()})
+}
+
+func TestSecondKillScript(t *testing.T) {
+	keys := []string{"bought", "lock", "stock", "queue", "result", "sold_out"}
+	tests := []struct {
+		name     string
+		init     map[string]string
+		quantity int
+		limit    int
+		want     int64
+		stock    string
+		bought   string
+		soldOut  bool
+	}{
+		{"准入成功", map[string]string{"stock": "10"}, 2, 5, admitOk, "8", "2", false},
+		{"累计已购未超出限购", map[string]string{"stock": "10", "bought": "3"}, 2, 5, admitOk, "8", "5", false},
+		{"重复秒杀", map[string]string{"stock": "10", "lock": "1"}, 1, 5, admitRepeated, "10", "", false},
+		{"超出限购", map[string]string{"stock": "10", "bought": "4"}, 2, 5, admitExceedLimit, "10", "4", false},
+		{"售罄标识", map[string]string{"stock": "10", "sold_out": "1"}, 1, 5, admitSaleOut, "10", "", true},
+		{"库存为 0 时设置售罄标识", map[string]string{"stock": "0"}, 1, 5, admitSaleOut, "0", "", true},
+		{"库存不足购买数量", map[string]string{"stock": "1"}, 2, 5, admitStockNotEnough, "1", "", false},
+		{"库存未预热时不设置售罄标识", nil, 1, 5, admitNotReady, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, rdb := newTestRedis(t)
+			for k, v := range tt.init {
+				mr.Set(k, v)
+			}
+			mr.Set("result", "failed")
+			got, err := secondKillScript.Run(ctx, rdb, keys, "lock-value", 10, "message", tt.quantity, tt.limit, 60).Int64()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("secondKillScript = %d, want %d", got, tt.want)
+			}
+			stock, _ := mr.Get("stock")
+			bought, _ := mr.Get("bought")
+			if stock != tt.stock || bought != tt.bought {
+				t.Errorf("stock, bought = (%q, %q), want (%q, %q)", stock, bought, tt.stock, tt.bought)
+			}
+			if mr.Exists("sold_out") != tt.soldOut {
+				t.Errorf("sold out flag = %v, want %v", mr.Exists("sold_out"), tt.soldOut)
+			}
+			queue, _ := mr.List("queue")
+			if tt.want == admitOk {
+				if lock, _ := mr.Get("lock"); lock != "lock-value" || mr.TTL("lock") <= 0 {
+					t.Errorf("lock = %q ttl %v, want lock-value with ttl", lock, mr.TTL("lock"))
+				}
+				if mr.TTL("bought") <= 0 {
+					t.Error("bought has no ttl")
+				}
+				if len(queue) != 1 || queue[0] != "message" {
+					t.Errorf("queue = %v, want [message]", queue)
+				}
+				if mr.Exists("result") {
+					t.Error("previous seckill result is not cleared")
+				}
+				return
+			}
+			if len(queue) != 0 {
+				t.Errorf("queue = %v, want empty", queue)
+			}
+		})
+	}
+}
+
+func TestConsumePathScript(t *testing.T) {
+	tests := []struct {
+		name   string
+		stored string
+		path   string
+		want   int64
+		remain bool
+	}{
+		{"地址一致时消费", "abc", "abc", 1, false},
+		{"地址不一致", "abc", "abd", 0, true},
+		{"地址不存在", "", "abc", 0, false},
+		{"空地址", "", "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, rdb := newTestRedis(t)
+			if tt.stored != "" {
+				mr.Set("path", tt.stored)
+			}
+			got, err := consumePathScript.Run(ctx, rdb, []string{"path"}, tt.path).Int64()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || mr.Exists("path") != tt.remain {
+				t.Errorf("consumePathScript = %d, path exists %v, want %d, %v", got, mr.Exists("path"), tt.want, tt.remain)
+			}
+		})
+	}
+	// 同一个地址只能使用一次
+	mr, rdb := newTestRedis(t)
+	mr.Set("path", "abc")
+	first, _ := consumePathScript.Run(ctx, rdb, []string{"path"}, "abc").Int64()
+	second, _ := consumePathScript.Run(ctx, rdb, []string{"path"}, "abc").Int64()
+	if first != 1 || second != 0 {
+		t.Errorf("consumePathScript twice = (%d, %d), want (1, 0)", first, second)
+	}
+}
+
+func TestReleaseBoughtScript(t *testing.T) {
+	tests := []struct {
+		name     string
+		bought   string
+		quantity int
+		want     int64
+		remain   string
+	}{
+		{"扣减已购数量", "5", 2, 1, "3"},
+		{"扣减为 0 时删除", "2", 2, 1, ""},
+		{"扣减为负数时删除", "1", 2, 1, ""},
+		{"已购数量已过期", "", 2, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, rdb := newTestRedis(t)
+			if tt.bought != "" {
+				mr.Set("bought", tt.bought)
+			}
+			got, err := releaseBoughtScript.Run(ctx, rdb, []string{"bought"}, tt.quantity).Int64()
+			if err != nil {
+				t.Fatal(err)
+			}
+			remain, _ := mr.Get("bought")
+			if got != tt.want || remain != tt.remain {
+				t.Errorf("releaseBoughtScript = (%d, %q), want (%d, %q)", got, remain, tt.want, tt.remain)
+			}
+		})
+	}
+}
+
+func TestReturnStockScript(t *testing.T) {
+	keys := []string{"marker", "stock", "sold_out", "bought", "lock"}
+	tests := []struct {
+		name    string
+		init    map[string]string
+		release string
+		want    int64
+		stock   string
+		bought  string
+		marker  string
+		soldOut bool
+		lock    bool
+	}{
+		{
+			name:    "归还库存并清除售罄标识",
+			init:    map[string]string{"marker": stockReturnPending, "stock": "0", "sold_out": "1", "bought": "2", "lock": "1"},
+			release: "0",
+			want:    1, stock: "2", bought: "2", marker: stockReturnDone, lock: true,
+		},
+		{
+			name:    "同时释放已购数量与秒杀锁",
+			init:    map[string]string{"marker": stockReturnPending, "stock": "3", "bought": "2", "lock": "1"},
+			release: "1",
+			want:    1, stock: "5", bought: "", marker: stockReturnDone,
+		},
+		{
+			name:    "已经归还过时不重复归还",
+			init:    map[string]string{"marker": stockReturnDone, "stock": "3", "sold_out": "1", "bought": "2", "lock": "1"},
+			release: "1",
+			want:    0, stock: "3", bought: "2", marker: stockReturnDone, soldOut: true, lock: true,
+		},
+		{
+			name:    "没有归还标记的历史订单不归还",
+			init:    map[string]string{"stock": "3", "bought": "2"},
+			release: "1",
+			want:    0, stock: "3", bought: "2", marker: "",
+		},
+		{
+			name:    "库存缓存不存在时只修改归还状态",
+			init:    map[string]string{"marker": stockReturnPending, "bought": "3", "lock": "1"},
+			release: "1",
+			want:    0, stock: "", bought: "1", marker: stockReturnDone,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, rdb := newTestRedis(t)
+			for k, v := range tt.init {
+				mr.Set(k, v)
+			}
+			got, err := returnStockScript.Run(ctx, rdb, keys, 2, 60, tt.release).Int64()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("returnStockScript = %d, want %d", got, tt.want)
+			}
+			stock, _ := mr.Get("stock")
+			bought, _ := mr.Get("bought")
+			marker, _ := mr.Get("marker")
+			if stock != tt.stock || bought != tt.bought || marker != tt.marker {
+				t.Errorf("stock, bought, marker = (%q, %q, %q), want (%q, %q, %q)",
+					stock, bought, marker, tt.stock, tt.bought, tt.marker)
+			}
+			if mr.Exists("sold_out") != tt.soldOut || mr.Exists("lock") != tt.lock {
+				t.Errorf("sold out, lock = (%v, %v), want (%v, %v)", mr.Exists("sold_out"), mr.Exists("lock"), tt.soldOut, tt.lock)
+			}
+			if tt.marker == stockReturnDone && tt.init["marker"] == stockReturnPending && mr.TTL("marker") <= 0 {
+				t.Error("marker has no ttl")
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package order
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"seckill/conf"
+	"seckill/dao"
+	"seckill/infra/code"
+	"seckill/model"
+	"seckill/mq"
+	"seckill/service/goods"
+	"seckill/service/risk"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testGoodsId = 1
+
+// 内存中的 dao.IGoodsDao，只实现查询商品
+type fakeGoodsDao struct {
+	dao.IGoodsDao
+	goods model.Goods
+}
+
+func (d *fakeGoodsDao) QueryGoodsByID(id int) (model.Goods, error) {
+	if int(d.goods.ID) != id {
+		return model.Goods{}, errors.New("record not found")
+	}
+	return d.goods, nil
+}
+
+// 创建一个秒杀进行中、库存已预热的订单服务
+func newTestSeckillService(t *testing.T, g model.Goods, riskCfg conf.Risk) (*miniredis.Miniredis, *orderService) {
+	t.Helper()
+	mr, rdb := newTestRedis(t)
+	g.ID = testGoodsId
+	g.Stock = 10
+	g.StartTime = model.LocalTime(time.Now().Add(-24 * time.Hour))
+	g.EndTime = model.LocalTime(time.Now().Add(24 * time.Hour))
+	goodsService := goods.NewGoodsService(&fakeGoodsDao{goods: g}, rdb, mq.NewSoldOutNotifier(rdb), conf.WarmUp{}, 0)
+	s := NewOrderService(nil, nil, goodsService, risk.NewRiskService(rdb, riskCfg), nil,
+		mq.NewOrderTimeoutQueue(rdb, 60), rdb, conf.Order{PathExpiration: 60, ResultExpiration: 60}, conf.Payment{},
+		conf.Captcha{}, riskCfg)
+	if err := mr.Set(fmt.Sprintf(goods.GoodsStockKey, testGoodsId), "10"); err != nil {
+		t.Fatal(err)
+	}
+	return mr, s
+}
+
+func TestSecondKillPath(t *testing.T) {
+	mr, s := newTestSeckillService(t, model.Goods{}, conf.Risk{Threshold: 10})
+	path, err := s.GetSecondKillPath(1, testGoodsId, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(path) != SecondKillPathLen {
+		t.Fatalf("len(path) = %d, want %d", len(path), SecondKillPathLen)
+	}
+	tests := []struct {
+		name string
+		path string
+		want error
+	}{
+		{"地址为空", "", code.SeckillPathErr},
+		{"地址错误", "wrong", code.SeckillPathErr},
+		{"地址正确", path, nil},
+		{"地址只能使用一次", path, code.SeckillPathErr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.SecondKill(1, testGoodsId, 1, tt.path); err != tt.want {
+				t.Errorf("SecondKill() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+	if got, _ := mr.Get(fmt.Sprintf(goods.GoodsStockKey, testGoodsId)); got != "9" {
+		t.Errorf("stock = %q, want %q", got, "9")
+	}
+}
+
+func TestGetCaptcha(t *testing.T) {
+	mr, s := newTestSeckillService(t, model.Goods{NeedCaptcha: true}, conf.Risk{Threshold: 10})
+	s.captchaCfg = conf.Captcha{ValidTime: 120}
+	vo, err := s.GetCaptcha(1, testGoodsId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(vo.Image, "data:image/png;base64,") || vo.Expire != 120 {
+		t.Errorf("GetCaptcha() = (%.30q, %d), want png data url and expire 120", vo.Image, vo.Expire)
+	}
+	k := fmt.Sprintf(SecondKillCaptchaKey, 1, testGoodsId)
+	if answer, _ := mr.Get(k); answer == "" {
+		t.Errorf("captcha answer not stored")
+	}
+	if ttl := mr.TTL(k); ttl != 120*time.Second {
+		t.Errorf("captcha ttl = %v, want %v", ttl, 120*time.Second)
+	}
+}
+
+func TestGetSecondKillPathCaptcha(t *testing.T) {
+	tests := []struct {
+		name   string
+		issued string
+		answer string
+		want   error
+		risk   string
+	}{
+		{"答案正确", "42", "42", nil, ""},
+		{"答案错误", "42", "24", code.CaptchaErr, "3"},
+		{"答案为空", "42", "", code.CaptchaErr, "3"},
+		{"未获取验证码", "", "42", code.CaptchaErr, "3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, s := newTestSeckillService(t, model.Goods{NeedCaptcha: true}, conf.Risk{Threshold: 10, Window: 60, CaptchaFailScore: 3})
+			k := fmt.Sprintf(SecondKillCaptchaKey, 1, testGoodsId)
+			if tt.issued != "" {
+				_ = mr.Set(k, tt.issued)
+			}
+			path, err := s.GetSecondKillPath(1, testGoodsId, tt.answer)
+			if err != tt.want {
+				t.Fatalf("GetSecondKillPath() error = %v, want %v", err, tt.want)
+			}
+			if (path != "") != (tt.want == nil) {
+				t.Errorf("GetSecondKillPath() path = %q", path)
+			}
+			// 验证码无论对错都只能校验一次
+			if mr.Exists(k) {
+				t.Errorf("captcha not consumed")
+			}
+			if got, _ := mr.Get(fmt.Sprintf(risk.UserRiskKey, 1)); got != tt.risk {
+				t.Errorf("risk score = %q, want %q", got, tt.risk)
+			}
+		})
+	}
+}
+
+func TestGetSecondKillPathRiskReject(t *testing.T) {
+	mr, s := newTestSeckillService(t, model.Goods{NeedCaptcha: true}, conf.Risk{Threshold: 6, Window: 60, CaptchaFailScore: 3})
+	k := fmt.Sprintf(SecondKillCaptchaKey, 1, testGoodsId)
+	for i, want := range []error{code.CaptchaErr, code.CaptchaErr, code.RiskRejectErr} {
+		_ = mr.Set(k, "42")
+		if _, err := s.GetSecondKillPath(1, testGoodsId, "24"); err != want {
+			t.Errorf("attempt %d: GetSecondKillPath() error = %v, want %v", i+1, err, want)
+		}
+	}
+	// 风险分超过阈值后即使答案正确也会被拒绝
+	if _, err := s.GetSecondKillPath(1, testGoodsId, "42"); err != code.RiskRejectErr {
+		t.Errorf("GetSecondKillPath() error = %v, want %v", err, code.RiskRejectErr)
+	}
+	if _, err := s.GetCaptcha(1, testGoodsId); err != code.RiskRejectErr {
+		t.Errorf("GetCaptcha() error = %v, want %v", err, code.RiskRejectErr)
+	}
+}
+
+func TestSecondKillQuantity(t *testing.T) {
+	tests := []struct {
+		name     string
+		stock    string
+		bought   string
+		quantity int
+		want     error
+		left     string
+		queued   int
+	}{
+		{"未指定数量时购买 1 件", "10", "", 0, nil, "9", 1},
+		{"购买数量等于限购数量", "10", "", 3, nil, "7", 3},
+		{"购买数量超出限购数量", "10", "", 4, code.PurchaseLimitErr, "10", 0},
+		{"累计已购超出限购数量", "10", "2", 2, code.PurchaseLimitErr, "10", 0},
+		{"剩余库存不足购买数量", "1", "", 2, code.StockNotEnough, "1", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, s := newTestSeckillService(t, model.Goods{LimitPerUser: 3}, conf.Risk{Threshold: 10})
+			_ = mr.Set(fmt.Sprintf(goods.GoodsStockKey, testGoodsId), tt.stock)
+			if tt.bought != "" {
+				_ = mr.Set(fmt.Sprintf(BoughtKey, 1, testGoodsId), tt.bought)
+			}
+			path, err := s.GetSecondKillPath(1, testGoodsId, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = s.SecondKill(1, testGoodsId, tt.quantity, path); err != tt.want {
+				t.Fatalf("SecondKill() error = %v, want %v", err, tt.want)
+			}
+			if got, _ := mr.Get(fmt.Sprintf(goods.GoodsStockKey, testGoodsId)); got != tt.left {
+				t.Errorf("stock = %q, want %q", got, tt.left)
+			}
+			var queued int
+			if list, _ := mr.List(mq.PrecreateOrderKey); len(list) == 1 {
+				var msg mq.PrecreateOrderMsg
+				if err = json.Unmarshal([]byte(list[0]), &msg); err != nil {
+					t.Fatal(err)
+				}
+				if msg.OrderId == "" || msg.UserId != 1 || msg.GoodsId != testGoodsId {
+					t.Errorf("queued msg = %+v", msg)
+				}
+				queued = msg.Quantity
+			}
+			if queued != tt.queued {
+				t.Errorf("queued quantity = %d, want %d", queued, tt.queued)
+			}
+			if locked := mr.Exists(fmt.Sprintf(LockKey, 1, testGoodsId)); locked != (tt.want == nil) {
+				t.Errorf("locked = %v, want %v", locked, tt.want == nil)
+			}
+		})
+	}
+}
+
+func TestFailSecondKill(t *testing.T) {
+	tests := []struct {
+		name    string
+		reason  code.Code
+		status  int8
+		stock   string
+		soldOut bool
+	}{
+		{"下单失败归还库存", code.StockNotEnough, model.SecondKillFailed, "10", false},
+		{"数据库库存售罄时不归还库存", code.GoodsSaleOut, model.SecondKillSaleOut, "8", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, s := newTestSeckillService(t, model.Goods{LimitPerUser: 2}, conf.Risk{Threshold: 10})
+			path, err := s.GetSecondKillPath(1, testGoodsId, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = s.SecondKill(1, testGoodsId, 2, path); err != nil {
+				t.Fatal(err)
+			}
+			if err = s.FailSecondKill(1, testGoodsId, 2, tt.reason); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := mr.Get(fmt.Sprintf(goods.GoodsStockKey, testGoodsId)); got != tt.stock {
+				t.Errorf("stock = %q, want %q", got, tt.stock)
+			}
+			if got := s.goodsService.IsSoldOut(testGoodsId); got != tt.soldOut {
+				t.Errorf("IsSoldOut() = %v, want %v", got, tt.soldOut)
+			}
+			// 失败的秒杀不计入已购数量，并且允许用户再次参与秒杀
+			if mr.Exists(fmt.Sprintf(BoughtKey, 1, testGoodsId)) || mr.Exists(fmt.Sprintf(LockKey, 1, testGoodsId)) {
+				t.Errorf("bought or lock not released")
+			}
+			want := model.SecondKillResult{Status: tt.status, Code: tt.reason.Code(), Message: tt.reason.Error()}
+			if got, err := s.GetSecondKillResult(1, testGoodsId); err != nil || got != want {
+				t.Errorf("GetSecondKillResult() = %+v, %v, want %+v", got, err, want)
+			}
+		})
+	}
+}
+
+func TestGetSecondKillResult(t *testing.T) {
+	failed := model.SecondKillResult{Status: model.SecondKillFailed, Code: code.StockNotEnough.Code(),
+		Message: code.StockNotEnough.Error()}
+	data, _ := json.Marshal(failed)
+	tests := []struct {
+		name    string
+		result  string
+		orderId string
+		want    model.SecondKillResult
+	}{
+		{"排队中", "", "", model.SecondKillResult{Status: model.SecondKilling}},
+		{"订单已创建", "", "O1", model.SecondKillResult{Status: model.SecondKillOk, OrderId: "O1"}},
+		{"优先返回异步下单记录的结果", string(data), "O1", failed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, s := newTestSeckillService(t, model.Goods{}, conf.Risk{Threshold: 10})
+			if tt.result != "" {
+				_ = mr.Set(fmt.Sprintf(SecondKillResultKey, 1, testGoodsId), tt.result)
+			}
+			if tt.orderId != "" {
+				_ = mr.Set(fmt.Sprintf(OrderIdKey, 1, testGoodsId), tt.orderId)
+			}
+			if got, err := s.GetSecondKillResult(1, testGoodsId); err != nil || got != tt.want {
+				t.Errorf("GetSecondKillResult() = %+v, %v, want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package risk
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"log"
+	"seckill/conf"
+	"seckill/infra/code"
+	"time"
+)
+
+const (
+	// UserRiskKey 用户风险分 key
+	UserRiskKey = "user_risk:%d"
+)
+
+var (
+	ctx = context.Background()
+)
+
+// service.IRiskService 接口实现
+type riskService struct {
+	redis *redis.Client
+	cfg   conf.Risk
+}
+
+// NewRiskService 创建一个 service.IRiskService 接口实例
+func NewRiskService(redis *redis.Client, cfg conf.Risk) *riskService {
+	return &riskService{
+		redis: redis,
+		cfg:   cfg,
+	}
+}
+
+// Incr 风险分在最后一次增加后的 Window 秒内没有新的风险行为时清零
+func (s *riskService) Incr(userId int, score int64) (e error) {
+	k := fmt.Sprintf(UserRiskKey, userId)
+	window := time.Duration(s.cfg.Window) * time.Second
+	if _, e = s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.IncrBy(ctx, k, score)
+		pipe.Expire(ctx, k, window)
+		return nil
+	}); e != nil {
+		log.Printf("redis.TxPipelined() failed, err: %v", e)
+		e = code.RedisErr
+	}
+	return
+}
+
+func (s *riskService) Check(userId int) (e error) {
+	var score int64
+	k := fmt.Sprintf(UserRiskKey, userId)
+	if score, e = s.redis.Get(ctx, k).Int64(); e != nil {
+		if e == redis.Nil {
+			return nil
+		}
+		log.Printf("redis.Get() failed, err: %v", e)
+		return code.RedisErr
+	}
+	if score >= s.cfg.Threshold {
+		log.Printf("用户【%d】风险分【%d】超过阈值，拒绝参与秒杀", userId, score)
+		return code.RiskRejectErr
+	}
+	return nil
+}
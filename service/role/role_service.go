@@ -0,0 +1,129 @@
+package role
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"log"
+	"seckill/dao"
+	"seckill/infra/code"
+	"seckill/model"
+	"time"
+)
+
+const (
+	// UserRolesKey 用户角色缓存
+	UserRolesKey = "user_roles:%d"
+	// UserRolesExpire 用户角色缓存的过期时间，过期后从数据库重新加载
+	UserRolesExpire = 24 * time.Hour
+)
+
+var (
+	ctx = context.Background()
+)
+
+// service.IRoleService 接口实现
+type roleService struct {
+	dao     dao.IRoleDao
+	userDao dao.IUserDao
+	redis   *redis.Client
+}
+
+// NewRoleService 创建一个 service.IRoleService 接口实例
+func NewRoleService(roleDao dao.IRoleDao, userDao dao.IUserDao, redis *redis.Client) *roleService {
+	return &roleService{
+		dao:     roleDao,
+		userDao: userDao,
+		redis:   redis,
+	}
+}
+
+func (s *roleService) FindRoles(userId uint) (roles []string, e error) {
+	k := fmt.Sprintf(UserRolesKey, userId)
+	res, e := s.redis.Get(ctx, k).Result()
+	if e == nil {
+		if e = json.Unmarshal([]byte(res), &roles); e == nil {
+			return
+		}
+		log.Printf("json.Unmarshal() failed, err: %v", e)
+	} else if e != redis.Nil {
+		log.Printf("redis.Get() failed, err: %v", e)
+		return nil, code.RedisErr
+	}
+	// 缓存不存在或已损坏，从数据库加载
+	if roles, e = s.dao.QueryRoles(userId); e != nil {
+		return
+	}
+	if roles == nil {
+		// 没有角色的用户同样缓存，避免每次请求都查询数据库
+		roles = []string{}
+	}
+	data, _ := json.Marshal(roles)
+	if e = s.redis.Set(ctx, k, data, UserRolesExpire).Err(); e != nil {
+		log.Printf("redis.Set() failed, err: %v", e)
+	}
+	return roles, nil
+}
+
+func (s *roleService) FindPrincipal(userId uint) (p model.Principal, e error) {
+	var roles []string
+	if roles, e = s.FindRoles(userId); e != nil {
+		return
+	}
+	return model.NewPrincipal(userId, roles), nil
+}
+
+func (s *roleService) FindUserRoleVO(userId uint) (vo model.UserRoleVO, e error) {
+	if _, e = s.userDao.QueryByID(userId); e != nil {
+		return
+	}
+	var p model.Principal
+	if p, e = s.FindPrincipal(userId); e != nil {
+		return
+	}
+	vo = model.UserRoleVO{
+		UserId:      userId,
+		Roles:       p.Roles,
+		Permissions: p.Permissions(),
+	}
+	return
+}
+
+func (s *roleService) Grant(userId uint, role string) (e error) {
+	if !model.IsValidRole(role) {
+		return code.RoleNotFoundErr
+	}
+	if _, e = s.userDao.QueryByID(userId); e != nil {
+		return
+	}
+	if e = s.dao.Grant(userId, role); e != nil {
+		return
+	}
+	return s.deleteRolesCache(userId)
+}
+
+func (s *roleService) Revoke(userId uint, role string) (e error) {
+	if !model.IsValidRole(role) {
+		return code.RoleNotFoundErr
+	}
+	if role == model.RoleAdmin {
+		// 至少保留一个管理员，避免再也没有人可以管理角色，统计与撤销在同一个事务中完成
+		e = s.dao.RevokeKeepingLast(userId, role)
+	} else {
+		e = s.dao.Revoke(userId, role)
+	}
+	if e != nil {
+		return
+	}
+	return s.deleteRolesCache(userId)
+}
+
+// 删除用户角色缓存，下次请求时从数据库加载新的角色
+func (s *roleService) deleteRolesCache(userId uint) error {
+	if e := s.redis.Del(ctx, fmt.Sprintf(UserRolesKey, userId)).Err(); e != nil {
+		log.Printf("redis.Del() failed, err: %v", e)
+		return code.RedisErr
+	}
+	return nil
+}
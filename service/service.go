@@ -1,8 +0,0 @@
-package service
-
-// service 层所有接口的实例化变量
-var (
-	GoodsService IGoodsService
-	UserService IUserService
-	OrderService IOrderService
-)
@@ -0,0 +1,199 @@
+package stock
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"log"
+	"seckill/dao"
+	"seckill/infra/code"
+	"seckill/model"
+	"seckill/mq"
+	"seckill/service/goods"
+)
+
+var (
+	ctx = context.Background()
+)
+
+// 只有缓存库存仍为对账时读到的值时才修复，避免覆盖对账期间的正常扣减
+// 修复只会减少缓存库存，不会增加，避免对账期间的并发导致库存被高估而超卖
+// KEYS[1]：商品库存缓存 key，ARGV[1]：对账时读到的库存，ARGV[2]：修复后的库存
+var repairStockScript = redis.NewScript(`
+local stock = redis.call('GET', KEYS[1])
+if stock == ARGV[1] and tonumber(ARGV[2]) < tonumber(stock) then
+	redis.call('SET', KEYS[1], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// service.IStockService 接口实现
+type stockService struct {
+	goodsDao dao.IGoodsDao
+	orderDao dao.IOrderDao
+	queue    *mq.PrecreateOrderQueue
+	redis    *redis.Client
+	// 退款后是否把商品返还到秒杀库存中
+	refundRestock bool
+}
+
+// NewStockService 创建一个 service.IStockService 接口实例
+func NewStockService(goodsDao dao.IGoodsDao, orderDao dao.IOrderDao, queue *mq.PrecreateOrderQueue,
+	redis *redis.Client, refundRestock bool) *stockService {
+	return &stockService{
+		goodsDao:      goodsDao,
+		orderDao:      orderDao,
+		queue:         queue,
+		redis:         redis,
+		refundRestock: refundRestock,
+	}
+}
+
+// Reconcile 库存对账
+// 数据库期望库存 = 商品总量 - 未关闭的订单数量
+// 缓存期望库存 = 数据库期望库存 - 队列中还未创建订单的消息数量
+// 订单数量、队列中的消息与缓存库存不是同一时刻读取的，消费者在两次读取之间创建的订单可能被漏统计，
+// 因此缓存库存只在读取前后订单数量没有变化时修复，并且只会减少不会增加。
+// 归还库存失败等原因导致的缓存库存偏低无法与对账期间的并发区分，只在报告中标记，需要人工确认
+func (s *stockService) Reconcile(dryRun bool) (list []model.StockDrift, e error) {
+	var (
+		goodsList  []model.Goods
+		liveOrders map[uint]int
+		recheck    map[uint]int
+		inFlight   map[int]int
+	)
+	if goodsList, e = s.goodsDao.QueryAll(); e != nil {
+		return
+	}
+	if liveOrders, e = s.orderDao.CountLiveOrders(s.refundRestock); e != nil {
+		return
+	}
+	if inFlight, e = s.countInFlight(); e != nil {
+		return
+	}
+	list = make([]model.StockDrift, 0)
+	for _, g := range goodsList {
+		d := model.StockDrift{
+			GoodsId:    g.ID,
+			Amount:     g.Amount,
+			LiveOrders: liveOrders[g.ID],
+			InFlight:   inFlight[int(g.ID)],
+			DBStock:    g.Stock,
+		}
+		d.ExpectedDBStock = d.Amount - d.LiveOrders
+		d.ExpectedRedisStock = d.ExpectedDBStock - d.InFlight
+		if d.RedisStock, d.RedisInitialized, e = s.getRedisStock(int(g.ID)); e != nil {
+			return
+		}
+		if !d.HasDrift() {
+			continue
+		}
+		if d.RedisInitialized && d.RedisStock < d.ExpectedRedisStock {
+			d.Note = model.StockShortageNote
+		}
+		log.Printf("商品【%d】库存存在偏差: %+v", g.ID, d)
+		list = append(list, d)
+	}
+	if dryRun || len(list) == 0 {
+		return
+	}
+	// 再次统计订单数量，订单数量发生变化的商品本次不修复缓存库存
+	if recheck, e = s.orderDao.CountLiveOrders(s.refundRestock); e != nil {
+		return
+	}
+	for i, d := range list {
+		stable := recheck[d.GoodsId] == d.LiveOrders
+		if list[i].Repaired, e = s.repair(d, stable); e != nil {
+			return
+		}
+	}
+	return
+}
+
+// 按商品统计队列中还未创建订单的商品数量
+// 订单已经入库但消息还未确认时，订单已经计入未关闭的订单数量，不能重复计入；同一个订单的重复消息只计一次
+func (s *stockService) countInFlight() (counts map[int]int, e error) {
+	var (
+		msgs    []mq.PrecreateOrderMsg
+		ids     []string
+		existed map[string]bool
+	)
+	if msgs, e = s.queue.InFlight(); e != nil {
+		return
+	}
+	for _, msg := range msgs {
+		if msg.OrderId != "" {
+			ids = append(ids, msg.OrderId)
+		}
+	}
+	if len(ids) > 0 {
+		if existed, e = s.orderDao.QueryExistedOrderIds(ids); e != nil {
+			return
+		}
+	}
+	counts = make(map[int]int)
+	seen := make(map[string]bool, len(ids))
+	for _, msg := range msgs {
+		if msg.OrderId != "" {
+			if existed[msg.OrderId] || seen[msg.OrderId] {
+				continue
+			}
+			seen[msg.OrderId] = true
+		}
+		counts[msg.GoodsId] += msg.GetQuantity()
+	}
+	return
+}
+
+// 获取缓存中的库存，ok 表示缓存库存是否已初始化
+func (s *stockService) getRedisStock(goodsId int) (stock int, ok bool, e error) {
+	k := fmt.Sprintf(goods.GoodsStockKey, goodsId)
+	if stock, e = s.redis.Get(ctx, k).Int(); e != nil {
+		if e == redis.Nil {
+			e = nil
+			return
+		}
+		log.Printf("redis.Get() failed, err: %v", e)
+		e = code.RedisErr
+		return
+	}
+	ok = true
+	return
+}
+
+// 修复库存偏差，只有库存在对账期间没有发生变化时才会修复成功
+// 缓存库存只在 stable 为 true 并且高于期望库存时修复，低于期望库存的偏差只报告不修复
+func (s *stockService) repair(d model.StockDrift, stable bool) (repaired bool, e error) {
+	id := int(d.GoodsId)
+	repaired = true
+	if d.DBStock != d.ExpectedDBStock {
+		var ok bool
+		if ok, e = s.goodsDao.UpdateStock(id, d.DBStock, d.ExpectedDBStock); e != nil {
+			return
+		}
+		repaired = repaired && ok
+		// 删除商品信息缓存，使其重新从数据库加载
+		if e = s.redis.Del(ctx, fmt.Sprintf(goods.CacheKey, id)).Err(); e != nil {
+			log.Printf("redis.Del() failed, err: %v", e)
+			e = code.RedisErr
+			return
+		}
+	}
+	if d.RedisInitialized && d.RedisStock != d.ExpectedRedisStock {
+		if !stable || d.RedisStock < d.ExpectedRedisStock {
+			log.Printf("商品【%d】缓存库存偏差需要人工确认, redisStock: %d, expected: %d",
+				d.GoodsId, d.RedisStock, d.ExpectedRedisStock)
+			return false, nil
+		}
+		var res int
+		keys := []string{fmt.Sprintf(goods.GoodsStockKey, id)}
+		if res, e = repairStockScript.Run(ctx, s.redis, keys, d.RedisStock, d.ExpectedRedisStock).Int(); e != nil {
+			log.Printf("repairStockScript.Run() failed, err: %v", e)
+			e = code.RedisErr
+			return
+		}
+		repaired = repaired && res == 1
+	}
+	return
+}
@@ -0,0 +1,193 @@
+package stock
+
+import (
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"seckill/conf"
+	"seckill/dao"
+	"seckill/model"
+	"seckill/mq"
+	"seckill/service/goods"
+	"strconv"
+	"testing"
+)
+
+// 内存中的 dao.IGoodsDao，只有一个商品
+type fakeGoodsDao struct {
+	dao.IGoodsDao
+	goods model.Goods
+}
+
+func (d *fakeGoodsDao) QueryAll() ([]model.Goods, error) {
+	return []model.Goods{d.goods}, nil
+}
+
+func (d *fakeGoodsDao) UpdateStock(id int, expect, stock int) (bool, error) {
+	if d.goods.Stock != expect {
+		return false, nil
+	}
+	d.goods.Stock = stock
+	return true, nil
+}
+
+// 内存中的 dao.IOrderDao，liveOrders 依次作为每次统计的结果
+type fakeOrderDao struct {
+	dao.IOrderDao
+	liveOrders []int
+	existed    map[string]bool
+}
+
+func (d *fakeOrderDao) CountLiveOrders(refundRestock bool) (map[uint]int, error) {
+	n := d.liveOrders[0]
+	if len(d.liveOrders) > 1 {
+		d.liveOrders = d.liveOrders[1:]
+	}
+	return map[uint]int{1: n}, nil
+}
+
+func (d *fakeOrderDao) QueryExistedOrderIds(ids []string) (map[string]bool, error) {
+	return d.existed, nil
+}
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		name       string
+		dbStock    int
+		redisStock string
+		liveOrders []int
+		inFlight   []mq.PrecreateOrderMsg
+		dryRun     bool
+		// 期望的对账结果，nil 表示没有偏差
+		want *model.StockDrift
+		// 对账后的库存
+		wantDBStock    int
+		wantRedisStock string
+	}{
+		{
+			name: "没有偏差", dbStock: 7, redisStock: "6", liveOrders: []int{3},
+			inFlight:    []mq.PrecreateOrderMsg{{OrderId: "O4", GoodsId: 1}},
+			wantDBStock: 7, wantRedisStock: "6",
+		},
+		{
+			name: "缓存库存未初始化", dbStock: 7, liveOrders: []int{3},
+			wantDBStock: 7,
+		},
+		{
+			name: "修复偏高的缓存库存", dbStock: 7, redisStock: "9", liveOrders: []int{3, 3},
+			want:        &model.StockDrift{DBStock: 7, ExpectedDBStock: 7, RedisStock: 9, ExpectedRedisStock: 7, Repaired: true},
+			wantDBStock: 7, wantRedisStock: "7",
+		},
+		{
+			name: "试运行只报告不修复", dbStock: 8, redisStock: "9", liveOrders: []int{3}, dryRun: true,
+			want:        &model.StockDrift{DBStock: 8, ExpectedDBStock: 7, RedisStock: 9, ExpectedRedisStock: 7},
+			wantDBStock: 8, wantRedisStock: "9",
+		},
+		{
+			name: "修复数据库库存", dbStock: 8, redisStock: "7", liveOrders: []int{3, 3},
+			want:        &model.StockDrift{DBStock: 8, ExpectedDBStock: 7, RedisStock: 7, ExpectedRedisStock: 7, Repaired: true},
+			wantDBStock: 7, wantRedisStock: "7",
+		},
+		{
+			name: "缓存库存偏低只报告", dbStock: 7, redisStock: "5", liveOrders: []int{3, 3},
+			want: &model.StockDrift{DBStock: 7, ExpectedDBStock: 7, RedisStock: 5, ExpectedRedisStock: 7,
+				Note: model.StockShortageNote},
+			wantDBStock: 7, wantRedisStock: "5",
+		},
+		{
+			name: "对账期间订单数量变化时不修复缓存库存", dbStock: 7, redisStock: "9", liveOrders: []int{3, 4},
+			want:        &model.StockDrift{DBStock: 7, ExpectedDBStock: 7, RedisStock: 9, ExpectedRedisStock: 7},
+			wantDBStock: 7, wantRedisStock: "9",
+		},
+		{
+			name: "已入库与重复的队列消息不重复统计", dbStock: 7, redisStock: "5", liveOrders: []int{3, 3},
+			inFlight: []mq.PrecreateOrderMsg{
+				{OrderId: "O3", GoodsId: 1},
+				{OrderId: "O4", GoodsId: 1, Quantity: 2},
+				{OrderId: "O4", GoodsId: 1, Quantity: 2, Retry: 1},
+			},
+			wantDBStock: 7, wantRedisStock: "5",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, err := miniredis.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mr.Close()
+			rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			stockKey := fmt.Sprintf(goods.GoodsStockKey, 1)
+			if tt.redisStock != "" {
+				mr.Set(stockKey, tt.redisStock)
+			}
+			queue := mq.NewPrecreateOrderQueue(rdb, conf.Queue{})
+			for _, msg := range tt.inFlight {
+				if err := queue.Send(msg); err != nil {
+					t.Fatal(err)
+				}
+			}
+			goodsDao := &fakeGoodsDao{goods: model.Goods{Amount: 10, Stock: tt.dbStock}}
+			goodsDao.goods.ID = 1
+			orderDao := &fakeOrderDao{liveOrders: tt.liveOrders, existed: map[string]bool{"O3": true}}
+			s := NewStockService(goodsDao, orderDao, queue, rdb, false)
+			list, err := s.Reconcile(tt.dryRun)
+			if err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if tt.want == nil {
+				if len(list) != 0 {
+					t.Errorf("Reconcile() = %+v, want no drift", list)
+				}
+			} else if len(list) != 1 {
+				t.Fatalf("Reconcile() = %+v, want one drift", list)
+			} else {
+				got := list[0]
+				if got.DBStock != tt.want.DBStock || got.ExpectedDBStock != tt.want.ExpectedDBStock ||
+					got.RedisStock != tt.want.RedisStock || got.ExpectedRedisStock != tt.want.ExpectedRedisStock ||
+					got.Repaired != tt.want.Repaired || got.Note != tt.want.Note {
+					t.Errorf("Reconcile() = %+v, want %+v", got, *tt.want)
+				}
+			}
+			redisStock, _ := mr.Get(stockKey)
+			if goodsDao.goods.Stock != tt.wantDBStock || redisStock != tt.wantRedisStock {
+				t.Errorf("stock after Reconcile() = (%d, %q), want (%d, %q)",
+					goodsDao.goods.Stock, redisStock, tt.wantDBStock, tt.wantRedisStock)
+			}
+		})
+	}
+}
+
+func TestRepairStockScript(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  int
+		read     int
+		expected int
+		want     int64
+		stock    int
+	}{
+		{"库存未变化时减少缓存库存", 9, 9, 7, 1, 7},
+		{"对账期间库存已被扣减", 8, 9, 7, 0, 8},
+		{"不会增加缓存库存", 5, 5, 7, 0, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, err := miniredis.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mr.Close()
+			rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			mr.Set("stock", strconv.Itoa(tt.current))
+			got, err := repairStockScript.Run(ctx, rdb, []string{"stock"}, tt.read, tt.expected).Int64()
+			if err != nil {
+				t.Fatal(err)
+			}
+			stock, _ := mr.Get("stock")
+			if got != tt.want || stock != strconv.Itoa(tt.stock) {
+				t.Errorf("repairStockScript = (%d, %s), want (%d, %d)", got, stock, tt.want, tt.stock)
+			}
+		})
+	}
+}
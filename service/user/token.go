@@ -0,0 +1,90 @@
+package user
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"seckill/infra/code"
+	"seckill/infra/utils/key"
+	"seckill/model"
+	"time"
+)
+
+const (
+	// DefaultDeviceId 登录时未指定设备的默认设备 id
+	DefaultDeviceId = "default"
+	// 刷新令牌的长度
+	refreshTokenLength = 48
+)
+
+func (s *userService) RefreshToken(refreshToken string) (vo model.TokenVO, e error) {
+	var old model.RefreshToken
+	if old, e = s.refreshTokenDao.QueryByHash(hashRefreshToken(refreshToken)); e != nil {
+		return
+	}
+	if old.RevokedAt != nil || time.Now().After(time.Time(old.ExpiresAt)) {
+		e = code.RefreshTokenInvalidErr
+		return
+	}
+	if old.UsedAt != nil {
+		// 已经轮换过的令牌被再次使用，说明令牌可能已经泄露，吊销整个令牌族
+		log.Printf("用户【%d】设备【%s】的刷新令牌被重复使用，吊销令牌族【%s】", old.UserId, old.DeviceId, old.FamilyId)
+		if e = s.refreshTokenDao.RevokeFamily(old.FamilyId); e != nil {
+			return
+		}
+		e = code.RefreshTokenReusedErr
+		return
+	}
+	// 查询最新的用户数据，退出所有登录后旧的令牌版本号会失效
+	var user model.User
+	if user, e = s.dao.QueryByID(old.UserId); e != nil {
+		if e == code.RecordNotFoundErr {
+			e = code.RefreshTokenInvalidErr
+		}
+		return
+	}
+	return s.issueTokens(user, old.DeviceId, &old)
+}
+
+// 签发访问令牌与刷新令牌，old 不为空时轮换 old 所在令牌族的刷新令牌，否则创建新的令牌族
+func (s *userService) issueTokens(user model.User, deviceId string, old *model.RefreshToken) (vo model.TokenVO, e error) {
+	if vo.Token, e = s.generateToken(user, deviceId); e != nil {
+		log.Printf("generateToken() failed, err: %v", e)
+		e = code.UnknownErr
+		return
+	}
+	vo.ExpiresIn = int64(s.jwt.AccessExpiration / time.Second)
+	vo.RefreshToken = key.CreateKey(key.NumberAndLetter, refreshTokenLength)
+	vo.RefreshExpiresIn = int64(s.jwt.RefreshExpiration / time.Second)
+	t := &model.RefreshToken{
+		UserId:    user.ID,
+		DeviceId:  deviceId,
+		TokenHash: hashRefreshToken(vo.RefreshToken),
+		ExpiresAt: model.LocalTime(time.Now().Add(s.jwt.RefreshExpiration)),
+	}
+	if old == nil {
+		t.FamilyId = key.CreateKey(key.NumberAndLetter, 32)
+		e = s.refreshTokenDao.Insert(t)
+		return
+	}
+	t.FamilyId = old.FamilyId
+	var ok bool
+	if ok, e = s.refreshTokenDao.Rotate(*old, t); e != nil {
+		return
+	}
+	if !ok {
+		// 并发请求使用了同一个刷新令牌，按重用处理
+		log.Printf("用户【%d】设备【%s】的刷新令牌被并发使用，吊销令牌族【%s】", old.UserId, old.DeviceId, old.FamilyId)
+		if e = s.refreshTokenDao.RevokeFamily(old.FamilyId); e != nil {
+			return
+		}
+		e = code.RefreshTokenReusedErr
+	}
+	return
+}
+
+// 刷新令牌的 sha256 哈希值，数据库中不保存令牌原文
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
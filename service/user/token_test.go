@@ -0,0 +1,212 @@
+package user
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"io/ioutil"
+	"path/filepath"
+	"seckill/conf"
+	"seckill/dao"
+	"seckill/infra/code"
+	"seckill/infra/secret"
+	"seckill/model"
+	"testing"
+	"time"
+)
+
+// 内存中的 dao.IUserDao，只保存一个用户
+type fakeUserDao struct {
+	dao.IUserDao
+	user model.User
+}
+
+func (d *fakeUserDao) QueryByID(id uint) (model.User, error) {
+	if id != d.user.ID {
+		return model.User{}, code.RecordNotFoundErr
+	}
+	return d.user, nil
+}
+
+func (d *fakeUserDao) QueryTokenVersion(id uint) (int64, error) {
+	if id != d.user.ID {
+		return 0, code.RecordNotFoundErr
+	}
+	return d.user.TokenVersion, nil
+}
+
+func (d *fakeUserDao) IncrTokenVersion(id uint) (int64, error) {
+	d.user.TokenVersion++
+	return d.user.TokenVersion, nil
+}
+
+// 内存中的 dao.IRefreshTokenDao
+type fakeRefreshTokenDao struct {
+	tokens []*model.RefreshToken
+}
+
+func (d *fakeRefreshTokenDao) Insert(t *model.RefreshToken) error {
+	t.ID = uint(len(d.tokens) + 1)
+	d.tokens = append(d.tokens, t)
+	return nil
+}
+
+func (d *fakeRefreshTokenDao) QueryByHash(hash string) (model.RefreshToken, error) {
+	for _, t := range d.tokens {
+		if t.TokenHash == hash {
+			return *t, nil
+		}
+	}
+	return model.RefreshToken{}, code.RefreshTokenInvalidErr
+}
+
+func (d *fakeRefreshTokenDao) Rotate(old model.RefreshToken, new *model.RefreshToken) (bool, error) {
+	t := d.tokens[old.ID-1]
+	if t.UsedAt != nil || t.RevokedAt != nil {
+		return false, nil
+	}
+	now := model.LocalTime(time.Now())
+	t.UsedAt = &now
+	return true, d.Insert(new)
+}
+
+func (d *fakeRefreshTokenDao) RevokeFamily(familyId string) error {
+	return d.revoke(func(t *model.RefreshToken) bool { return t.FamilyId == familyId })
+}
+
+func (d *fakeRefreshTokenDao) RevokeByDevice(userId uint, deviceId string) error {
+	return d.revoke(func(t *model.RefreshToken) bool { return t.UserId == userId && t.DeviceId == deviceId })
+}
+
+func (d *fakeRefreshTokenDao) RevokeByUser(userId uint) error {
+	return d.revoke(func(t *model.RefreshToken) bool { return t.UserId == userId })
+}
+
+func (d *fakeRefreshTokenDao) revoke(match func(t *model.RefreshToken) bool) error {
+	now := model.LocalTime(time.Now())
+	for _, t := range d.tokens {
+		if match(t) && t.RevokedAt == nil {
+			t.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+// 创建使用内存 dao 与 miniredis 的 userService
+func newTestUserService(t *testing.T) (*userService, *fakeRefreshTokenDao) {
+	t.Helper()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+	secretFile := filepath.Join(t.TempDir(), "jwt.secret")
+	if err := ioutil.WriteFile(secretFile, []byte("test secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c := conf.Jwt{Keys: []conf.JwtKey{{Kid: "test", SecretFile: secretFile}}}
+	keys, err := secret.LoadKeySet(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenDao := &fakeRefreshTokenDao{}
+	s := NewUserService(&fakeUserDao{user: model.User{Model: model.Model{ID: 1}, Username: "alice"}}, tokenDao,
+		redis.NewClient(&redis.Options{Addr: mr.Addr()}), secret.NewJWT(keys, c), conf.PasswordPolicy{})
+	return s, tokenDao
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	s, tokenDao := newTestUserService(t)
+	login, err := s.issueTokens(s.dao.(*fakeUserDao).user, DefaultDeviceId, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := s.RefreshToken(login.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+	if rotated.RefreshToken == login.RefreshToken || rotated.Token == "" {
+		t.Fatalf("RefreshToken() did not rotate the refresh token")
+	}
+	if tokenDao.tokens[0].FamilyId != tokenDao.tokens[1].FamilyId {
+		t.Errorf("rotated token family = %q, want %q", tokenDao.tokens[1].FamilyId, tokenDao.tokens[0].FamilyId)
+	}
+	// 重用已轮换的令牌吊销整个令牌族，轮换得到的新令牌一起失效
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"重用已轮换的令牌", login.RefreshToken, code.RefreshTokenReusedErr},
+		{"令牌族已被吊销", rotated.RefreshToken, code.RefreshTokenInvalidErr},
+		{"未知的令牌", "unknown", code.RefreshTokenInvalidErr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.RefreshToken(tt.token); err != tt.want {
+				t.Errorf("RefreshToken() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenExpired(t *testing.T) {
+	s, tokenDao := newTestUserService(t)
+	login, err := s.issueTokens(s.dao.(*fakeUserDao).user, DefaultDeviceId, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenDao.tokens[0].ExpiresAt = model.LocalTime(time.Now().Add(-time.Second))
+	if _, err := s.RefreshToken(login.RefreshToken); err != code.RefreshTokenInvalidErr {
+		t.Errorf("RefreshToken() error = %v, want %v", err, code.RefreshTokenInvalidErr)
+	}
+}
+
+// 退出登录吊销该设备的会话，包括滑动续期得到的令牌，其他设备与之后的新会话不受影响
+func TestLogoutRevokesSession(t *testing.T) {
+	s, tokenDao := newTestUserService(t)
+	parse := func(token string) *secret.CustomClaims {
+		claims, err := s.jwt.ParseToken(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return claims
+	}
+	user := s.dao.(*fakeUserDao).user
+	phone, _ := s.generateToken(user, "phone")
+	laptop, _ := s.generateToken(user, "laptop")
+	claims := parse(phone)
+	renewed, err := s.jwt.RenewToken(*claims, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.issueTokens(user, "phone", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Logout(claims); err != nil {
+		t.Fatalf("Logout() error = %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	relogin, _ := s.generateToken(user, "phone")
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"退出登录的令牌", phone, code.TokenRevokedErr},
+		{"同一会话续期得到的令牌", renewed, code.TokenRevokedErr},
+		{"其他设备的令牌", laptop, nil},
+		{"退出登录后重新登录", relogin, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.CheckToken(parse(tt.token)); err != tt.want {
+				t.Errorf("CheckToken() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+	for _, rt := range tokenDao.tokens {
+		if rt.DeviceId == "phone" && rt.RevokedAt == nil {
+			t.Errorf("refresh token of the logged out device is not revoked")
+		}
+	}
+}
@@ -1,41 +1,70 @@
 package user
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"github.com/dgrijalva/jwt-go"
+	"github.com/go-redis/redis/v8"
 	"github.com/jinzhu/gorm"
 	"log"
+	"seckill/conf"
 	"seckill/dao"
 	"seckill/infra/code"
 	"seckill/infra/secret"
 	"seckill/infra/utils/bean"
+	"seckill/infra/utils/key"
 	"seckill/model"
-	"seckill/service"
-	"strconv"
-	"sync"
 	"time"
 )
 
+const (
+	// TokenLogoutKey 设备最后一次退出登录的时间，单位：毫秒，会话开始时间不晚于该时间的令牌全部失效
+	// 过期时间为访问令牌的有效时间，过期时退出登录前签发、续期的访问令牌都已过期
+	TokenLogoutKey = "token_logout:%d:%s"
+	// TokenVersionKey 用户令牌版本号缓存
+	TokenVersionKey = "user_token_version:%d"
+	// TokenVersionExpire 用户令牌版本号缓存的过期时间，过期后从数据库重新加载
+	TokenVersionExpire = 24 * time.Hour
+)
+
 var (
-	once sync.Once
+	ctx = context.Background()
 )
 
-// InitService 单例模式初始化 IUserService 接口实例
-func InitService() {
-	once.Do(func() {
-		service.UserService = newUserService()
-	})
-}
+// setTokenVersionScript 只在新的版本号更大时才更新缓存，返回更新后缓存中的版本号
+// 避免从数据库加载的旧版本号覆盖退出全部设备时写入的新版本号
+// KEYS[1]：用户令牌版本号 key，即 TokenVersionKey
+// ARGV[1]：新的版本号
+// ARGV[2]：缓存的过期时间，单位秒
+var setTokenVersionScript = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[1]))
+local version = tonumber(ARGV[1])
+if current ~= nil and current >= version then
+	return current
+end
+redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[2])
+return version
+`)
 
 // service.IUserService 接口实现
 type userService struct {
-	dao dao.IUserDao
+	dao             dao.IUserDao
+	refreshTokenDao dao.IRefreshTokenDao
+	redis           *redis.Client
+	jwt             *secret.JWT
+	passwordPolicy  conf.PasswordPolicy
 }
 
-// newUserService 创建一个 service.IUserService 接口实例
-func newUserService() *userService {
+// NewUserService 创建一个 service.IUserService 接口实例
+func NewUserService(userDao dao.IUserDao, refreshTokenDao dao.IRefreshTokenDao, redis *redis.Client,
+	jwt *secret.JWT, passwordPolicy conf.PasswordPolicy) *userService {
 	return &userService{
-		dao: dao.UserDao,
+		dao:             userDao,
+		refreshTokenDao: refreshTokenDao,
+		redis:           redis,
+		jwt:             jwt,
+		passwordPolicy:  passwordPolicy,
 	}
 }
 
@@ -48,16 +77,26 @@ func (s *userService) Register(registerUser model.RegisterUser) error {
 	}
 	// 查重
 	u, e := s.FindByUsername(user.Username)
-	if e != nil && !errors.Is(e, gorm.ErrRecordNotFound) && !errors.Is(e, code.RecordNotFoundErr){
+	if e != nil && !errors.Is(e, gorm.ErrRecordNotFound) && !errors.Is(e, code.RecordNotFoundErr) {
 		return code.DBErr
 	}
 	if u.ID != 0 {
 		return code.UsernameExistedErr
 	}
-	return s.dao.Insert(user)
+	// 校验密码策略并保存密码的哈希值
+	policy := s.passwordPolicy
+	if e = secret.ValidatePassword(user.Username, user.Password, policy.MinLength); e != nil {
+		return e
+	}
+	if user.Password, e = secret.HashPassword(user.Password, policy.HashCost); e != nil {
+		log.Printf("secret.HashPassword() failed, err: %v", e)
+		return code.UnknownErr
+	}
+	// 根据用户类别授予默认角色
+	return s.dao.Insert(user, model.DefaultRoles(user.Kind))
 }
 
-func (s *userService) Login(loginUser model.LoginUser) (token string, e error) {
+func (s *userService) Login(loginUser model.LoginUser) (vo model.TokenVO, e error) {
 	// 数据转换
 	var user model.User
 	if e = bean.SimpleCopyProperties(&user, loginUser); e != nil {
@@ -65,47 +104,70 @@ func (s *userService) Login(loginUser model.LoginUser) (token string, e error) {
 		return
 	}
 	// 通过 username 到数据库查询数据来对比
+	cost := s.passwordPolicy.HashCost
 	oldUser, err := s.FindByUsername(user.Username)
-	if err != nil || oldUser.Password != user.Password {
-		if err != nil {
-			log.Println(e)
-		}
+	if err != nil {
+		log.Println(err)
+		// 用户不存在时同样进行一次哈希比较，保证响应时间一致
+		secret.VerifyDummyPassword(user.Password, cost)
+		e = code.AuthErr
+		return
+	}
+	ok, rehash := secret.VerifyPassword(oldUser.Password, user.Password, cost)
+	if !ok {
 		e = code.AuthErr
 		return
 	}
-	token, e = s.generateToken(oldUser)
-	return
+	if rehash {
+		// 明文密码或过时的哈希值，登录成功后重新计算哈希值，失败不影响本次登录
+		s.rehashPassword(oldUser, user.Password, cost)
+	}
+	// 同一设备重新登录时吊销该设备之前的刷新令牌
+	deviceId := loginUser.DeviceId
+	if deviceId == "" {
+		deviceId = DefaultDeviceId
+	}
+	if e = s.refreshTokenDao.RevokeByDevice(oldUser.ID, deviceId); e != nil {
+		return
+	}
+	return s.issueTokens(oldUser, deviceId, nil)
 }
 
-// 生成 Token
-func (s *userService) generateToken(user model.User) (string, error) {
-	if user.Username == "" {
-		return "", errors.New("请先注册")
-	}
-	// 查出最新的用户数据
-	user, err := s.FindByUsername(user.Username)
+// 重新计算并保存用户的密码哈希值
+func (s *userService) rehashPassword(user model.User, password string, cost int) {
+	hash, err := secret.HashPassword(password, cost)
 	if err != nil {
-		return "", err
+		log.Printf("secret.HashPassword() failed, err: %v", err)
+		return
+	}
+	if err = s.dao.UpdatePassword(user.ID, hash); err != nil {
+		log.Printf("用户【%d】密码哈希值更新失败, err: %v", user.ID, err)
 	}
+}
+
+// 生成访问令牌
+func (s *userService) generateToken(user model.User, deviceId string) (string, error) {
 	// 签发 JWT
-	j := secret.NewJWT()
-	expiresTime := time.Now().Add(secret.ExpiresTime * time.Second).Unix()
+	expiresTime := time.Now().Add(s.jwt.AccessExpiration).Unix()
 	claims := secret.CustomClaims{
-		UserId: user.ID,
-		Username: user.Username,
-		Kind:     user.Kind,
+		UserId:       user.ID,
+		Username:     user.Username,
+		Kind:         user.Kind,
+		TokenVersion: user.TokenVersion,
+		DeviceId:     deviceId,
+		SessionAt:    time.Now().UnixNano() / int64(time.Millisecond),
 		StandardClaims: jwt.StandardClaims{
-			Audience:  user.Username,              // 受众
-			ExpiresAt: expiresTime,                // 失效时间
-			Id:        strconv.Itoa(int(user.ID)), // 编号
-			IssuedAt:  time.Now().Unix(),          // 签发时间
-			Issuer:    secret.Issuer,              // 签发人
-			NotBefore: time.Now().Unix(),          // 生效时间
-			Subject:   "auth",                     // 主题
+			Audience:  user.Username,                          // 受众
+			ExpiresAt: expiresTime,                            // 失效时间
+			Id:        key.CreateKey(key.NumberAndLetter, 32), // 编号
+			IssuedAt:  time.Now().Unix(),                      // 签发时间
+			Issuer:    secret.Issuer,                          // 签发人
+			NotBefore: time.Now().Unix(),                      // 生效时间
+			Subject:   "auth",                                 // 主题
 		},
 	}
 	// 获取 token
-	token, err := j.CreateToken(claims)
+	token, err := s.jwt.CreateToken(claims)
 	if err != nil {
 		return "", err
 	}
@@ -116,10 +178,95 @@ func (s *userService) FindByUsername(username string) (model.User, error) {
 	return s.dao.QueryByUsername(username)
 }
 
-func (s *userService) Logout(token string) {
-	if len(token) > 0 {
-		// 退出时使 token 失效
-		j := secret.NewJWT()
-		_ = j.InvalidToken(token)
+func (s *userService) Logout(claims *secret.CustomClaims) error {
+	// 记录设备退出登录的时间，该设备在此之前签发以及滑动续期得到的访问令牌全部失效
+	k := fmt.Sprintf(TokenLogoutKey, claims.UserId, claims.DeviceId)
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	if e := s.redis.Set(ctx, k, now, s.jwt.AccessExpiration).Err(); e != nil {
+		log.Printf("redis.Set() failed, err: %v", e)
+		return code.RedisErr
 	}
-}
\ No newline at end of file
+	// 同时吊销该设备的刷新令牌
+	return s.refreshTokenDao.RevokeByDevice(claims.UserId, claims.DeviceId)
+}
+
+func (s *userService) LogoutAll(userId uint) error {
+	if e := s.refreshTokenDao.RevokeByUser(userId); e != nil {
+		return e
+	}
+	version, e := s.dao.IncrTokenVersion(userId)
+	if e != nil {
+		return e
+	}
+	// 更新缓存失败时删除缓存，下次校验时从数据库加载新的版本号
+	k := fmt.Sprintf(TokenVersionKey, userId)
+	if _, e = s.setTokenVersion(userId, version); e != nil {
+		log.Printf("setTokenVersionScript.Run() failed, err: %v", e)
+		if e = s.redis.Del(ctx, k).Err(); e != nil {
+			log.Printf("redis.Del() failed, err: %v", e)
+			return code.RedisErr
+		}
+	}
+	return nil
+}
+
+func (s *userService) CheckToken(claims *secret.CustomClaims) error {
+	var (
+		logoutAt *redis.StringCmd
+		version  *redis.StringCmd
+	)
+	_, e := s.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		logoutAt = pipe.Get(ctx, fmt.Sprintf(TokenLogoutKey, claims.UserId, claims.DeviceId))
+		version = pipe.Get(ctx, fmt.Sprintf(TokenVersionKey, claims.UserId))
+		return nil
+	})
+	if e != nil && e != redis.Nil {
+		log.Printf("redis.Pipelined() failed, err: %v", e)
+		return code.RedisErr
+	}
+	// 令牌的会话在设备退出登录之前开始
+	if at, e := logoutAt.Int64(); e == nil && claims.SessionAt <= at {
+		return code.TokenRevokedErr
+	} else if e != nil && e != redis.Nil {
+		log.Printf("redis.Get() failed, err: %v", e)
+		return code.RedisErr
+	}
+	current, e := version.Int64()
+	if e == redis.Nil {
+		if current, e = s.loadTokenVersion(claims.UserId); e != nil {
+			return e
+		}
+	} else if e != nil {
+		log.Printf("redis.Get() failed, err: %v", e)
+		return code.RedisErr
+	}
+	if claims.TokenVersion < current {
+		return code.TokenRevokedErr
+	}
+	return nil
+}
+
+// 从数据库加载用户的令牌版本号并缓存
+func (s *userService) loadTokenVersion(userId uint) (int64, error) {
+	version, e := s.dao.QueryTokenVersion(userId)
+	if e != nil {
+		if e == code.RecordNotFoundErr {
+			// 用户已被删除，令牌全部失效
+			return 0, code.TokenRevokedErr
+		}
+		return 0, e
+	}
+	// 加载期间可能有退出全部设备写入了更大的版本号，以缓存中较大的版本号为准
+	current, e := s.setTokenVersion(userId, version)
+	if e != nil {
+		log.Printf("setTokenVersionScript.Run() failed, err: %v", e)
+		return version, nil
+	}
+	return current, nil
+}
+
+// 缓存用户的令牌版本号，缓存中已有更大的版本号时不覆盖，返回缓存中的版本号
+func (s *userService) setTokenVersion(userId uint, version int64) (int64, error) {
+	k := fmt.Sprintf(TokenVersionKey, userId)
+	return setTokenVersionScript.Run(ctx, s.redis, []string{k}, version, int64(TokenVersionExpire/time.Second)).Int64()
+}
@@ -0,0 +1,93 @@
+package user
+
+import (
+	"fmt"
+	"seckill/infra/code"
+	"testing"
+)
+
+// 退出全部设备后，之前签发的令牌全部失效，刷新令牌全部吊销
+func TestLogoutAll(t *testing.T) {
+	s, tokenDao := newTestUserService(t)
+	user := s.dao.(*fakeUserDao).user
+	phone, _ := s.generateToken(user, "phone")
+	if _, err := s.issueTokens(user, "laptop", nil); err != nil {
+		t.Fatal(err)
+	}
+	before, err := s.jwt.ParseToken(phone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CheckToken(before); err != nil {
+		t.Fatalf("CheckToken() before LogoutAll error = %v", err)
+	}
+	if err := s.LogoutAll(user.ID); err != nil {
+		t.Fatalf("LogoutAll() error = %v", err)
+	}
+	after, err := s.jwt.ParseToken(mustGenerateToken(t, s, user.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		cache bool
+		want  error
+	}{
+		{"缓存中的版本号", true, code.TokenRevokedErr},
+		{"缓存失效后从数据库加载", false, code.TokenRevokedErr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.cache {
+				s.redis.Del(ctx, fmt.Sprintf(TokenVersionKey, user.ID))
+			}
+			if err := s.CheckToken(before); err != tt.want {
+				t.Errorf("CheckToken() old token error = %v, want %v", err, tt.want)
+			}
+			if err := s.CheckToken(after); err != nil {
+				t.Errorf("CheckToken() new token error = %v, want nil", err)
+			}
+		})
+	}
+	for _, rt := range tokenDao.tokens {
+		if rt.RevokedAt == nil {
+			t.Errorf("refresh token of device %q is not revoked", rt.DeviceId)
+		}
+	}
+}
+
+// 使用数据库中最新的用户数据签发访问令牌
+func mustGenerateToken(t *testing.T, s *userService, userId uint) string {
+	t.Helper()
+	user, err := s.dao.QueryByID(userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.generateToken(user, DefaultDeviceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// 从数据库加载的旧版本号不能覆盖缓存中更大的版本号
+func TestSetTokenVersion(t *testing.T) {
+	s, _ := newTestUserService(t)
+	tests := []struct {
+		version int64
+		want    int64
+	}{
+		{2, 2},
+		{1, 2},
+		{3, 3},
+	}
+	for _, tt := range tests {
+		got, err := s.setTokenVersion(1, tt.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("setTokenVersion(%d) = %d, want %d", tt.version, got, tt.want)
+		}
+	}
+}